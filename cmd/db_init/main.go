@@ -2,154 +2,102 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"shnyr/internal/config"
+	"shnyr/internal/migrations"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
+// Создает базу из строки подключения, применяет миграции и добавляет начальные строки status и actions:
+//
+//	go run ./cmd/db_init                - создать базу, если ее нет, и применить миграции
+//	go run ./cmd/db_init -drop          - удалить базу со всеми данными и создать заново
 func main() {
-	// Подключаемся к MySQL без указания базы
-	dsn := "root:tY6@uI!oP_aZ8$cV@tcp(108.181.194.102:3306)/"
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		log.Fatalf("Ошибка подключения к MySQL: %v", err)
-	}
-	defer db.Close()
+	configPath := flag.String("config", os.Getenv("SHNYR_CONFIG"), "Путь к файлу конфигурации (по умолчанию config.yaml в текущей директории)")
+	dsn := flag.String("dsn", os.Getenv("SHNYR_DSN"), "Строка подключения к MySQL (по умолчанию SHNYR_DSN или из config.yaml)")
+	drop := flag.Bool("drop", false, "Удалить базу перед созданием")
+	flag.Parse()
 
-	// Удаляем базу, если есть
-	_, err = db.Exec("DROP DATABASE IF EXISTS octopus")
-	if err != nil {
-		log.Fatalf("Ошибка удаления базы: %v", err)
+	if *dsn == "" {
+		config.SetConfigFile(*configPath)
+		err, cfg := config.InitConfig()
+		if err != nil {
+			log.Fatalf("Ошибка чтения конфигурации: %v", err)
+		}
+		*dsn = cfg.DSN
 	}
-	fmt.Println("База данных octopus удалена (если была)")
-
-	// Создаём базу
-	_, err = db.Exec("CREATE DATABASE octopus CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci")
+	dsnConfig, err := mysql.ParseDSN(*dsn)
 	if err != nil {
-		log.Fatalf("Ошибка создания базы: %v", err)
+		log.Fatalf("Неверная строка подключения: %v", err)
 	}
-	fmt.Println("База данных octopus создана")
-
-	// Подключаемся к новой базе
-	db2, err := sql.Open("mysql", dsn+"octopus")
-	if err != nil {
-		log.Fatalf("Ошибка подключения к новой базе: %v", err)
+	name := dsnConfig.DBName
+	if name == "" {
+		log.Fatalf("В строке подключения не указана база")
 	}
-	defer db2.Close()
 
-	// Создаём таблицу
-	tableSQL := `CREATE TABLE ocr_results (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		image_path VARCHAR(255) NOT NULL,
-		image_data LONGBLOB,
-		ocr_text LONGTEXT,
-		debug_info LONGTEXT,
-		json_data LONGTEXT,
-		raw_text LONGTEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	)`
-	_, err = db2.Exec(tableSQL)
+	// Подключаемся к MySQL без указания базы
+	dsnConfig.DBName = ""
+	server, err := sql.Open("mysql", dsnConfig.FormatDSN())
 	if err != nil {
-		log.Fatalf("Ошибка создания таблицы ocr_results: %v", err)
+		log.Fatalf("Ошибка подключения к MySQL: %v", err)
 	}
-	fmt.Println("Таблица ocr_results создана")
+	defer server.Close()
 
-	// Создаём таблицу предметов с категориями
-	itemsTableSQL := `CREATE TABLE items_list (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		name VARCHAR(255) NOT NULL UNIQUE,
-		category VARCHAR(50) NOT NULL DEFAULT 'consumables',
-		min_price DECIMAL(15,2) DEFAULT 0,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	)`
-	_, err = db2.Exec(itemsTableSQL)
-	if err != nil {
-		log.Fatalf("Ошибка создания таблицы items_list: %v", err)
+	if *drop {
+		_, err = server.Exec("DROP DATABASE IF EXISTS `" + name + "`")
+		if err != nil {
+			log.Fatalf("Ошибка удаления базы: %v", err)
+		}
+		fmt.Printf("База данных %s удалена (если была)\n", name)
 	}
-	fmt.Println("Таблица items_list создана")
 
-	// Создаём таблицу для структурированных данных
-	structuredTableSQL := `CREATE TABLE structured_items (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		ocr_result_id INT,
-		title VARCHAR(255) NOT NULL,
-		title_short VARCHAR(255),
-		enhancement VARCHAR(10),
-		price VARCHAR(50) NOT NULL,
-		package BOOLEAN DEFAULT FALSE,
-		owner VARCHAR(255),
-		count VARCHAR(100),
-		category VARCHAR(50),
-		item_list_id INT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (ocr_result_id) REFERENCES ocr_results(id) ON DELETE CASCADE,
-		FOREIGN KEY (item_list_id) REFERENCES items_list(id) ON DELETE SET NULL
-	)`
-	_, err = db2.Exec(structuredTableSQL)
+	_, err = server.Exec("CREATE DATABASE IF NOT EXISTS `" + name + "` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci")
 	if err != nil {
-		log.Fatalf("Ошибка создания таблицы structured_items: %v", err)
+		log.Fatalf("Ошибка создания базы: %v", err)
 	}
-	fmt.Println("Таблица structured_items создана")
+	fmt.Printf("База данных %s готова\n", name)
 
-	// Создаем таблицу для исправлений данных
-	_, err = db2.Exec(`
-		CREATE TABLE IF NOT EXISTS item_corrections (
-			id INTEGER PRIMARY KEY AUTO_INCREMENT,
-			item_id INTEGER NOT NULL,
-			field_name VARCHAR(50) NOT NULL,
-			current_value TEXT,
-			corrected_value TEXT NOT NULL,
-			comment TEXT,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (item_id) REFERENCES structured_items(id) ON DELETE CASCADE
-		)
-	`)
+	db, err := sql.Open("mysql", *dsn)
 	if err != nil {
-		log.Fatal("Ошибка создания таблицы item_corrections:", err)
+		log.Fatalf("Ошибка подключения к базе: %v", err)
 	}
-	fmt.Println("Таблица item_corrections создана")
+	defer db.Close()
 
-	// Создаем таблицу для статуса ШНЫРЯ
-	_, err = db2.Exec(`
-		CREATE TABLE IF NOT EXISTS status (
-			id INT AUTO_INCREMENT PRIMARY KEY,
-			current_status VARCHAR(100) NOT NULL DEFAULT 'stopped',
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		log.Fatal("Ошибка создания таблицы status:", err)
+	applied, err := migrations.Up(db)
+	for _, m := range applied {
+		fmt.Printf("Миграция %04d_%s применена\n", m.Version, m.Name)
 	}
-	fmt.Println("Таблица status создана")
-
-	// Вставляем начальный статус
-	_, err = db2.Exec("INSERT INTO status (current_status) VALUES ('stopped')")
 	if err != nil {
-		log.Fatal("Ошибка вставки начального статуса:", err)
+		log.Fatalf("%v", err)
 	}
-	fmt.Println("Начальный статус 'stopped' установлен")
 
-	// Создаем таблицу для действий ШНЫРЯ
-	_, err = db2.Exec(`
-		CREATE TABLE IF NOT EXISTS actions (
-			id INT AUTO_INCREMENT PRIMARY KEY,
-			action VARCHAR(255) NOT NULL,
-			executed BOOLEAN DEFAULT FALSE,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		log.Fatal("Ошибка создания таблицы actions:", err)
+	// Начальный статус и действие добавляются только в пустые таблицы
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM status").Scan(&count); err != nil {
+		log.Fatalf("Ошибка чтения таблицы status: %v", err)
+	}
+	if count == 0 {
+		_, err = db.Exec("INSERT INTO status (current_status, reason) VALUES ('stopped', 'Инициализация базы')")
+		if err != nil {
+			log.Fatal("Ошибка вставки начального статуса:", err)
+		}
+		fmt.Println("Начальный статус 'stopped' установлен")
 	}
-	fmt.Println("Таблица actions создана")
 
-	// Вставляем начальное действие
-	_, err = db2.Exec("INSERT INTO actions (action, executed) VALUES ('system_initialized', TRUE)")
-	if err != nil {
-		log.Fatal("Ошибка вставки начального действия:", err)
+	if err := db.QueryRow("SELECT COUNT(*) FROM actions").Scan(&count); err != nil {
+		log.Fatalf("Ошибка чтения таблицы actions: %v", err)
+	}
+	if count == 0 {
+		_, err = db.Exec("INSERT INTO actions (action, executed) VALUES ('system_initialized', TRUE)")
+		if err != nil {
+			log.Fatal("Ошибка вставки начального действия:", err)
+		}
+		fmt.Println("Начальное действие 'system_initialized' добавлено")
 	}
-	fmt.Println("Начальное действие 'system_initialized' добавлено")
 
 	fmt.Println("Инициализация базы завершена!")
 }
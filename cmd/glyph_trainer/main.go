@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"shnyr/internal/ocr"
+	"strings"
+)
+
+// Собирает набор глифов для движка OCR glyph из размеченных вырезок.
+// Каждой вырезке crop.png соответствует файл crop.txt с текстом: по строке файла на строку текста вырезки.
+func main() {
+	dir := flag.String("dir", "", "Каталог с размеченными вырезками (*.png + *.txt)")
+	output := flag.String("out", "glyphs.json", "Файл набора глифов")
+	threshold := flag.Int("threshold", ocr.DefaultInkThreshold, "Порог яркости текста")
+	spaceWidth := flag.Int("space", 3, "Ширина промежутка, начиная с которой он считается пробелом")
+	merge := flag.Bool("merge", false, "Дополнить существующий набор -out, а не создавать новый")
+	flag.Parse()
+
+	if *dir == "" {
+		log.Fatalf("Укажите каталог с вырезками: go run ./cmd/glyph_trainer -dir ./glyph_samples -out glyphs.json")
+	}
+
+	set := ocr.NewGlyphSet(*threshold)
+	set.SpaceWidth = *spaceWidth
+	if *merge {
+		existing, err := ocr.LoadGlyphSet(*output)
+		if err != nil {
+			log.Fatalf("Ошибка загрузки набора глифов: %v", err)
+		}
+		set = existing
+	}
+
+	files, err := filepath.Glob(filepath.Join(*dir, "*.png"))
+	if err != nil {
+		log.Fatalf("Ошибка чтения каталога %s: %v", *dir, err)
+	}
+
+	var used, skipped int
+	for _, file := range files {
+		labelFile := strings.TrimSuffix(file, filepath.Ext(file)) + ".txt"
+		label, err := os.ReadFile(labelFile)
+		if err != nil {
+			fmt.Printf("⚠️ %s: нет разметки %s\n", file, filepath.Base(labelFile))
+			skipped++
+			continue
+		}
+
+		n, err := train(set, file, string(label))
+		if err != nil {
+			fmt.Printf("⚠️ %s: %v\n", file, err)
+			skipped++
+			continue
+		}
+		fmt.Printf("✅ %s: символов %d\n", filepath.Base(file), n)
+		used++
+	}
+
+	if err := set.Save(*output); err != nil {
+		log.Fatalf("%v", err)
+	}
+	fmt.Printf("\nВырезок использовано: %d, пропущено: %d, шаблонов в наборе: %d -> %s\n", used, skipped, len(set.Glyphs), *output)
+}
+
+// train добавляет в набор символы вырезки file с разметкой label и возвращает их количество.
+// Вырезка пропускается целиком, если число строк или символов не совпадает с разметкой.
+func train(set *ocr.GlyphSet, file string, label string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка декодирования: %v", err)
+	}
+
+	var texts []string
+	for _, text := range strings.Split(strings.ReplaceAll(label, "\r\n", "\n"), "\n") {
+		if text = strings.TrimSpace(text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	lines := ocr.SegmentLines(img, set.Threshold)
+	if len(lines) != len(texts) {
+		return 0, fmt.Errorf("строк на изображении %d, в разметке %d", len(lines), len(texts))
+	}
+
+	// Сначала проверяем всю вырезку, чтобы не добавить в набор часть символов неверно сегментированной строки
+	for i, line := range lines {
+		chars := []rune(strings.ReplaceAll(texts[i], " ", ""))
+		if len(chars) != len(line.Glyphs) {
+			return 0, fmt.Errorf("строка %d: символов на изображении %d, в разметке %d (%q)", i+1, len(line.Glyphs), len(chars), texts[i])
+		}
+	}
+
+	count := 0
+	for i, line := range lines {
+		chars := []rune(strings.ReplaceAll(texts[i], " ", ""))
+		for j, glyph := range line.Glyphs {
+			if err := set.Add(string(chars[j]), glyph); err != nil {
+				fmt.Printf("⚠️ %s, строка %d, символ %d: %v\n", filepath.Base(file), i+1, j+1, err)
+				continue
+			}
+			count++
+		}
+	}
+	return count, nil
+}
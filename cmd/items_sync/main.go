@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"shnyr/internal/config"
+	"shnyr/internal/database"
+	"shnyr/internal/logger"
+	"shnyr/internal/migrations"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// Синхронизирует items_list с каталогом items.txt так же, как cycle_listed_items перед обходом:
+//
+//	go run ./cmd/items_sync -dry-run            - показать, что изменится, ничего не записывая
+//	go run ./cmd/items_sync                     - применить изменения
+//	go run ./cmd/items_sync -file other.txt     - другой файл каталога
+func main() {
+	configPath := flag.String("config", os.Getenv("SHNYR_CONFIG"), "Путь к файлу конфигурации (по умолчанию config.yaml в текущей директории)")
+	dsn := flag.String("dsn", os.Getenv("SHNYR_DSN"), "Строка подключения к MySQL (по умолчанию SHNYR_DSN или из config.yaml)")
+	file := flag.String("file", database.DefaultCatalogFile, "Файл каталога предметов")
+	dryRun := flag.Bool("dry-run", false, "Только показать разницу, ничего не записывая")
+	flag.Parse()
+
+	if *dsn == "" {
+		config.SetConfigFile(*configPath)
+		err, cfg := config.InitConfig()
+		if err != nil {
+			log.Fatalf("Ошибка чтения конфигурации: %v", err)
+		}
+		*dsn = cfg.DSN
+	}
+	if *dsn == "" {
+		log.Fatalf("Укажите -dsn, SHNYR_DSN или dsn в config.yaml")
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		log.Fatalf("Ошибка подключения к базе: %v", err)
+	}
+	defer db.Close()
+	if err := migrations.Check(db); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	loggerManager, err := logger.NewLoggerManager("items_sync.log")
+	if err != nil {
+		log.Fatalf("Ошибка инициализации логгера: %v", err)
+	}
+	diff, err := database.NewDatabaseManager(db, loggerManager).SyncItemsTable(*file, *dryRun)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	for _, change := range diff.Changes {
+		switch change.Action {
+		case database.CatalogAdd:
+			fmt.Printf("+ %-16s %s: %.0f\n", change.Category, change.Name, change.MinPrice)
+		case database.CatalogRemove:
+			fmt.Printf("- %-16s %s (id %d)\n", change.Category, change.Name, change.ID)
+		case database.CatalogRestore:
+			fmt.Printf("↺ %-16s %s (id %d): %.0f\n", change.Category, change.Name, change.ID, change.MinPrice)
+		case database.CatalogUpdate:
+			name := change.Name
+			if change.OldName != "" {
+				name = change.OldName + " -> " + change.Name
+			}
+			fmt.Printf("~ %-16s %s (id %d): %.0f -> %.0f\n", change.Category, name, change.ID, change.OldMinPrice, change.MinPrice)
+		}
+	}
+
+	if *dryRun {
+		fmt.Printf("\n🔍 Будет: %s\n", diff.Summary())
+		return
+	}
+	fmt.Printf("\n✅ Каталог синхронизирован: %s\n", diff.Summary())
+}
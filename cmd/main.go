@@ -5,23 +5,26 @@ import (
 	"database/sql"
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"shnyr/internal/arduino"
 	"shnyr/internal/click_manager"
+	"shnyr/internal/commands"
 	"shnyr/internal/config"
 	"shnyr/internal/database"
 	imageInternal "shnyr/internal/image"
 	"shnyr/internal/interrupt"
+	"shnyr/internal/lifecycle"
 	"shnyr/internal/logger"
+	"shnyr/internal/migrations"
 	"shnyr/internal/ocr"
+	"shnyr/internal/scheduler"
 	"shnyr/internal/screenshot"
-	cycleAllItems "shnyr/internal/scripts/cycle_all_items"
-	cycleListedItems "shnyr/internal/scripts/cycle_listed_items"
 	"strconv"
 	"strings"
 	"time"
 
+	cycleListedItems "shnyr/internal/scripts/cycle_listed_items"
+
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/tarm/serial"
 )
@@ -100,97 +103,109 @@ func getStartItemFromConsole() int {
 	}
 }
 
-// updateStatus обновляет статус в базе данных
-func updateStatus(db *sql.DB, status string) error {
-	_, err := db.Exec("INSERT INTO status (current_status) VALUES (?)", status)
-	return err
-}
-
 // addAction добавляет действие в базу данных
 func addAction(db *sql.DB, action string) error {
 	_, err := db.Exec("INSERT INTO actions (action) VALUES (?)", action)
 	return err
 }
 
-// updateLatestPendingAction помечает последнее невыполненное действие как выполненное
-func updateLatestPendingAction(db *sql.DB) error {
-	// Сначала получаем ID последнего невыполненного действия
-	var actionID int
-	err := db.QueryRow("SELECT id FROM actions WHERE executed = FALSE ORDER BY created_at DESC LIMIT 1").Scan(&actionID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			// Нет невыполненных действий
-			return nil
-		}
-		return err
+// dryRun проверяет конфигурацию и правила расписания после подключения к БД, не открывая порт Arduino и не трогая окно игры
+func dryRun(opts options, c *config.Config, loggerManager *logger.LoggerManager) int {
+	loggerManager.Info("🧪 Пробный запуск: порт Arduino и окно игры не используются")
+	loggerManager.Info("🔘 Начальная кнопка: %d, 📍 начальный предмет: %d", c.StartButtonIndex, c.StartItemIndex)
+	if opts.script != "" {
+		loggerManager.Info("🚀 Скрипт для автозапуска: %s", opts.script)
 	}
 
-	// Затем обновляем это действие
-	_, err = db.Exec("UPDATE actions SET executed = TRUE WHERE id = ?", actionID)
-	return err
+	engine, err := ocr.NewEngine(c.OCR)
+	if err != nil {
+		loggerManager.LogError(err, "Ошибка в настройках OCR")
+		return exitError
+	}
+	loggerManager.Info("🔤 Движок OCR: %s", engine.Name())
+	rules, err := scheduler.RulesFromConfig(c.Schedule)
+	if err != nil {
+		loggerManager.LogError(err, "Ошибка в правилах расписания config.yaml")
+		return exitError
+	}
+	loggerManager.Info("🗓️ Правил расписания в config.yaml: %d", len(rules))
+	loggerManager.Info("✅ Пробный запуск завершен")
+	return exitOK
 }
 
-// getLatestPendingAction возвращает последнее невыполненное действие
-func getLatestPendingAction(db *sql.DB) (string, error) {
-	var action string
-	err := db.QueryRow("SELECT action FROM actions WHERE executed = FALSE ORDER BY created_at DESC LIMIT 1").Scan(&action)
+func main() {
+	opts, err := parseOptions(os.Args[1:])
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", nil
+		if err == flag.ErrHelp {
+			os.Exit(exitOK)
 		}
-		return "", err
+		fmt.Fprintln(os.Stderr, "❌", err)
+		os.Exit(exitUsage)
 	}
-	return action, nil
+	os.Exit(runApp(opts))
 }
 
-func main() {
-	// Парсим аргументы командной строки
-	startButtonPtr := flag.Int("start", 1, "Начальная кнопка (1-6)")
-	startItemPtr := flag.Int("item", 1, "Начальный предмет (1 для начала с первого)")
-	flag.Parse()
-
-	var startButton, startItem int
-
-	// Если указан аргумент -start, используем его, иначе запрашиваем ввод через консоль
-	if flag.NFlag() > 0 {
-		// Проверяем валидность начальной кнопки из аргументов
-		if *startButtonPtr < 1 || *startButtonPtr > 6 {
-			log.Fatal("Начальная кнопка должна быть в диапазоне 1-6")
+// runApp запускает бота с параметрами opts и возвращает код завершения программы
+func runApp(opts options) int {
+	startButton, startItem := opts.startButton, opts.startItem
+
+	// Консоль опрашивается только в интерактивном режиме, чтобы запуск из планировщика или службы не зависал на вводе
+	if opts.interactive {
+		if !opts.startButtonSet {
+			startButton = getStartButtonFromConsole()
+		}
+		if !opts.startItemSet {
+			startItem = getStartItemFromConsole()
 		}
-		startButton = *startButtonPtr
-		startItem = *startItemPtr
-	} else {
-		// Если аргумент не указан, запрашиваем ввод через консоль
-		startButton = getStartButtonFromConsole()
-		startItem = getStartItemFromConsole()
 	}
 
 	// init конфигурации
+	config.SetConfigFile(opts.configPath)
 	err, c := config.InitConfig()
 	if err != nil {
-		return
+		return exitError
 	}
 
 	// Устанавливаем начальную кнопку и предмет
 	c.StartButtonIndex = startButton
 	c.StartItemIndex = startItem
 
+	logFormat := opts.logFormat
+	if logFormat == "" {
+		logFormat = c.LogFormat
+	}
+	format, err := logger.ParseFormat(logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return exitUsage
+	}
+
 	// Инициализация логгера
 	loggerManager, err := logger.NewLoggerManager(c.LogFilePath)
 	if err != nil {
-		log.Fatal("Error initializing logger: ", err)
+		fmt.Fprintln(os.Stderr, "Error initializing logger:", err)
+		return exitError
 	}
 	defer loggerManager.Close()
+	loggerManager.SetFormat(format)
 
 	loggerManager.Info("🚀 Запуск приложения ШНЫРЬ")
 	loggerManager.Info("🔘 Начальная кнопка: %d", c.StartButtonIndex)
 	loggerManager.Info("📍 Начальный предмет: %d", c.StartItemIndex)
 
 	// Подключение к базе данных MySQL
-	db, err := sql.Open("mysql", "root:tY6@uI!oP_aZ8$cV@tcp(108.181.194.102:3306)/octopus?parseTime=true")
+	dsn := opts.dsn
+	if dsn == "" {
+		dsn = c.DSN
+	}
+	if dsn == "" {
+		loggerManager.Info("❌ Укажите -dsn, SHNYR_DSN или dsn в config.yaml")
+		return exitUsage
+	}
+	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		loggerManager.LogError(err, "Error connecting to database")
-		return
+		return exitError
 	}
 	defer db.Close()
 
@@ -198,12 +213,37 @@ func main() {
 	err = db.Ping()
 	if err != nil {
 		loggerManager.LogError(err, "Error pinging database")
-		return
+		return exitError
 	}
 	loggerManager.Info("✅ Успешное подключение к базе данных")
 
+	if opts.dryRun {
+		return dryRun(opts, &c, loggerManager)
+	}
+
+	// Схему создает и обновляет cmd/migrate; бот только проверяет, что она актуальна
+	err = migrations.Check(db)
+	if err != nil {
+		loggerManager.LogError(err, "Ошибка проверки схемы базы")
+		return exitError
+	}
+
+	// Инициализация машины состояний - единственного писателя таблицы status
+	machine, err := lifecycle.NewMachine(db, loggerManager)
+	if err != nil {
+		loggerManager.LogError(err, "Error loading lifecycle state")
+		return exitError
+	}
+
+	// Очередь команд от веб-интерфейса
+	instance := c.InstanceName
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	loggerManager.Info("🏷️ Экземпляр бота: %s", instance)
+
 	// Обновляем статус при запуске
-	err = updateStatus(db, "main")
+	err = machine.Transition(lifecycle.StateMain, "Приложение запущено")
 	if err != nil {
 		loggerManager.LogError(err, "Error updating status")
 	}
@@ -219,7 +259,8 @@ func main() {
 	portObj, err := arduino.InitializePort(c.Port, c.BaudRate)
 	if err != nil {
 		loggerManager.LogError(err, "Error opening arduino port")
-		return
+		machine.Transition(lifecycle.StateError, "Не удалось открыть порт Arduino")
+		return exitError
 	}
 	defer func(port *serial.Port) {
 		err := port.Close()
@@ -240,21 +281,93 @@ func main() {
 	marginX, marginY, err := windowInitializer.GetItemBrokerWindowMargins()
 	if err != nil {
 		loggerManager.LogError(err, "Ошибка инициализации окна")
-		return
+		machine.Transition(lifecycle.StateError, "Окно брокера не найдено")
+		return exitError
 	}
 
 	// Инициализация всех менеджеров
 	screenshotManager := screenshot.NewScreenshotManager(marginX, marginY)
 	dbManager := database.NewDatabaseManager(db, loggerManager)
-	ocrManager := ocr.NewOCRManager(&c)
+	// Результаты OCR проходят через спул на диске; оставшиеся после прошлого запуска записываются сразу
+	spool, err := database.NewSpool(c.SpoolDir)
+	if err != nil {
+		loggerManager.LogError(err, "Ошибка открытия спула")
+		machine.Transition(lifecycle.StateError, "Не удалось открыть спул результатов OCR")
+		return exitError
+	}
+	dbManager.SetSpool(spool)
+	if c.SaveToDB == 1 {
+		replayed, err := dbManager.ReplaySpool()
+		if err != nil {
+			loggerManager.LogError(err, "Ошибка воспроизведения спула")
+		} else if replayed > 0 {
+			loggerManager.Info("♻️ Из спула записано результатов OCR: %d", replayed)
+		}
+	}
+	ocrManager, err := ocr.NewOCRManager(&c)
+	if err != nil {
+		loggerManager.LogError(err, "Ошибка инициализации OCR")
+		machine.Transition(lifecycle.StateError, "Не удалось инициализировать OCR")
+		return exitError
+	}
+	loggerManager.Info("🔤 Движок OCR: %s", ocrManager.Engine().Name())
+	if c.OCR.Cache.Enabled {
+		var dbStore ocr.CacheStore
+		if c.OCR.Cache.Store == ocr.CacheStoreDB {
+			dbStore = database.NewOCRCacheStore(db)
+		}
+		cache, err := ocr.NewCacheFromConfig(c.OCR, dbStore)
+		if err != nil {
+			loggerManager.LogError(err, "Ошибка инициализации кэша OCR")
+			machine.Transition(lifecycle.StateError, "Не удалось инициализировать кэш OCR")
+			return exitError
+		}
+		ocrManager.SetCache(cache)
+		ocrManager.SetLogger(loggerManager)
+		switch {
+		case dbStore != nil:
+			loggerManager.Info("♻️ Кэш OCR включен: таблица ocr_cache")
+		case c.OCR.Cache.Dir != "":
+			loggerManager.Info("♻️ Кэш OCR включен: каталог %s", c.OCR.Cache.Dir)
+		default:
+			loggerManager.Info("♻️ Кэш OCR включен: каталог %s", ocr.DefaultCacheDir)
+		}
+	}
+	// Словарь замен из повторяющихся исправлений загружается перед каждым запуском скрипта
+	normalizer := ocr.NewNormalizer(nil)
+	ocrManager.SetNormalizer(normalizer)
 	clickManager := click_manager.NewClickManager(portObj, &c, marginX, marginY, screenshotManager, dbManager, loggerManager)
 	screenshotManager.SaveScreenShotFull()
 	// Инициализация менеджера прерываний
 	interruptManager := interrupt.NewInterruptManager(loggerManager)
 
+	runner := &scriptRunner{
+		c:                 &c,
+		db:                db,
+		machine:           machine,
+		screenshotManager: screenshotManager,
+		dbManager:         dbManager,
+		ocrManager:        ocrManager,
+		normalizer:        normalizer,
+		clickManager:      clickManager,
+		loggerManager:     loggerManager,
+		interruptManager:  interruptManager,
+		queue:             commands.NewQueue(db, instance),
+	}
+	interruptManager.SetPauseHandler(runner.onPause)
+	// Команды, оставшиеся забранными или выполняющимися после падения бота, не должны висеть в очереди
+	requeued, failed, err := runner.queue.Recover()
+	if err != nil {
+		loggerManager.LogError(err, "Ошибка разбора команд прошлого запуска")
+	} else if requeued > 0 || failed > 0 {
+		loggerManager.Info("📨 Команды прошлого запуска: возвращено в очередь %d, завершено ошибкой %d", requeued, failed)
+	}
+	// Команды scan_item, пришедшие во время обхода, сканируются между предметами
+	cycleListedItems.SetOnDemandSource(onDemandSource{r: runner})
+
 	// Обработка завершения программы (после создания dbManager)
 	defer func() {
-		err = dbManager.UpdateStatus("stopped")
+		err = machine.Transition(lifecycle.StateStopped, "Программа завершена")
 		if err != nil {
 			loggerManager.LogError(err, "Error updating status to stopped on exit")
 		}
@@ -266,10 +379,10 @@ func main() {
 	}()
 
 	loggerManager.Info("⏸️ Программа готова к работе")
-	loggerManager.Info("🔥 Горячие клавиши: Ctrl+Shift+1 для cycle_all_items, Ctrl+Shift+2 для cycle_listed_items, Q для прерывания")
+	loggerManager.Info("🔥 Горячие клавиши: Ctrl+Shift+1 для cycle_all_items, Ctrl+Shift+2 для cycle_listed_items, Ctrl+Shift+P для паузы/продолжения, Q для прерывания")
 
 	// Обновляем статус на "ready"
-	err = updateStatus(db, "ready")
+	err = machine.Transition(lifecycle.StateReady, "Программа готова к работе")
 	if err != nil {
 		loggerManager.LogError(err, "Error updating status to ready")
 	}
@@ -281,232 +394,59 @@ func main() {
 	// запускаем мониторинг горячих клавиш
 	interruptManager.StartMonitoring()
 
-	// Запускаем горутину для периодической проверки невыполненных действий
+	// Планировщик сканирований: правила из config.yaml и таблицы schedule_rules
+	rules, err := scheduler.RulesFromConfig(c.Schedule)
+	if err != nil {
+		loggerManager.LogError(err, "Ошибка в правилах расписания config.yaml")
+		return exitError
+	}
+	dbRules, err := scheduler.RulesFromDB(db)
+	if err != nil {
+		loggerManager.LogError(err, "Ошибка в правилах расписания schedule_rules")
+		return exitError
+	}
+	rules = append(rules, dbRules...)
+	// При автозапуске программа завершается после скрипта, поэтому расписание не запускаем
+	if opts.script == "" {
+		err = scheduler.NewScheduler(db, loggerManager, rules, runner.runScheduled, runner.isBusy).Start()
+		if err != nil {
+			loggerManager.LogError(err, "Error starting scheduler")
+			return exitError
+		}
+	}
+
+	// Запускаем горутину для опроса очереди команд
 	go func() {
 		for {
-			// Проверяем каждые 5 секунд
-			time.Sleep(5 * time.Second)
-
-			// Проверяем, не запущен ли уже скрипт
-			if interruptManager.IsScriptRunning() {
-				continue
-			}
-
-			// Проверяем последнее невыполненное действие
-			latestPendingAction, err := getLatestPendingAction(db)
-			if err != nil {
-				loggerManager.LogError(err, "Ошибка получения последнего невыполненного действия")
-				continue
-			}
-
-			if latestPendingAction == "start" {
-				loggerManager.Info("🚀 Обнаружено невыполненное действие 'start', запускаем cycle_listed_items")
-
-				// Помечаем действие как выполненное
-				err = updateLatestPendingAction(db)
-				if err != nil {
-					loggerManager.LogError(err, "Ошибка обновления последнего действия")
-				}
-
-				// Запускаем cycle_listed_items
-				err = dbManager.UpdateStatus("cycle_listed_items")
-				if err != nil {
-					loggerManager.LogError(err, "Error updating status to cycle_listed_items")
-				}
-				err = addAction(db, "Запуск cycle_listed_items (автоматический)")
-				if err != nil {
-					loggerManager.LogError(err, "Error adding cycle_listed_items action")
-				}
-
-				// Канал для завершения cycle_listed_items
-				scriptDoneChan := make(chan bool, 1)
-				interruptManager.SetScriptRunning(true)
-
-				// Запускаем cycle_listed_items в отдельной горутине
-				go func() {
-					defer func() {
-						// При завершении (нормальном или прерывании) обновляем статус
-						if interruptManager.IsInterrupted() {
-							err = dbManager.UpdateStatus("stopped")
-							if err != nil {
-								loggerManager.LogError(err, "Error updating status to stopped")
-							}
-							err = updateLatestPendingAction(db)
-							if err != nil {
-								loggerManager.LogError(err, "Error updating latest pending action")
-							}
-							err = addAction(db, "cycle_listed_items прерван")
-							if err != nil {
-								loggerManager.LogError(err, "Error adding interruption action")
-							}
-						} else {
-							err = dbManager.UpdateStatus("ready")
-							if err != nil {
-								loggerManager.LogError(err, "Error updating status to ready")
-							}
-							err = updateLatestPendingAction(db)
-							if err != nil {
-								loggerManager.LogError(err, "Error updating latest pending action")
-							}
-							err = addAction(db, "cycle_listed_items завершен")
-							if err != nil {
-								loggerManager.LogError(err, "Error adding completion action")
-							}
-						}
-						scriptDoneChan <- true
-					}()
-
-					cycleListedItems.Run(&c, screenshotManager, dbManager, ocrManager, clickManager, loggerManager, interruptManager)
-				}()
-
-				// Ждем завершения cycle_listed_items
-				<-scriptDoneChan
-				interruptManager.SetScriptRunning(false)
-				loggerManager.Info("✅ cycle_listed_items завершен. Нажмите Ctrl+Shift+2 для повторного запуска")
-			}
+			// Проверяем каждые 2 секунды
+			time.Sleep(2 * time.Second)
+			runner.pollCommands()
 		}
 	}()
 
+	if opts.script != "" {
+		return runner.autoStart(opts.script)
+	}
+
 	for range interruptManager.GetScriptStartChan() {
-		// Сбрасываем флаг прерывания при запуске нового скрипта
-		interruptManager.SetInterrupted(false)
+		// Определяем какой скрипт запускать по типу сигнала
+		scriptType := interruptManager.GetLastScriptType()
 
-		// Проверяем текущий статус перед запуском скрипта
-		currentStatus, err := dbManager.GetCurrentStatus()
-		if err != nil {
-			loggerManager.LogError(err, "Ошибка получения текущего статуса")
-			continue
-		}
+		loggerManager.Info("🚀 Запуск %s...", scriptType)
+		loggerManager.Info("💡 Для прерывания нажмите Q (работает глобально)")
 
-		// Запускаем скрипт только если статус "stopped", "ready" или "main"
-		if currentStatus != "stopped" && currentStatus != "ready" && currentStatus != "main" {
-			loggerManager.Info("⚠️ Скрипт не может быть запущен. Текущий статус: %s. Ожидаемый статус: stopped, ready или main", currentStatus)
+		err = runner.run(scriptType, "Запуск "+scriptType)
+		if err != nil {
+			loggerManager.Info("⚠️ Скрипт %s не может быть запущен: %v", scriptType, err)
 			continue
 		}
 
-		// Определяем какой скрипт запускать по типу сигнала
-		scriptType := interruptManager.GetLastScriptType()
-
 		switch scriptType {
 		case "cycle_all_items":
-			loggerManager.Info("🚀 Запуск cycle_all_items...")
-			loggerManager.Info("💡 Для прерывания нажмите Q (работает глобально)")
-
-			// Обновляем статус на запуск скрипта
-			err = dbManager.UpdateStatus("cycle_all_items")
-			if err != nil {
-				loggerManager.LogError(err, "Error updating status to cycle_all_items")
-			}
-			err = addAction(db, "Запуск cycle_all_items")
-			if err != nil {
-				loggerManager.LogError(err, "Error adding cycle_all_items action")
-			}
-
-			// Канал для завершения cycle_all_items
-			scriptDoneChan := make(chan bool, 1)
-			interruptManager.SetScriptRunning(true)
-
-			// Запускаем cycle_all_items в отдельной горутине
-			go func() {
-				defer func() {
-					// При завершении (нормальном или прерывании) обновляем статус
-					if interruptManager.IsInterrupted() {
-						err = dbManager.UpdateStatus("stopped")
-						if err != nil {
-							loggerManager.LogError(err, "Error updating status to stopped")
-						}
-						err = updateLatestPendingAction(db)
-						if err != nil {
-							loggerManager.LogError(err, "Error updating latest pending action")
-						}
-						err = addAction(db, "cycle_all_items прерван")
-						if err != nil {
-							loggerManager.LogError(err, "Error adding interruption action")
-						}
-					} else {
-						err = dbManager.UpdateStatus("ready")
-						if err != nil {
-							loggerManager.LogError(err, "Error updating status to ready")
-						}
-						err = updateLatestPendingAction(db)
-						if err != nil {
-							loggerManager.LogError(err, "Error updating latest pending action")
-						}
-						err = addAction(db, "cycle_all_items завершен")
-						if err != nil {
-							loggerManager.LogError(err, "Error adding completion action")
-						}
-					}
-					scriptDoneChan <- true
-				}()
-
-				cycleAllItems.Run(&c, screenshotManager, dbManager, ocrManager, clickManager, loggerManager, interruptManager)
-			}()
-
-			// Ждем завершения cycle_all_items
-			<-scriptDoneChan
-			interruptManager.SetScriptRunning(false)
 			loggerManager.Info("✅ cycle_all_items завершен. Нажмите Ctrl+Shift+1 для повторного запуска")
-
 		case "cycle_listed_items":
-			loggerManager.Info("🚀 Запуск cycle_listed_items...")
-			loggerManager.Info("💡 Для прерывания нажмите Q (работает глобально)")
-
-			// Обновляем статус на запуск скрипта
-			err = dbManager.UpdateStatus("cycle_listed_items")
-			if err != nil {
-				loggerManager.LogError(err, "Error updating status to cycle_listed_items")
-			}
-			err = addAction(db, "Запуск cycle_listed_items")
-			if err != nil {
-				loggerManager.LogError(err, "Error adding cycle_listed_items action")
-			}
-
-			// Канал для завершения cycle_listed_items
-			scriptDoneChan := make(chan bool, 1)
-			interruptManager.SetScriptRunning(true)
-
-			// Запускаем cycle_listed_items в отдельной горутине
-			go func() {
-				defer func() {
-					// При завершении (нормальном или прерывании) обновляем статус
-					if interruptManager.IsInterrupted() {
-						err = dbManager.UpdateStatus("stopped")
-						if err != nil {
-							loggerManager.LogError(err, "Error updating status to stopped")
-						}
-						err = updateLatestPendingAction(db)
-						if err != nil {
-							loggerManager.LogError(err, "Error updating latest pending action")
-						}
-						err = addAction(db, "cycle_listed_items прерван")
-						if err != nil {
-							loggerManager.LogError(err, "Error adding interruption action")
-						}
-					} else {
-						err = dbManager.UpdateStatus("ready")
-						if err != nil {
-							loggerManager.LogError(err, "Error updating status to ready")
-						}
-						err = updateLatestPendingAction(db)
-						if err != nil {
-							loggerManager.LogError(err, "Error updating latest pending action")
-						}
-						err = addAction(db, "cycle_listed_items завершен")
-						if err != nil {
-							loggerManager.LogError(err, "Error adding completion action")
-						}
-					}
-					scriptDoneChan <- true
-				}()
-
-				cycleListedItems.Run(&c, screenshotManager, dbManager, ocrManager, clickManager, loggerManager, interruptManager)
-			}()
-
-			// Ждем завершения cycle_listed_items
-			<-scriptDoneChan
-			interruptManager.SetScriptRunning(false)
 			loggerManager.Info("✅ cycle_listed_items завершен. Нажмите Ctrl+Shift+2 для повторного запуска")
 		}
 	}
+	return exitOK
 }
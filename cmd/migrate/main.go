@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"shnyr/internal/config"
+	"shnyr/internal/migrations"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// Применяет, откатывает и показывает миграции схемы базы из internal/migrations:
+//
+//	go run ./cmd/migrate up                - применить все непримененные миграции
+//	go run ./cmd/migrate down -steps 2     - откатить две последние миграции
+//	go run ./cmd/migrate status            - список миграций и время их применения
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv("SHNYR_CONFIG"), "Путь к файлу конфигурации (по умолчанию config.yaml в текущей директории)")
+	dsn := flags.String("dsn", os.Getenv("SHNYR_DSN"), "Строка подключения к MySQL (по умолчанию SHNYR_DSN или из config.yaml)")
+	steps := flags.Int("steps", 1, "Сколько последних миграций откатить (для down)")
+	flags.Parse(os.Args[2:])
+
+	switch command {
+	case "up", "down", "status":
+	default:
+		usage()
+	}
+	if *steps < 1 {
+		log.Fatalf("-steps должен быть больше 0")
+	}
+
+	if *dsn == "" {
+		config.SetConfigFile(*configPath)
+		err, cfg := config.InitConfig()
+		if err != nil {
+			log.Fatalf("Ошибка чтения конфигурации: %v", err)
+		}
+		*dsn = cfg.DSN
+	}
+	if *dsn == "" {
+		log.Fatalf("Укажите -dsn, SHNYR_DSN или dsn в config.yaml")
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		log.Fatalf("Ошибка подключения к базе: %v", err)
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		applied, err := migrations.Up(db)
+		for _, m := range applied {
+			fmt.Printf("⬆️ %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("✅ Схема актуальна")
+		} else {
+			fmt.Printf("✅ Применено миграций: %d\n", len(applied))
+		}
+	case "down":
+		reverted, err := migrations.Down(db, *steps)
+		for _, m := range reverted {
+			fmt.Printf("⬇️ %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Printf("✅ Откачено миграций: %d\n", len(reverted))
+	case "status":
+		states, err := migrations.Status(db)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		pending := 0
+		for _, s := range states {
+			appliedAt := "не применена"
+			if s.Applied() {
+				appliedAt = s.AppliedAt
+			} else {
+				pending++
+			}
+			fmt.Printf("%04d\t%-30s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		if pending > 0 {
+			fmt.Printf("\n⚠️ Не применено миграций: %d, выполните go run ./cmd/migrate up\n", pending)
+		}
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Использование: go run ./cmd/migrate up|down|status [-config путь] [-dsn строка] [-steps N]")
+	os.Exit(2)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"shnyr/internal/config"
+	"shnyr/internal/model"
+	"shnyr/internal/ocr"
+	ocrEval "shnyr/internal/ocr_eval"
+	"strings"
+)
+
+// Прогоняет OCR и разбор по корпусу размеченных изображений и считает точность по полям:
+//
+//	go run ./cmd/ocr_eval -dir ./ocr_corpus -engines cpp_ocr,glyph -config config.yaml
+//	go run ./cmd/ocr_eval -dir ./ocr_corpus -config config.yaml -json report.json
+//
+// Для каждого изображения *.png рядом лежит *.json с ожидаемыми structured_data.
+// Несколько движков через запятую прогоняются по одному корпусу и сравниваются в итоговой таблице.
+func main() {
+	dir := flag.String("dir", "", "Каталог корпуса: *.png и *.json с ожидаемыми structured_data")
+	engines := flag.String("engines", "", "Движки OCR через запятую (по умолчанию ocr.engine из конфига или cpp_ocr)")
+	configPath := flag.String("config", "", "config.yaml: настройки движков и построчного распознавания (ocr.rows)")
+	jsonPath := flag.String("json", "", "Файл отчета в JSON")
+	showDiffs := flag.Bool("diffs", true, "Печатать расхождения по изображениям")
+
+	// Без -config настройки движков задаются флагами, как в ocr_runner
+	var flagOCR config.OCR
+	flag.StringVar(&flagOCR.CppOCRPath, "cpp-ocr-path", "", "Путь к cpp_ocr.exe")
+	flag.StringVar(&flagOCR.TesseractPath, "tesseract-path", "", "Путь к tesseract")
+	flag.StringVar(&flagOCR.TesseractLang, "tesseract-lang", "", "Языки tesseract")
+	flag.StringVar(&flagOCR.HTTPURL, "url", "", "Адрес HTTP-сервиса OCR")
+	flag.StringVar(&flagOCR.StubDir, "stub-dir", "", "Каталог с заготовленными ответами для stub")
+	flag.StringVar(&flagOCR.GlyphSet, "glyph-set", "", "Набор глифов для glyph")
+	flag.Parse()
+
+	if *dir == "" {
+		log.Fatalf("Укажите каталог корпуса: go run ./cmd/ocr_eval -dir ./ocr_corpus -engines cpp_ocr,glyph")
+	}
+
+	var cfg config.Config
+	if *configPath != "" {
+		config.SetConfigFile(*configPath)
+		var err error
+		if err, cfg = config.InitConfig(); err != nil {
+			log.Fatalf("Ошибка чтения конфигурации: %v", err)
+		}
+	} else {
+		cfg.OCR = flagOCR
+	}
+
+	names := strings.Split(*engines, ",")
+	if *engines == "" {
+		names = []string{cfg.OCR.Engine}
+		if names[0] == "" {
+			names[0] = ocr.EngineCppOCR
+		}
+	}
+
+	cases, skipped, err := ocrEval.LoadCorpus(*dir)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	for _, s := range skipped {
+		fmt.Printf("⚠️ %s\n", s)
+	}
+	if len(cases) == 0 {
+		log.Fatalf("В %s нет размеченных изображений", *dir)
+	}
+
+	var reports []ocrEval.EngineReport
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		engineCfg := cfg
+		engineCfg.OCR.Engine = name
+		engine, err := ocr.NewEngine(engineCfg.OCR)
+		if err != nil {
+			log.Fatalf("Ошибка инициализации движка %s: %v", name, err)
+		}
+		manager := ocr.NewOCRManagerWithEngine(&engineCfg, engine)
+
+		fmt.Printf("\n🔤 %s: изображений %d\n", engine.Name(), len(cases))
+		var images []ocrEval.ImageReport
+		for _, c := range cases {
+			images = append(images, evaluate(manager, c))
+		}
+		report := ocrEval.NewEngineReport(engine.Name(), images)
+		reports = append(reports, report)
+		if *showDiffs {
+			printDiffs(report)
+		}
+	}
+
+	printSummary(reports)
+
+	if *jsonPath != "" {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			log.Fatalf("Ошибка сериализации отчета: %v", err)
+		}
+		if err := os.WriteFile(*jsonPath, data, 0644); err != nil {
+			log.Fatalf("Ошибка записи %s: %v", *jsonPath, err)
+		}
+		fmt.Printf("\n📄 Отчет записан в %s\n", *jsonPath)
+	}
+}
+
+// evaluate распознает изображение так же, как конвейер бота (ProcessOffers), и сравнивает с разметкой
+func evaluate(manager *ocr.OCRManager, c ocrEval.Case) ocrEval.ImageReport {
+	path, err := filepath.Abs(c.Image)
+	if err != nil {
+		return ocrEval.Missing(c.Name, c.Expected, err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return ocrEval.Missing(c.Name, c.Expected, err)
+	}
+	img, _, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		return ocrEval.Missing(c.Name, c.Expected, fmt.Errorf("ошибка декодирования изображения: %v", err))
+	}
+
+	result, err := manager.ProcessOffers(img, path)
+	if err != nil {
+		return ocrEval.Missing(c.Name, c.Expected, err)
+	}
+	var actual []model.OCRItem
+	if result.Parsed != nil {
+		actual = result.Parsed.TextRecognition.StructuredData
+	}
+	report := ocrEval.Compare(c.Name, c.Expected, actual)
+	if result.Parse != nil {
+		report.ParseStatus = result.Parse.Status
+	}
+	return report
+}
+
+func printDiffs(report ocrEval.EngineReport) {
+	for _, image := range report.Images {
+		if image.Error != "" {
+			fmt.Printf("  ❌ %s: %s\n", image.Name, image.Error)
+			continue
+		}
+		if len(image.Missed) == 0 && len(image.Extra) == 0 && len(image.Diffs) == 0 {
+			fmt.Printf("  ✅ %s: предложений %d\n", image.Name, image.Expected)
+			continue
+		}
+		fmt.Printf("  ⚠️ %s: ожидалось %d, распознано %d (разбор: %s)\n", image.Name, image.Expected, image.Actual, image.ParseStatus)
+		for _, row := range image.Missed {
+			fmt.Printf("      - пропущено предложение %d\n", row)
+		}
+		for _, row := range image.Extra {
+			fmt.Printf("      + лишнее предложение %d\n", row)
+		}
+		for _, diff := range image.Diffs {
+			fmt.Printf("      %d.%s: %q -> %q\n", diff.Row, diff.Field, diff.Expected, diff.Actual)
+		}
+	}
+}
+
+// printSummary печатает точность, полноту и CER по полям для всех движков рядом
+func printSummary(reports []ocrEval.EngineReport) {
+	fmt.Printf("\n📊 Итог\n")
+	fmt.Printf("%-12s", "поле")
+	for _, report := range reports {
+		fmt.Printf(" | %-27s", report.Engine)
+	}
+	fmt.Printf("\n%-12s", "")
+	for range reports {
+		fmt.Printf(" | %9s %8s %8s", "precision", "recall", "CER")
+	}
+	fmt.Println()
+
+	for _, field := range ocrEval.Fields {
+		fmt.Printf("%-12s", field)
+		for _, report := range reports {
+			stats := report.Fields[field]
+			fmt.Printf(" | %9.3f %8.3f %8.3f", stats.Precision(), stats.Recall(), stats.CER())
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("%-12s", "строки")
+	for _, report := range reports {
+		fmt.Printf(" | %-27s", fmt.Sprintf("пропущено %d, лишних %d", report.Missed, report.Extra))
+	}
+	fmt.Printf("\n%-12s", "ошибки OCR")
+	for _, report := range reports {
+		fmt.Printf(" | %-27d", report.Failures)
+	}
+	fmt.Println()
+}
@@ -1,64 +1,341 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"image"
+	_ "image/png"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"shnyr/internal/config"
+	"shnyr/internal/model"
+	"shnyr/internal/ocr"
+	ocrEval "shnyr/internal/ocr_eval"
+	"sort"
+	"strings"
+	"sync"
+
+	_ "github.com/go-sql-driver/mysql"
 )
 
+// Распознает скриншоты и выводит структурированный результат по каждому файлу строкой JSON (JSONL):
+//
+//	go run ./cmd/ocr_runner ./imgs/screenshot1.png ./imgs/screenshot2.png
+//	go run ./cmd/ocr_runner -workers 4 -out results.jsonl ./imgs 'archive/*.png'
+//	go run ./cmd/ocr_runner -compare -dsn ... ./imgs   - сравнить с сохраненным в ocr_results
+//
+// Аргументы - файлы, каталоги (все *.png внутри) и шаблоны. Ход работы и расхождения печатаются в stderr,
+// поэтому stdout без -out можно сразу передать в jq.
 func main() {
-	// 1. Проверяем, передан ли хотя бы один путь к файлу.
-	if len(os.Args) < 2 {
-		log.Fatalf("Пожалуйста, укажите один или несколько путей к файлам скриншотов. Пример: go run ./cmd/ocr_runner/main.go ./imgs/screenshot1.png ./imgs/screenshot2.png")
-	}
+	// Движок выбирается так же, как в секции ocr файла config.yaml
+	var cfg config.OCR
+	flag.StringVar(&cfg.Engine, "engine", ocr.EngineCppOCR, "Движок OCR: cpp_ocr, tesseract, http, glyph или stub")
+	flag.StringVar(&cfg.CppOCRPath, "cpp-ocr-path", "", "Путь к cpp_ocr.exe")
+	flag.StringVar(&cfg.TesseractPath, "tesseract-path", "", "Путь к tesseract")
+	flag.StringVar(&cfg.TesseractLang, "tesseract-lang", "", "Языки tesseract")
+	flag.StringVar(&cfg.HTTPURL, "url", "", "Адрес HTTP-сервиса OCR")
+	flag.StringVar(&cfg.StubDir, "stub-dir", "", "Каталог с заготовленными ответами для stub")
+	flag.StringVar(&cfg.GlyphSet, "glyph-set", "", "Набор глифов для glyph")
+	configPath := flag.String("config", "", "config.yaml: настройки движков и построчного распознавания (ocr.rows) вместо флагов")
+	workers := flag.Int("workers", 2, "Сколько файлов распознается одновременно")
+	outPath := flag.String("out", "", "Файл JSONL с результатами (по умолчанию stdout)")
+	compare := flag.Bool("compare", false, "Сравнить предложения с сохраненными в ocr_results для того же image_path")
+	dsn := flag.String("dsn", os.Getenv("SHNYR_DSN"), "Строка подключения к MySQL для -compare (по умолчанию SHNYR_DSN или из -config)")
+	debugMode := flag.Bool("debug", false, "Печатать отладочную информацию движка в stderr")
+	flag.Parse()
 
-	var screenshotFiles []string
-	debugMode := false
-	for _, arg := range os.Args[1:] {
+	var args []string
+	for _, arg := range flag.Args() {
+		// Прежний способ включить отладку
 		if arg == "debug=1" {
-			debugMode = true
-		} else {
-			screenshotFiles = append(screenshotFiles, arg)
+			*debugMode = true
+			continue
 		}
+		args = append(args, arg)
+	}
+	if len(args) < 1 {
+		log.Fatalf("Укажите файлы, каталоги или шаблоны скриншотов. Пример: go run ./cmd/ocr_runner -out results.jsonl ./imgs")
+	}
+	if *workers < 1 {
+		log.Fatalf("-workers должен быть больше 0")
 	}
 
-	if debugMode {
-		fmt.Println("Debug mode enabled")
+	var fullCfg config.Config
+	if *configPath != "" {
+		config.SetConfigFile(*configPath)
+		var err error
+		if err, fullCfg = config.InitConfig(); err != nil {
+			log.Fatalf("Ошибка чтения конфигурации: %v", err)
+		}
+		if *dsn == "" {
+			*dsn = fullCfg.DSN
+		}
+	} else {
+		fullCfg.OCR = cfg
 	}
-	// 2. Путь к исполняемому файлу OCR.
-	ocrExecutable := `C:\Users\karpo\cpp_ocr\build\Release\cpp_ocr.exe`
 
-	fmt.Printf("Запускаю OCR для %d файлов...\n", len(screenshotFiles))
+	files, err := expandInputs(args)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if len(files) == 0 {
+		log.Fatalf("Не найдено ни одного файла")
+	}
 
-	// 3. Проходим по каждому переданному файлу и запускаем для него OCR.
-	for _, fileArg := range screenshotFiles {
-		// Формируем полный путь к файлу скриншота.
-		screenshotPath, err := filepath.Abs(fileArg)
+	var db *sql.DB
+	if *compare {
+		if *dsn == "" {
+			log.Fatalf("Для -compare укажите -dsn или SHNYR_DSN")
+		}
+		db, err = sql.Open("mysql", *dsn)
 		if err != nil {
-			log.Printf("Не удалось получить абсолютный путь для '%s': %v", fileArg, err)
-			continue
+			log.Fatalf("Ошибка подключения к базе: %v", err)
 		}
+		defer db.Close()
+	}
 
-		fmt.Printf("\n--- Обработка файла: %s ---\n", fileArg)
+	engine, err := ocr.NewEngine(fullCfg.OCR)
+	if err != nil {
+		log.Fatalf("Ошибка инициализации OCR: %v", err)
+	}
+	manager := ocr.NewOCRManagerWithEngine(&fullCfg, engine)
 
-		// Создаем команду для выполнения.
-		cmd := exec.Command(ocrExecutable, screenshotPath)
-		if debugMode {
-			fmt.Printf("Executing command: %s\n", cmd.String())
-		}
-		// Выполняем команду и получаем ее вывод.
-		output, err := cmd.CombinedOutput()
+	var out io.Writer = os.Stdout
+	if *outPath != "" {
+		file, err := os.Create(*outPath)
 		if err != nil {
-			log.Printf("Ошибка при выполнении OCR для '%s': %v", fileArg, err)
-			log.Printf("Вывод команды: %s", string(output))
+			log.Fatalf("Ошибка создания %s: %v", *outPath, err)
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+
+	fmt.Fprintf(os.Stderr, "Запускаю OCR (%s) для %d файлов, одновременно %d...\n", engine.Name(), len(files), *workers)
+
+	// Файлы распознаются параллельно, а записываются в порядке аргументов
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var failed, mismatched int
+	records := make([]*Record, len(files))
+	next := 0
+	slots := make(chan struct{}, *workers)
+	for i, file := range files {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, file string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			record := recognize(manager, file)
+			if db != nil && record.Error == "" {
+				record.Compare = compareStored(db, file, record.Result)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			records[i] = &record
+			for ; next < len(records) && records[next] != nil; next++ {
+				record := records[next]
+				if err := encoder.Encode(record); err != nil {
+					log.Fatalf("Ошибка записи результата: %v", err)
+				}
+				if record.Error != "" {
+					failed++
+				}
+				if *debugMode && record.debug != "" {
+					fmt.Fprintf(os.Stderr, "--- %s ---\nDebug:\n%s\n", record.File, record.debug)
+				}
+				if printReport(*record) {
+					mismatched++
+				}
+				records[next] = nil
+			}
+		}(i, file)
+	}
+	wg.Wait()
+
+	fmt.Fprintf(os.Stderr, "\nОбработка завершена: файлов %d, ошибок %d", len(files), failed)
+	if *compare {
+		fmt.Fprintf(os.Stderr, ", расхождений с базой %d", mismatched)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// Record - строка JSONL с результатом одного файла
+type Record struct {
+	File        string           `json:"file"`
+	Engine      string           `json:"engine"`
+	Error       string           `json:"error,omitempty"`
+	ParseStatus string           `json:"parse_status,omitempty"`
+	Warnings    []ocr.ParseIssue `json:"warnings,omitempty"`
+	Errors      []ocr.ParseIssue `json:"errors,omitempty"`
+	Result      *model.OCRResult `json:"result,omitempty"`
+	Compare     *StoredCompare   `json:"compare,omitempty"`
+
+	debug string
+}
+
+// StoredCompare - сравнение с результатом, сохраненным в ocr_results для того же image_path
+type StoredCompare struct {
+	OCRResultID int                  `json:"ocr_result_id,omitempty"`
+	Error       string               `json:"error,omitempty"` // результат не найден или не разбирается
+	Report      *ocrEval.ImageReport `json:"report,omitempty"`
+}
+
+// expandInputs раскрывает аргументы в список файлов: каталог - все *.png в нем, шаблон - совпавшие файлы
+func expandInputs(args []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("неверный шаблон %q: %v", arg, err)
+			}
+			if len(matches) == 0 {
+				fmt.Fprintf(os.Stderr, "⚠️ %s: нет совпадений\n", arg)
+			}
+			sort.Strings(matches)
+			for _, match := range matches {
+				add(match)
+			}
 			continue
 		}
 
-		// Печатаем результат.
-		fmt.Printf("Результат:\n%s\n", string(output))
+		// Недоступный файл попадает в результаты с ошибкой и не останавливает остальные
+		info, err := os.Stat(arg)
+		if err != nil || !info.IsDir() {
+			add(arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.png"))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения каталога %s: %v", arg, err)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			add(match)
+		}
+	}
+	return files, nil
+}
+
+// recognize распознает файл так же, как конвейер бота (ProcessOffers)
+func recognize(manager *ocr.OCRManager, file string) Record {
+	record := Record{File: file, Engine: manager.Engine().Name()}
+	path, err := filepath.Abs(file)
+	if err != nil {
+		record.Error = err.Error()
+		return record
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		record.Error = err.Error()
+		return record
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		record.Error = fmt.Sprintf("ошибка декодирования изображения: %v", err)
+		return record
+	}
+
+	result, err := manager.ProcessOffers(img, path)
+	if err != nil {
+		record.Error = err.Error()
+		return record
+	}
+	record.Result = result.Parsed
+	record.debug = result.Debug
+	if result.Parse != nil {
+		record.ParseStatus = result.Parse.Status
+		record.Warnings = result.Parse.Warnings
+		record.Errors = result.Parse.Errors
+	}
+	return record
+}
+
+// compareStored сравнивает распознанные предложения с последним сохраненным результатом того же файла.
+// image_path в базе записан так, как его передал бот, поэтому ищется по пути, абсолютному пути и имени файла.
+func compareStored(db *sql.DB, file string, result *model.OCRResult) *StoredCompare {
+	abs, _ := filepath.Abs(file)
+	base := filepath.Base(file)
+	var id int
+	var jsonData sql.NullString
+	err := db.QueryRow(`SELECT id, json_data FROM ocr_results
+		WHERE image_path IN (?, ?, ?) OR image_path LIKE ? OR image_path LIKE ?
+		ORDER BY id DESC LIMIT 1`, file, abs, base, "%/"+base, "%\\\\"+base).Scan(&id, &jsonData)
+	if err == sql.ErrNoRows {
+		return &StoredCompare{Error: "результат для файла не найден в ocr_results"}
+	}
+	if err != nil {
+		return &StoredCompare{Error: fmt.Sprintf("ошибка чтения ocr_results: %v", err)}
+	}
+
+	stored, err := ocrEval.ParseExpected([]byte(jsonData.String))
+	if err != nil {
+		return &StoredCompare{OCRResultID: id, Error: fmt.Sprintf("сохраненный JSON не разбирается: %v", err)}
+	}
+	var actual []model.OCRItem
+	if result != nil {
+		actual = result.TextRecognition.StructuredData
+	}
+	report := ocrEval.Compare(base, stored, actual)
+	return &StoredCompare{OCRResultID: id, Report: &report}
+}
+
+// printReport печатает итог файла в stderr; возвращает true, если есть расхождения с базой
+func printReport(record Record) bool {
+	if record.Error != "" {
+		fmt.Fprintf(os.Stderr, "❌ %s: %s\n", record.File, record.Error)
+		return false
+	}
+	offers := 0
+	if record.Result != nil {
+		offers = len(record.Result.TextRecognition.StructuredData)
+	}
+	fmt.Fprintf(os.Stderr, "✅ %s: предложений %d, разбор: %s\n", record.File, offers, record.ParseStatus)
+	for _, issue := range record.Errors {
+		fmt.Fprintf(os.Stderr, "  ❌ %s\n", issue)
+	}
+	for _, issue := range record.Warnings {
+		fmt.Fprintf(os.Stderr, "  ⚠️ %s\n", issue)
 	}
 
-	fmt.Println("\nОбработка завершена.")
+	if record.Compare == nil {
+		return false
+	}
+	if record.Compare.Error != "" {
+		fmt.Fprintf(os.Stderr, "  ⚠️ сравнение: %s\n", record.Compare.Error)
+		return false
+	}
+	report := record.Compare.Report
+	if len(report.Missed) == 0 && len(report.Extra) == 0 && len(report.Diffs) == 0 {
+		fmt.Fprintf(os.Stderr, "  🟰 совпадает с ocr_results %d\n", record.Compare.OCRResultID)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "  ≠ ocr_results %d: в базе %d, распознано %d\n", record.Compare.OCRResultID, report.Expected, report.Actual)
+	for _, row := range report.Missed {
+		fmt.Fprintf(os.Stderr, "      - нет предложения %d из базы\n", row)
+	}
+	for _, row := range report.Extra {
+		fmt.Fprintf(os.Stderr, "      + новое предложение %d\n", row)
+	}
+	for _, diff := range report.Diffs {
+		fmt.Fprintf(os.Stderr, "      %d.%s: %q -> %q\n", diff.Row, diff.Field, diff.Expected, diff.Actual)
+	}
+	return true
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Коды завершения программы
+const (
+	exitOK          = 0 // программа завершена штатно, автозапущенный скрипт выполнен
+	exitError       = 1 // ошибка инициализации или выполнения скрипта
+	exitUsage       = 2 // неверные флаги или переменные окружения
+	exitInterrupted = 3 // автозапущенный скрипт прерван
+)
+
+// options - параметры запуска. Каждый флаг можно задать переменной окружения SHNYR_*, флаг имеет приоритет.
+type options struct {
+	configPath  string // -config, SHNYR_CONFIG
+	dsn         string // -dsn, SHNYR_DSN
+	script      string // -script, SHNYR_SCRIPT: скрипт для автозапуска; после него программа завершается
+	startButton int    // -start, SHNYR_START_BUTTON
+	startItem   int    // -item, SHNYR_START_ITEM
+	dryRun      bool   // -dry-run, SHNYR_DRY_RUN: проверить конфигурацию и БД, ничего не запуская
+	logFormat   string // -log-format, SHNYR_LOG_FORMAT
+	interactive bool   // -interactive: запросить стартовую позицию в консоли
+
+	// Заданы ли стартовая кнопка и предмет явно (флагом или окружением)
+	startButtonSet bool
+	startItemSet   bool
+}
+
+// parseOptions разбирает флаги командной строки args, значения по умолчанию берутся из окружения
+func parseOptions(args []string) (options, error) {
+	var opts options
+	fs := flag.NewFlagSet("shnyr", flag.ContinueOnError)
+
+	startButton, startButtonSet, err := envInt("SHNYR_START_BUTTON", 1)
+	if err != nil {
+		return opts, err
+	}
+	startItem, startItemSet, err := envInt("SHNYR_START_ITEM", 1)
+	if err != nil {
+		return opts, err
+	}
+	dryRun, err := envBool("SHNYR_DRY_RUN")
+	if err != nil {
+		return opts, err
+	}
+
+	fs.StringVar(&opts.configPath, "config", os.Getenv("SHNYR_CONFIG"), "Путь к файлу конфигурации (по умолчанию config.yaml в текущей директории)")
+	fs.StringVar(&opts.dsn, "dsn", os.Getenv("SHNYR_DSN"), "Строка подключения к MySQL (по умолчанию из config.yaml)")
+	fs.StringVar(&opts.script, "script", os.Getenv("SHNYR_SCRIPT"), "Скрипт для автозапуска: cycle_all_items или cycle_listed_items")
+	fs.IntVar(&opts.startButton, "start", startButton, "Начальная кнопка (1-6)")
+	fs.IntVar(&opts.startItem, "item", startItem, "Начальный предмет (1 для начала с первого)")
+	fs.BoolVar(&opts.dryRun, "dry-run", dryRun, "Проверить конфигурацию и подключение к БД и завершиться")
+	fs.StringVar(&opts.logFormat, "log-format", os.Getenv("SHNYR_LOG_FORMAT"), "Формат лога: text или json")
+	fs.BoolVar(&opts.interactive, "interactive", false, "Запросить начальную кнопку и предмет в консоли, если они не заданы")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "start":
+			startButtonSet = true
+		case "item":
+			startItemSet = true
+		}
+	})
+	opts.startButtonSet = startButtonSet
+	opts.startItemSet = startItemSet
+
+	if opts.startButton < 1 || opts.startButton > 6 {
+		return opts, fmt.Errorf("начальная кнопка должна быть в диапазоне 1-6")
+	}
+	if opts.startItem < 1 {
+		return opts, fmt.Errorf("номер предмета должен быть 1 или больше")
+	}
+	if opts.script != "" {
+		if _, ok := scripts[opts.script]; !ok {
+			return opts, fmt.Errorf("неизвестный скрипт: %s", opts.script)
+		}
+	}
+	return opts, nil
+}
+
+// envInt читает целое число из переменной окружения name. Возвращает, была ли переменная задана.
+func envInt(name string, def int) (int, bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, false, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def, false, fmt.Errorf("неверное значение %s=%q: %v", name, value, err)
+	}
+	return n, true, nil
+}
+
+// envBool читает логическое значение из переменной окружения name
+func envBool(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("неверное значение %s=%q: %v", name, value, err)
+	}
+	return b, nil
+}
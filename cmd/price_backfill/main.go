@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"shnyr/internal/migrations"
+	"shnyr/internal/price"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// Заполняет structured_items.price_value для строк, сохраненных до появления колонки:
+//
+//	go run ./cmd/price_backfill -dsn ...            - строки с пустой price_value
+//	go run ./cmd/price_backfill -dsn ... -all       - пересчитать все строки
+//	go run ./cmd/price_backfill -dsn ... -dry-run   - только показать, что будет записано
+func main() {
+	dsn := flag.String("dsn", os.Getenv("SHNYR_DSN"), "Строка подключения к MySQL (по умолчанию SHNYR_DSN)")
+	batchSize := flag.Int("batch", 1000, "Строк за один запрос")
+	all := flag.Bool("all", false, "Пересчитать price_value всех строк, а не только пустых")
+	dryRun := flag.Bool("dry-run", false, "Не записывать изменения в базу")
+	flag.Parse()
+
+	if *dsn == "" {
+		log.Fatalf("Укажите -dsn или SHNYR_DSN")
+	}
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		log.Fatalf("Ошибка подключения к базе: %v", err)
+	}
+	defer db.Close()
+
+	// Колонку price_value добавляют миграции
+	if err := migrations.Check(db); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	condition := "price_value IS NULL AND "
+	if *all {
+		condition = ""
+	}
+	query := "SELECT id, price FROM structured_items WHERE " + condition + "id > ? ORDER BY id LIMIT ?"
+
+	var updated, unchanged int
+	failed := make(map[price.ErrorKind]int)
+	lastID := 0
+	for {
+		rows, err := db.Query(query, lastID, *batchSize)
+		if err != nil {
+			log.Fatalf("Ошибка чтения structured_items: %v", err)
+		}
+
+		type row struct {
+			id    int
+			price string
+		}
+		var batch []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.price); err != nil {
+				log.Fatalf("Ошибка чтения строки: %v", err)
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if len(batch) == 0 {
+			break
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			log.Fatalf("Ошибка начала транзакции: %v", err)
+		}
+		for _, r := range batch {
+			lastID = r.id
+			value, err := price.Parse(r.price)
+			if err != nil {
+				var priceErr *price.Error
+				if errors.As(err, &priceErr) {
+					failed[priceErr.Kind]++
+				}
+				if *all && !*dryRun {
+					// Цена, которая больше не разбирается, не должна сохранять старое значение
+					if _, err := tx.Exec("UPDATE structured_items SET price_value = NULL WHERE id = ?", r.id); err != nil {
+						tx.Rollback()
+						log.Fatalf("Ошибка обновления строки %d: %v", r.id, err)
+					}
+				}
+				continue
+			}
+
+			if *dryRun {
+				fmt.Printf("%d: %q -> %d\n", r.id, r.price, value)
+				updated++
+				continue
+			}
+			result, err := tx.Exec("UPDATE structured_items SET price_value = ? WHERE id = ?", value, r.id)
+			if err != nil {
+				tx.Rollback()
+				log.Fatalf("Ошибка обновления строки %d: %v", r.id, err)
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				unchanged++
+				continue
+			}
+			updated++
+		}
+		if err := tx.Commit(); err != nil {
+			log.Fatalf("Ошибка подтверждения транзакции: %v", err)
+		}
+		fmt.Printf("… обработано до id %d\n", lastID)
+	}
+
+	fmt.Printf("\n✅ Записано: %d, без изменений: %d\n", updated, unchanged)
+	for kind, count := range failed {
+		fmt.Printf("⚠️ Не разобрано (%s): %d\n", kind, count)
+	}
+}
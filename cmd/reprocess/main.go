@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/png"
+	"log"
+	"os"
+	"shnyr/internal/config"
+	"shnyr/internal/corrections"
+	"shnyr/internal/database"
+	"shnyr/internal/logger"
+	"shnyr/internal/migrations"
+	"shnyr/internal/ocr"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// Повторно распознает сохраненные в ocr_results изображения (image_data) текущим движком OCR
+// и записывает результат новой версией обработки; прежний вывод остается в ocr_result_versions:
+//
+//	go run ./cmd/reprocess -from 2025-01-01 -parse-status errors,invalid
+//	go run ./cmd/reprocess -category "Оружие" -engine glyph -workers 4
+//	go run ./cmd/reprocess -resume                  - продолжить прерванный запуск
+//	go run ./cmd/reprocess -from 2025-01-01 -dry-run - только показать, что будет обработано
+func main() {
+	configPath := flag.String("config", os.Getenv("SHNYR_CONFIG"), "Путь к файлу конфигурации (по умолчанию config.yaml в текущей директории)")
+	dsn := flag.String("dsn", os.Getenv("SHNYR_DSN"), "Строка подключения к MySQL (по умолчанию SHNYR_DSN или из config.yaml)")
+	engineName := flag.String("engine", "", "Движок OCR (по умолчанию ocr.engine из конфига)")
+	from := flag.String("from", "", "Результаты, сохраненные не раньше даты 2006-01-02")
+	to := flag.String("to", "", "Результаты, сохраненные раньше даты 2006-01-02")
+	item := flag.String("item", "", "Только результаты предмета (искомого или сопоставленного)")
+	category := flag.String("category", "", "Только результаты категории")
+	parseStatus := flag.String("parse-status", "", "Статусы разбора через запятую: ok, warnings, errors, invalid, none (сохранены до появления статуса)")
+	resume := flag.Bool("resume", false, "Продолжить последний незавершенный запуск с его отбором и версией")
+	batchSize := flag.Int("batch", 50, "Результатов за один запрос")
+	workers := flag.Int("workers", 2, "Сколько изображений распознается одновременно")
+	limit := flag.Int("limit", 0, "Обработать не больше стольких результатов (0 - без ограничения)")
+	dryRun := flag.Bool("dry-run", false, "Только показать отобранные результаты, ничего не распознавая")
+	flag.Parse()
+
+	if *workers < 1 || *batchSize < 1 {
+		log.Fatalf("-workers и -batch должны быть больше 0")
+	}
+	filter := database.ReprocessFilter{From: *from, To: *to, Item: *item, Category: *category}
+	for _, date := range []string{filter.From, filter.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			log.Fatalf("Неверная дата %q: ожидается 2006-01-02", date)
+		}
+	}
+	if *parseStatus != "" {
+		for _, status := range strings.Split(*parseStatus, ",") {
+			status = strings.TrimSpace(status)
+			switch status {
+			case ocr.ParseOK, ocr.ParseWarnings, ocr.ParseErrors, ocr.ParseInvalid, "none":
+				filter.ParseStatuses = append(filter.ParseStatuses, status)
+			default:
+				log.Fatalf("Неизвестный статус разбора %q", status)
+			}
+		}
+	}
+
+	config.SetConfigFile(*configPath)
+	err, cfg := config.InitConfig()
+	if err != nil {
+		log.Fatalf("Ошибка чтения конфигурации: %v", err)
+	}
+	if *dsn == "" {
+		*dsn = cfg.DSN
+	}
+	if *dsn == "" {
+		log.Fatalf("Укажите -dsn, SHNYR_DSN или dsn в config.yaml")
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		log.Fatalf("Ошибка подключения к базе: %v", err)
+	}
+	defer db.Close()
+	if err := migrations.Check(db); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	loggerManager, err := logger.NewLoggerManager("reprocess.log")
+	if err != nil {
+		log.Fatalf("Ошибка инициализации логгера: %v", err)
+	}
+	dbManager := database.NewDatabaseManager(db, loggerManager)
+
+	var run *database.ReprocessRun
+	if *resume {
+		run, err = dbManager.ResumeReprocessRun()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if run == nil {
+			log.Fatalf("Незавершенных запусков нет")
+		}
+		// Продолженный запуск распознает тем же движком, что и начатый
+		cfg.OCR.Engine = run.Engine
+	} else if *engineName != "" {
+		cfg.OCR.Engine = *engineName
+	}
+
+	ocrManager, err := ocr.NewOCRManager(&cfg)
+	if err != nil {
+		log.Fatalf("Ошибка инициализации OCR: %v", err)
+	}
+	if substitutions, err := corrections.Substitutions(db, corrections.DefaultMinRepeats); err != nil {
+		loggerManager.LogError(err, "Ошибка загрузки словаря исправлений")
+	} else {
+		ocrManager.SetNormalizer(ocr.NewNormalizer(substitutions))
+	}
+
+	if *dryRun {
+		preview(dbManager, run, filter, *batchSize, *limit)
+		return
+	}
+
+	if run == nil {
+		run, err = dbManager.StartReprocessRun(ocrManager.Engine().Name(), filter)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Printf("🔁 Запуск %d: версия обработки %d, движок %s\n", run.ID, run.Version, run.Engine)
+	} else {
+		fmt.Printf("🔁 Продолжаем запуск %d: версия обработки %d, движок %s, с id %d (обработано %d, ошибок %d)\n",
+			run.ID, run.Version, run.Engine, run.LastID, run.Processed, run.Failed)
+	}
+
+	processed, failed, skipped := 0, 0, 0
+	for *limit == 0 || processed+failed+skipped < *limit {
+		size := *batchSize
+		if *limit > 0 {
+			size = min(size, *limit-processed-failed-skipped)
+		}
+		candidates, err := dbManager.ReprocessCandidates(run, run.LastID, size)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if len(candidates) == 0 {
+			break
+		}
+
+		// Результат без раздела сканирования (сохранен до ocr_results.category и без предложений) пропускается:
+		// новые предложения нельзя было бы отнести к категории
+		var known []database.ReprocessCandidate
+		for _, c := range candidates {
+			if c.Category == "" {
+				fmt.Printf("  ⏭️ %d: неизвестен раздел сканирования, пропущен\n", c.ID)
+				skipped++
+				continue
+			}
+			known = append(known, c)
+		}
+
+		ok, errs := reprocessBatch(ocrManager, dbManager, loggerManager, run, known, *workers)
+		processed += ok
+		failed += errs
+		run.Processed += ok
+		run.Failed += errs
+		run.LastID = candidates[len(candidates)-1].ID
+		if err := dbManager.SaveReprocessProgress(run); err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Printf("… обработано до id %d: успешно %d, ошибок %d\n", run.LastID, run.Processed, run.Failed)
+	}
+
+	// Запуск, остановленный по -limit, остается незавершенным и продолжается через -resume
+	if *limit > 0 && processed+failed+skipped >= *limit {
+		fmt.Printf("\n⏸️ Достигнут лимит %d, продолжить: go run ./cmd/reprocess -resume\n", *limit)
+		return
+	}
+	if err := dbManager.FinishReprocessRun(run); err != nil {
+		log.Fatalf("%v", err)
+	}
+	fmt.Printf("\n✅ Запуск %d завершен: версия %d, успешно %d, ошибок %d\n", run.ID, run.Version, run.Processed, run.Failed)
+	if skipped > 0 {
+		fmt.Printf("⏭️ Пропущено без раздела сканирования: %d, они остались в прежней версии\n", skipped)
+	}
+	if run.Failed > 0 {
+		fmt.Printf("⚠️ Результаты с ошибками остались в прежней версии и попадут в следующий запуск\n")
+	}
+}
+
+// reprocessBatch распознает результаты пачки не более чем workers изображениями одновременно
+func reprocessBatch(ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, loggerManager *logger.LoggerManager, run *database.ReprocessRun, candidates []database.ReprocessCandidate, workers int) (int, int) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	processed, failed := 0, 0
+	slots := make(chan struct{}, workers)
+	for _, candidate := range candidates {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(c database.ReprocessCandidate) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			err := reprocess(ocrManager, dbManager, run, c)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				loggerManager.LogError(err, fmt.Sprintf("Ошибка повторной обработки результата %d", c.ID))
+				fmt.Printf("  ❌ %d: %v\n", c.ID, err)
+				failed++
+				return
+			}
+			processed++
+		}(candidate)
+	}
+	wg.Wait()
+	return processed, failed
+}
+
+// reprocess распознает изображение результата так же, как конвейер бота, и сохраняет новую версию
+func reprocess(ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, run *database.ReprocessRun, c database.ReprocessCandidate) error {
+	img, _, err := image.Decode(bytes.NewReader(c.ImageData))
+	if err != nil {
+		return fmt.Errorf("ошибка декодирования изображения: %v", err)
+	}
+
+	// Внешние движки читают изображение из файла; исходный путь мог уже не существовать
+	file, err := os.CreateTemp("", fmt.Sprintf("reprocess_%d_*.png", c.ID))
+	if err != nil {
+		return fmt.Errorf("ошибка создания временного файла: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(c.ImageData)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("ошибка записи временного файла: %v", err)
+	}
+
+	result, err := ocrManager.ProcessOffers(img, file.Name())
+	if err != nil {
+		return err
+	}
+
+	var parse database.ParseReport
+	if result.Parse != nil {
+		parse = database.ParseReport{Status: result.Parse.Status, Issues: result.Parse.IssuesJSON()}
+	}
+	return dbManager.SaveReprocessedResult(run, c, result.Output, result.Debug, result.JSON, result.RawText, parse)
+}
+
+// preview печатает результаты, которые обработал бы запуск, без распознавания
+func preview(dbManager *database.DatabaseManager, run *database.ReprocessRun, filter database.ReprocessFilter, batchSize, limit int) {
+	if run == nil {
+		// Версия выше любой сохраненной отбирает все результаты по фильтру
+		run = &database.ReprocessRun{Version: int(^uint32(0) >> 1), Filter: filter}
+	}
+	total, skipped := 0, 0
+	lastID := run.LastID
+	for limit == 0 || total < limit {
+		candidates, err := dbManager.ReprocessCandidates(run, lastID, batchSize)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		for _, c := range candidates {
+			if limit > 0 && total >= limit {
+				break
+			}
+			if c.Category == "" {
+				fmt.Printf("%d\t%s\t-\t%s\t(будет пропущен: неизвестен раздел сканирования)\n", c.ID, c.CreatedAt.Format("2006-01-02 15:04"), c.ImagePath)
+				skipped++
+			} else {
+				fmt.Printf("%d\t%s\t%s\t%s\n", c.ID, c.CreatedAt.Format("2006-01-02 15:04"), c.Category, c.ImagePath)
+			}
+			total++
+		}
+		lastID = candidates[len(candidates)-1].ID
+	}
+	fmt.Printf("\n🔍 Будет обработано результатов: %d, из них пропущено без раздела сканирования: %d\n", total-skipped, skipped)
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"shnyr/internal/click_manager"
+	"shnyr/internal/commands"
+	"shnyr/internal/config"
+	"shnyr/internal/corrections"
+	"shnyr/internal/database"
+	imageInternal "shnyr/internal/image"
+	"shnyr/internal/interrupt"
+	"shnyr/internal/lifecycle"
+	"shnyr/internal/logger"
+	"shnyr/internal/model"
+	"shnyr/internal/ocr"
+	"shnyr/internal/scheduler"
+	"shnyr/internal/screenshot"
+	"sync"
+
+	cycleAllItems "shnyr/internal/scripts/cycle_all_items"
+	cycleListedItems "shnyr/internal/scripts/cycle_listed_items"
+)
+
+// scriptFunc - общая сигнатура запуска скриптов. Прерывание пользователем не считается ошибкой.
+type scriptFunc func(c *config.Config, screenshotManager *screenshot.ScreenshotManager, dbManager *database.DatabaseManager, ocrManager *ocr.OCRManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager) error
+
+// scripts содержит все скрипты, которые можно запустить
+var scripts = map[string]scriptFunc{
+	"cycle_all_items":    cycleAllItems.Run,
+	"cycle_listed_items": cycleListedItems.Run,
+}
+
+// scriptRunner запускает скрипты и переводит машину состояний при старте и завершении
+type scriptRunner struct {
+	c                 *config.Config
+	db                *sql.DB
+	machine           *lifecycle.Machine
+	screenshotManager *screenshot.ScreenshotManager
+	dbManager         *database.DatabaseManager
+	ocrManager        *ocr.OCRManager
+	normalizer        *ocr.Normalizer
+	clickManager      *click_manager.ClickManager
+	loggerManager     *logger.LoggerManager
+	interruptManager  *interrupt.InterruptManager
+	queue             *commands.Queue
+
+	mu               sync.Mutex
+	busy             bool       // выполняется скрипт или перезапуск
+	lastScript       string     // последний запущенный скрипт, его повторяет restart
+	lastScriptFunc   scriptFunc // с теми же параметрами, например категориями из расписания
+	restartRequested bool
+}
+
+// acquire занимает раннер; возвращает false, если он уже занят скриптом или перезапуском
+func (r *scriptRunner) acquire() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.busy {
+		return false
+	}
+	r.busy = true
+	return true
+}
+
+// release освобождает раннер
+func (r *scriptRunner) release() {
+	r.mu.Lock()
+	r.busy = false
+	r.mu.Unlock()
+}
+
+// isBusy сообщает, выполняется ли скрипт или перезапуск
+func (r *scriptRunner) isBusy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.busy
+}
+
+// run синхронно выполняет скрипт scriptType, а при запрошенном перезапуске - повторяет его.
+// Возвращает ошибку, если скрипт неизвестен, другой скрипт уже выполняется или перезапуск не удался.
+func (r *scriptRunner) run(scriptType string, reason string) error {
+	script, ok := scripts[scriptType]
+	if !ok {
+		return fmt.Errorf("неизвестный скрипт: %s", scriptType)
+	}
+	return r.runScript(scriptType, script, reason)
+}
+
+// runScheduled выполняет один проход cycle_listed_items по категориям из правила расписания.
+// Возвращает true, если запуск был прерван, и ошибку скрипта, если проход завершился ошибкой.
+func (r *scriptRunner) runScheduled(names []string, reason string) (bool, error) {
+	var categories []model.Category
+	for _, name := range names {
+		category, err := model.ParseCategory(name)
+		if err != nil {
+			return false, err
+		}
+		categories = append(categories, category)
+	}
+	script := func(c *config.Config, screenshotManager *screenshot.ScreenshotManager, dbManager *database.DatabaseManager, ocrManager *ocr.OCRManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager) error {
+		return cycleListedItems.RunCategories(categories, 1, c, screenshotManager, dbManager, ocrManager, clickManager, loggerManager, interruptManager)
+	}
+	err := r.runScript("cycle_listed_items", script, reason)
+	if err != nil {
+		return false, err
+	}
+	return r.interruptManager.IsInterrupted(), nil
+}
+
+// runScript выполняет script в состоянии scriptType, повторяя его при запрошенном перезапуске
+func (r *scriptRunner) runScript(scriptType string, script scriptFunc, reason string) error {
+	if !r.acquire() {
+		return scheduler.ErrBusy
+	}
+	defer r.release()
+
+	for {
+		err := r.runOnce(scriptType, script, reason)
+		if err != nil {
+			return err
+		}
+		if !r.takeRestartRequest() {
+			return nil
+		}
+
+		err = r.restart()
+		if err != nil {
+			return err
+		}
+		reason = "Перезапуск: запуск " + scriptType
+	}
+}
+
+// runOnce выполняет один запуск скрипта scriptType. Ошибка скрипта переводит машину состояний в error и возвращается.
+func (r *scriptRunner) runOnce(scriptType string, script scriptFunc, reason string) error {
+	state, err := lifecycle.ScriptState(scriptType)
+	if err != nil {
+		return err
+	}
+
+	// Переход в состояние скрипта проверяет, что другой скрипт не запущен
+	err = r.machine.Transition(state, reason)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.lastScript = scriptType
+	r.lastScriptFunc = script
+	r.mu.Unlock()
+	err = addAction(r.db, reason)
+	if err != nil {
+		r.loggerManager.LogError(err, "Error adding "+scriptType+" action")
+	}
+
+	// Сбрасываем флаг и сигнал прерывания, оставшиеся от предыдущего запуска
+	r.interruptManager.ResetInterrupt()
+	r.interruptManager.ResetPause()
+	r.interruptManager.SetScriptRunning(true)
+	defer r.interruptManager.SetScriptRunning(false)
+
+	var scriptErr error
+	defer func() {
+		// При завершении (нормальном, с ошибкой или прерывании) обновляем статус
+		var next lifecycle.State
+		var message string
+		if scriptErr != nil {
+			next, message = lifecycle.StateError, scriptType+" завершился ошибкой: "+scriptErr.Error()
+		} else if r.isRestartRequested() {
+			next, message = lifecycle.StateRestarting, "Перезапуск: "+scriptType+" остановлен"
+		} else if r.interruptManager.IsInterrupted() {
+			next, message = lifecycle.StateStopped, scriptType+" прерван"
+		} else {
+			next, message = lifecycle.StateReady, scriptType+" завершен"
+		}
+
+		err := r.machine.Transition(next, message)
+		if err != nil {
+			r.loggerManager.LogError(err, "Error updating status to "+string(next))
+		}
+		err = addAction(r.db, message)
+		if err != nil {
+			r.loggerManager.LogError(err, "Error adding completion action")
+		}
+	}()
+
+	r.refreshNormalizer()
+	scriptErr = script(r.c, r.screenshotManager, r.dbManager, r.ocrManager, r.clickManager, r.loggerManager, r.interruptManager)
+	return scriptErr
+}
+
+// refreshNormalizer перечитывает словарь замен OCR из повторяющихся исправлений веб-интерфейса,
+// чтобы новые исправления применялись со следующего запуска скрипта
+func (r *scriptRunner) refreshNormalizer() {
+	if r.normalizer == nil {
+		return
+	}
+	substitutions, err := corrections.Substitutions(r.db, corrections.DefaultMinRepeats)
+	if err != nil {
+		// Таблицы исправлений может еще не быть; распознавание работает и без словаря
+		r.loggerManager.Info("⚠️ Словарь замен OCR не обновлен: %v", err)
+		return
+	}
+	r.normalizer.SetSubstitutions(substitutions)
+	if n := r.normalizer.Len(); n > 0 {
+		r.loggerManager.Info("📖 Словарь замен OCR: %d", n)
+	}
+}
+
+// onPause переводит машину состояний при фактической постановке скрипта на паузу и снятии с нее
+func (r *scriptRunner) onPause(paused bool) {
+	if paused {
+		err := r.machine.Pause("Скрипт приостановлен")
+		if err != nil {
+			r.loggerManager.LogError(err, "Error updating status to paused")
+		}
+		return
+	}
+
+	err := r.machine.Resume("Скрипт возобновлен")
+	if err != nil {
+		r.loggerManager.LogError(err, "Error resuming status")
+	}
+	// Пока скрипт стоял на паузе, фокус могли увести с окна игры
+	r.clickManager.FocusL2Window()
+}
+
+// pollCommands забирает из очереди следующую команду и выполняет ее.
+// Пока скрипт выполняется, команда start остается в очереди до его завершения.
+func (r *scriptRunner) pollCommands() {
+	allowed := []string{commands.Stop, commands.Pause, commands.Resume, commands.Restart}
+	if !r.isBusy() {
+		allowed = append(allowed, commands.Start, commands.ScanItem)
+	}
+
+	cmd, err := r.queue.Claim(allowed...)
+	if err != nil {
+		r.loggerManager.LogError(err, "Ошибка получения команды из очереди")
+		return
+	}
+	if cmd == nil {
+		return
+	}
+	r.loggerManager.Info("📨 Получена команда '%s' (ID: %d)", cmd.Command, cmd.ID)
+
+	err = r.execute(cmd)
+	if err != nil {
+		r.loggerManager.LogError(err, "Ошибка обновления команды в очереди")
+	}
+}
+
+// execute выполняет забранную команду и записывает ее результат.
+// start и перезапуск без запущенного скрипта выполняются в отдельной горутине, чтобы не блокировать опрос очереди.
+func (r *scriptRunner) execute(cmd *commands.Command) error {
+	running := r.interruptManager.IsScriptRunning()
+
+	switch cmd.Command {
+	case commands.Start:
+		if err := r.queue.Start(cmd.ID); err != nil {
+			return err
+		}
+		go func() {
+			err := r.run("cycle_listed_items", fmt.Sprintf("Запуск cycle_listed_items (команда #%d)", cmd.ID))
+			r.finishScriptCommand(cmd, "cycle_listed_items", err)
+		}()
+		return nil
+
+	case commands.Restart:
+		if r.isBusy() {
+			r.requestRestart()
+			return r.queue.Succeed(cmd.ID, "Перезапуск запрошен, скрипт будет остановлен в безопасной точке")
+		}
+		if err := r.queue.Start(cmd.ID); err != nil {
+			return err
+		}
+		go func() {
+			err := r.restartIdle()
+			r.mu.Lock()
+			scriptType := r.lastScript
+			r.mu.Unlock()
+			r.finishScriptCommand(cmd, scriptType, err)
+		}()
+		return nil
+
+	case commands.ScanItem:
+		var args commands.ScanItemArgs
+		if err := json.Unmarshal([]byte(cmd.Args), &args); err != nil {
+			return r.queue.Fail(cmd.ID, fmt.Errorf("неверные аргументы команды: %v", err))
+		}
+		if _, err := model.ParseCategory(string(args.Category)); args.Item == "" || err != nil {
+			return r.queue.Fail(cmd.ID, fmt.Errorf("неверный предмет или категория: %s/%s", args.Item, args.Category))
+		}
+		if err := r.queue.Start(cmd.ID); err != nil {
+			return err
+		}
+		go func() {
+			script := func(c *config.Config, screenshotManager *screenshot.ScreenshotManager, dbManager *database.DatabaseManager, ocrManager *ocr.OCRManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager) error {
+				return cycleListedItems.ScanItem(args.Item, args.Category, c, screenshotManager, dbManager, ocrManager, clickManager, loggerManager, interruptManager)
+			}
+			err := r.runScript("cycle_listed_items", script, fmt.Sprintf("Сканирование %s по запросу (команда #%d)", args.Item, cmd.ID))
+			r.finishScriptCommand(cmd, "Сканирование "+args.Item, err)
+		}()
+		return nil
+
+	case commands.Stop:
+		if !running {
+			return r.queue.Cancel(cmd.ID, "скрипт не запущен")
+		}
+		r.interruptManager.Interrupt()
+		return r.queue.Succeed(cmd.ID, "Сигнал остановки отправлен")
+
+	case commands.Pause:
+		if !running {
+			return r.queue.Cancel(cmd.ID, "скрипт не запущен")
+		}
+		r.interruptManager.RequestPause()
+		return r.queue.Succeed(cmd.ID, "Пауза запрошена")
+
+	case commands.Resume:
+		if !running {
+			return r.queue.Cancel(cmd.ID, "скрипт не запущен")
+		}
+		r.interruptManager.RequestResume()
+		return r.queue.Succeed(cmd.ID, "Продолжение запрошено")
+	}
+
+	return r.queue.Fail(cmd.ID, fmt.Errorf("неизвестная команда: %s", cmd.Command))
+}
+
+// finishScriptCommand записывает результат команды, запустившей скрипт
+func (r *scriptRunner) finishScriptCommand(cmd *commands.Command, scriptType string, runErr error) {
+	var err error
+	switch {
+	case runErr != nil:
+		r.loggerManager.LogError(runErr, "Ошибка выполнения команды "+cmd.Command)
+		err = r.queue.Fail(cmd.ID, runErr)
+	case scriptType == "":
+		err = r.queue.Succeed(cmd.ID, "Перезапуск выполнен")
+	case r.interruptManager.IsInterrupted():
+		err = r.queue.Succeed(cmd.ID, scriptType+" прерван")
+	default:
+		r.loggerManager.Info("✅ %s завершен", scriptType)
+		err = r.queue.Succeed(cmd.ID, scriptType+" завершен")
+	}
+	if err != nil {
+		r.loggerManager.LogError(err, "Ошибка обновления команды в очереди")
+	}
+}
+
+// requestRestart останавливает текущий скрипт в безопасной точке; run перезапустит его после остановки
+func (r *scriptRunner) requestRestart() {
+	r.mu.Lock()
+	r.restartRequested = true
+	r.mu.Unlock()
+	r.interruptManager.Interrupt()
+}
+
+// isRestartRequested сообщает, запрошен ли перезапуск
+func (r *scriptRunner) isRestartRequested() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.restartRequested
+}
+
+// takeRestartRequest возвращает и сбрасывает флаг запрошенного перезапуска
+func (r *scriptRunner) takeRestartRequest() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	requested := r.restartRequested
+	r.restartRequested = false
+	return requested
+}
+
+// restartIdle выполняет перезапуск, когда скрипт не запущен: переинициализирует окружение
+// и запускает последний скрипт, если он был
+func (r *scriptRunner) restartIdle() error {
+	if !r.acquire() {
+		return scheduler.ErrBusy
+	}
+	err := r.restart()
+	r.release()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	scriptType, script := r.lastScript, r.lastScriptFunc
+	r.mu.Unlock()
+	if scriptType == "" {
+		return r.machine.Transition(lifecycle.StateReady, "Перезапуск завершен")
+	}
+	return r.runScript(scriptType, script, "Перезапуск: запуск "+scriptType)
+}
+
+// restart перечитывает config.yaml и заново находит окно брокера, записывая каждую фазу в статус.
+// При ошибке переводит машину состояний в error.
+func (r *scriptRunner) restart() error {
+	fail := func(err error, reason string) error {
+		r.loggerManager.LogError(err, reason)
+		if tErr := r.machine.Transition(lifecycle.StateError, reason); tErr != nil {
+			r.loggerManager.LogError(tErr, "Error updating status to error")
+		}
+		return err
+	}
+
+	err := r.machine.Transition(lifecycle.StateRestarting, "Перезапуск: чтение config.yaml")
+	if err != nil {
+		return err
+	}
+	newConfig, err := config.ReloadConfig()
+	if err != nil {
+		return fail(err, "Перезапуск: ошибка чтения config.yaml")
+	}
+	// Стартовые позиции заданы флагами, а порт уже открыт - переносим их в новый конфиг
+	newConfig.StartButtonIndex = r.c.StartButtonIndex
+	newConfig.StartItemIndex = r.c.StartItemIndex
+	newConfig.PortObj = r.c.PortObj
+	*r.c = newConfig
+
+	err = r.machine.Transition(lifecycle.StateRestarting, "Перезапуск: поиск окна брокера")
+	if err != nil {
+		return err
+	}
+	marginX, marginY, err := imageInternal.NewWindowInitializer(r.c.WindowTopOffset).GetItemBrokerWindowMargins()
+	if err != nil {
+		return fail(err, "Перезапуск: окно брокера не найдено")
+	}
+	r.screenshotManager.SetMargins(marginX, marginY)
+	r.clickManager.SetMargins(marginX, marginY)
+	r.loggerManager.Info("🔄 Новые отступы окна брокера: %d, %d", marginX, marginY)
+
+	err = addAction(r.db, "Перезапуск выполнен")
+	if err != nil {
+		r.loggerManager.LogError(err, "Error adding restart action")
+	}
+	return nil
+}
+
+// onDemandSource отдает скрипту cycle_listed_items команды scan_item из очереди, чтобы сканировать их между предметами
+type onDemandSource struct {
+	r *scriptRunner
+}
+
+// Next забирает из очереди самую старую команду scan_item категории category
+func (s onDemandSource) Next(category model.Category) (string, func(error), bool) {
+	var args commands.ScanItemArgs
+	cmd, err := s.r.queue.ClaimMatching(func(cmd *commands.Command) bool {
+		var a commands.ScanItemArgs
+		return json.Unmarshal([]byte(cmd.Args), &a) == nil && a.Category == category && a.Item != ""
+	}, commands.ScanItem)
+	if err != nil {
+		s.r.loggerManager.LogError(err, "Ошибка получения команды сканирования из очереди")
+		return "", nil, false
+	}
+	if cmd == nil {
+		return "", nil, false
+	}
+	if err := json.Unmarshal([]byte(cmd.Args), &args); err != nil {
+		return "", nil, false
+	}
+	s.r.loggerManager.Info("📨 Получена команда '%s' (ID: %d)", cmd.Command, cmd.ID)
+	if err := s.r.queue.Start(cmd.ID); err != nil {
+		s.r.loggerManager.LogError(err, "Ошибка обновления команды в очереди")
+	}
+	done := func(scanErr error) {
+		s.r.finishScriptCommand(cmd, "Сканирование "+args.Item, scanErr)
+	}
+	return args.Item, done, true
+}
+
+// autoStart выполняет скрипт scriptType, заданный при запуске программы, и возвращает код завершения
+func (r *scriptRunner) autoStart(scriptType string) int {
+	r.loggerManager.Info("🚀 Автозапуск %s...", scriptType)
+	err := r.run(scriptType, "Автозапуск "+scriptType)
+	if err != nil {
+		r.loggerManager.LogError(err, "Ошибка автозапуска "+scriptType)
+		return exitError
+	}
+	if r.interruptManager.IsInterrupted() {
+		r.loggerManager.Info("⏹️ %s прерван", scriptType)
+		return exitInterrupted
+	}
+	r.loggerManager.Info("✅ %s завершен", scriptType)
+	return exitOK
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"shnyr/internal/database"
+	"shnyr/internal/logger"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// Просмотр и повтор записей спула результатов OCR:
+//
+//	go run ./cmd/spool                   - список ожидающих и неудачных записей
+//	go run ./cmd/spool -retry all        - вернуть неудачные записи в очередь
+//	go run ./cmd/spool -replay -dsn ...  - записать ожидающие записи в базу
+func main() {
+	dir := flag.String("dir", database.DefaultSpoolDir, "Каталог спула (spool_dir из config.yaml)")
+	retry := flag.String("retry", "", "ID неудачной записи или all - вернуть в очередь")
+	replay := flag.Bool("replay", false, "Записать ожидающие записи в базу")
+	dsn := flag.String("dsn", os.Getenv("SHNYR_DSN"), "Строка подключения к MySQL для -replay (по умолчанию SHNYR_DSN)")
+	flag.Parse()
+
+	spool, err := database.NewSpool(*dir)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if *retry != "" {
+		failed, err := spool.Failed()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		for _, entry := range failed {
+			if *retry != "all" && *retry != entry.ID {
+				continue
+			}
+			if err := spool.Retry(entry.ID); err != nil {
+				log.Fatalf("%v", err)
+			}
+			fmt.Printf("↩️ %s возвращена в очередь\n", entry.ID)
+		}
+	}
+
+	if *replay {
+		if *dsn == "" {
+			log.Fatalf("Для -replay укажите -dsn или SHNYR_DSN")
+		}
+		db, err := sql.Open("mysql", *dsn)
+		if err != nil {
+			log.Fatalf("Ошибка подключения к базе: %v", err)
+		}
+		defer db.Close()
+
+		loggerManager, err := logger.NewLoggerManager("spool.log")
+		if err != nil {
+			log.Fatalf("Ошибка инициализации логгера: %v", err)
+		}
+		dbManager := database.NewDatabaseManager(db, loggerManager)
+		dbManager.SetSpool(spool)
+		replayed, err := dbManager.ReplaySpool()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Printf("♻️ Записано в базу: %d\n", replayed)
+	}
+
+	printEntries("Ожидают записи", spool.Pending)
+	printEntries("Не записаны", spool.Failed)
+}
+
+func printEntries(title string, list func() ([]*database.SpoolEntry, error)) {
+	entries, err := list()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	fmt.Printf("\n%s: %d\n", title, len(entries))
+	for _, entry := range entries {
+		fmt.Printf("  %s  %s  %s/%s  попыток: %d\n", entry.ID, entry.CreatedAt.Format("2006-01-02 15:04:05"), entry.Category, entry.ItemName, entry.Attempts)
+		if entry.LastError != "" {
+			fmt.Printf("      ошибка: %s\n", entry.LastError)
+		}
+	}
+}
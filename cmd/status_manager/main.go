@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 
+	"shnyr/internal/lifecycle"
+
 	_ "github.com/go-sql-driver/mysql"
 )
 
@@ -35,8 +37,15 @@ func main() {
 			fmt.Println("Ошибка: укажите новый статус")
 			return
 		}
-		newStatus := os.Args[2]
-		err := updateStatus(db, newStatus)
+		newStatus := lifecycle.ParseState(os.Args[2])
+		if newStatus == lifecycle.StateUnknown {
+			log.Fatalf("Неизвестный статус: %s", os.Args[2])
+		}
+		machine, err := lifecycle.NewMachine(db, nil)
+		if err != nil {
+			log.Fatalf("Ошибка получения статуса: %v", err)
+		}
+		err = machine.Transition(newStatus, "status_manager")
 		if err != nil {
 			log.Fatalf("Ошибка обновления статуса: %v", err)
 		}
@@ -59,7 +68,7 @@ func main() {
 		if err != nil {
 			log.Fatalf("Ошибка получения данных: %v", err)
 		}
-		fmt.Printf("Текущий статус: %s (обновлен: %s)\n", status.CurrentStatus, status.UpdatedAt)
+		fmt.Printf("Текущий статус: %s (обновлен: %s, причина: %s)\n", status.CurrentStatus, status.UpdatedAt, status.Reason)
 		fmt.Println("Последние действия:")
 		for _, action := range actions {
 			fmt.Printf("  - %s (%s)\n", action.Action, action.CreatedAt)
@@ -70,22 +79,22 @@ func main() {
 	}
 }
 
-func updateStatus(db *sql.DB, status string) error {
-	_, err := db.Exec("INSERT INTO status (current_status) VALUES (?)", status)
-	return err
-}
-
 func addAction(db *sql.DB, action string) error {
 	_, err := db.Exec("INSERT INTO actions (action) VALUES (?)", action)
 	return err
 }
 
 func getStatusAndActions(db *sql.DB) (Status, []Action, error) {
-	var status Status
-	err := db.QueryRow("SELECT id, current_status, updated_at FROM status ORDER BY id DESC LIMIT 1").Scan(&status.ID, &status.CurrentStatus, &status.UpdatedAt)
+	record, err := lifecycle.Latest(db)
 	if err != nil {
 		return Status{}, nil, err
 	}
+	status := Status{
+		ID:            record.ID,
+		CurrentStatus: string(record.State),
+		Reason:        record.Reason,
+		UpdatedAt:     record.ChangedAt.Format("2006-01-02 15:04:05"),
+	}
 
 	rows, err := db.Query("SELECT id, action, created_at FROM actions ORDER BY created_at DESC LIMIT 10")
 	if err != nil {
@@ -109,6 +118,7 @@ func getStatusAndActions(db *sql.DB) (Status, []Action, error) {
 type Status struct {
 	ID            int
 	CurrentStatus string
+	Reason        string
 	UpdatedAt     string
 }
 
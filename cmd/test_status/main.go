@@ -6,6 +6,8 @@ import (
 	"log"
 	"time"
 
+	"shnyr/internal/lifecycle"
+
 	_ "github.com/go-sql-driver/mysql"
 )
 
@@ -27,10 +29,10 @@ func main() {
 
 	fmt.Println("✅ Подключение к базе данных установлено")
 
-	// Функции для работы со статусом
-	updateStatus := func(status string) error {
-		_, err := db.Exec("INSERT INTO status (current_status) VALUES (?)", status)
-		return err
+	// Статус пишется только через машину состояний
+	machine, err := lifecycle.NewMachine(db, nil)
+	if err != nil {
+		log.Fatalf("Ошибка получения статуса: %v", err)
 	}
 
 	addAction := func(action string) error {
@@ -38,13 +40,20 @@ func main() {
 		return err
 	}
 
-	// Тестируем различные статусы
-	statuses := []string{"main", "ready", "cycle_all_items", "cycle_listed_items", "stopped"}
+	// Тестируем различные статусы в допустимом порядке переходов
+	statuses := []lifecycle.State{
+		lifecycle.StateMain,
+		lifecycle.StateReady,
+		lifecycle.StateCycleAllItems,
+		lifecycle.StateReady,
+		lifecycle.StateCycleListedItems,
+		lifecycle.StateStopped,
+	}
 
 	for _, status := range statuses {
 		fmt.Printf("📝 Обновляем статус на: %s\n", status)
 
-		err = updateStatus(status)
+		err = machine.Transition(status, "test_status")
 		if err != nil {
 			log.Printf("❌ Ошибка обновления статуса %s: %v", status, err)
 			continue
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"image"
+	"image/png"
 	"log"
 	"net/http"
 	"os"
@@ -13,36 +16,69 @@ import (
 	"strings"
 	"time"
 
+	"shnyr/internal/commands"
+	"shnyr/internal/corrections"
+	"shnyr/internal/lifecycle"
+	"shnyr/internal/migrations"
+	"shnyr/internal/model"
+	"shnyr/internal/price"
+	"shnyr/internal/scheduler"
+
 	_ "github.com/go-sql-driver/mysql"
 )
 
+// StructuredItem - предложение из structured_items_corrected для отображения
 type StructuredItem struct {
-	ID          int
-	OCRResultID int
-	Title       string
-	TitleShort  string
-	Enhancement string
-	Price       string
-	Package     bool
-	Owner       string
-	Count       string
-	Category    string
-	CreatedAt   string
+	model.Listing
+	// Сопоставление распознанного названия с items_list
+	MatchedName   string
+	MatchScore    float64
+	TitleMismatch bool // название похоже на другой предмет, не на искомый
+	Corrected     bool // поля показаны с исправлениями из item_corrections
 }
 
-type ItemsListItem struct {
-	ID            int
-	Name          string
-	Category      string
-	MinPrice      sql.NullFloat64
-	MinPriceValue float64
-	MinPriceValid bool
-	CreatedAt     string
+// ReviewItem - предложение с низкой уверенностью распознавания для очереди проверки
+type ReviewItem struct {
+	StructuredItem
+	HasCrop bool // известна строка предложения на изображении
+}
+
+// defaultReviewThreshold - предложения с уверенностью ниже порога попадают в очередь проверки
+const defaultReviewThreshold = 0.8
+
+// listingColumns - колонки structured_items_corrected si, которые читает scanListing
+const listingColumns = "si.id, si.ocr_result_id, COALESCE(si.item_list_id, 0), si.title, COALESCE(si.title_short, ''), COALESCE(si.enhancement, ''), si.price, si.price_value, " +
+	"si.package, COALESCE(si.owner, ''), COALESCE(si.count, ''), COALESCE(si.category, ''), si.created_at"
+
+// listingRow - строковые колонки предложения до перевода в типы model.Listing
+type listingRow struct {
+	enhancement, count, category string
+	priceValue                   sql.NullInt64
+}
+
+// dest возвращает приемники для колонок listingColumns
+func (r *listingRow) dest(l *model.Listing) []interface{} {
+	return []interface{}{&l.ID, &l.ObservationID, &l.ItemID, &l.Title, &l.TitleShort, &r.enhancement, &l.PriceText, &r.priceValue,
+		&l.Package, &l.Owner, &r.count, &r.category, &l.CreatedAt}
+}
+
+// apply заполняет типизированные поля. Значения, сохраненные до проверки полей, не мешают показать предложение:
+// неразборчивое улучшение или количество показывается нулем, цена - строкой PriceText.
+func (r *listingRow) apply(l *model.Listing) {
+	l.Enhancement, _ = model.ParseEnhancement(r.enhancement)
+	l.Count, _ = model.ParseCount(r.count)
+	l.Price = r.priceValue.Int64
+	category, err := model.ParseCategory(r.category)
+	if err != nil {
+		category = model.CategoryUnknown
+	}
+	l.Category = category
 }
 
 type Status struct {
 	ID            int
 	CurrentStatus string
+	Reason        string
 	UpdatedAt     string
 }
 
@@ -53,16 +89,10 @@ type Action struct {
 	CreatedAt string
 }
 
+// OCRResult - результат OCR с предложениями для основной вкладки
 type OCRResult struct {
-	ID        int
-	ImagePath string
-	ImageData []byte
-	OCRText   string
-	DebugInfo string
-	JSONData  string
-	RawText   string
-	CreatedAt string
-	Items     []StructuredItem
+	model.Observation
+	Items []StructuredItem
 }
 
 type PageData struct {
@@ -80,13 +110,28 @@ type PageData struct {
 	ActiveTab               string
 	ItemSearch              string
 	ItemResults             []StructuredItem
-	ItemsList               []ItemsListItem
+	ItemsList               []model.Item
 	CategoryBuyConsumables  bool
 	CategoryBuyEquipment    bool
 	CategorySellConsumables bool
 	CategorySellEquipment   bool
 	Status                  Status
 	RecentActions           []Action
+	UpcomingRuns            []ScheduledRun
+	PastRuns                []ScheduledRun
+	ReviewItems             []ReviewItem
+	ReviewThreshold         float64
+}
+
+// ScheduledRun - запуск по расписанию для отображения во вкладке расписания
+type ScheduledRun struct {
+	Rule        string
+	Categories  []model.Category
+	Status      string
+	ScheduledAt string
+	StartedAt   string
+	FinishedAt  string
+	Error       string
 }
 
 func getDatabaseDSN() string {
@@ -119,23 +164,27 @@ func getDatabaseDSN() string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", dbUser, dbPassword, dbHost, dbPort, dbName)
 }
 
-func getItemsList(db *sql.DB) ([]ItemsListItem, error) {
-	rows, err := db.Query("SELECT id, name, category, min_price, created_at FROM items_list ORDER BY category, id")
+func getItemsList(db *sql.DB) ([]model.Item, error) {
+	rows, err := db.Query("SELECT id, name, category, min_price, created_at FROM items_list WHERE deleted_at IS NULL ORDER BY category, position, id")
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса items_list: %v", err)
 	}
 	defer rows.Close()
 
-	var items []ItemsListItem
+	var items []model.Item
 	for rows.Next() {
-		var item ItemsListItem
-		err := rows.Scan(&item.ID, &item.Name, &item.Category, &item.MinPrice, &item.CreatedAt)
+		var item model.Item
+		var category string
+		var minPrice sql.NullFloat64
+		err := rows.Scan(&item.ID, &item.Name, &category, &minPrice, &item.CreatedAt)
 		if err != nil {
 			log.Printf("Ошибка сканирования items_list: %v, пропускаем запись", err)
 			continue // Пропускаем проблемную запись
 		}
-		item.MinPriceValue = item.MinPrice.Float64
-		item.MinPriceValid = item.MinPrice.Valid
+		if item.Category, err = model.ParseCategory(category); err != nil {
+			item.Category = model.CategoryUnknown
+		}
+		item.MinPrice = int64(minPrice.Float64)
 		items = append(items, item)
 	}
 
@@ -147,16 +196,38 @@ func getItemsList(db *sql.DB) ([]ItemsListItem, error) {
 }
 
 func getCurrentStatus(db *sql.DB) (Status, error) {
-	var status Status
-	err := db.QueryRow("SELECT id, current_status, updated_at FROM status ORDER BY id DESC LIMIT 1").Scan(&status.ID, &status.CurrentStatus, &status.UpdatedAt)
+	record, err := lifecycle.Latest(db)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// Если нет записей, возвращаем статус по умолчанию
-			return Status{ID: 0, CurrentStatus: "unknown", UpdatedAt: ""}, nil
-		}
-		return Status{}, fmt.Errorf("ошибка получения статуса: %v", err)
+		return Status{}, err
+	}
+	if record.ID == 0 {
+		// Если нет записей, возвращаем статус по умолчанию
+		return Status{ID: 0, CurrentStatus: string(lifecycle.StateUnknown), UpdatedAt: ""}, nil
 	}
-	return status, nil
+	return Status{
+		ID:            record.ID,
+		CurrentStatus: string(record.State),
+		Reason:        record.Reason,
+		UpdatedAt:     record.ChangedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}, nil
+}
+
+// stateLabels содержит подписи состояний бота для веб-интерфейса
+var stateLabels = map[lifecycle.State]string{
+	lifecycle.StateStopped:          "🔴 СТРАДАЕТ ХУЙНЕЙ",
+	lifecycle.StateMain:             "🟢 ОХОТА НА ЛОХА: Запуск приложения",
+	lifecycle.StateReady:            "🟢 ОХОТА НА ЛОХА: Готов к работе",
+	lifecycle.StateCycleAllItems:    "🟢 ОХОТА НА ЛОХА: cycle_all_items",
+	lifecycle.StateCycleListedItems: "🟢 ОХОТА НА ЛОХА: cycle_listed_items",
+	lifecycle.StatePaused:           "🟡 ОХОТА НА ЛОХА: Приостановлено",
+	lifecycle.StateRestarting:       "🟡 ОХОТА НА ЛОХА: Перезапуск",
+	lifecycle.StateError:            "❌ ОХОТА НА ЛОХА: Ошибка",
+	lifecycle.StateUnknown:          "❓ ОХОТА НА ЛОХА: Неизвестно",
+}
+
+// formatStatus возвращает подпись для состояния из таблицы status
+func formatStatus(status string) string {
+	return stateLabels[lifecycle.ParseState(status)]
 }
 
 func getRecentActions(db *sql.DB, limit int) ([]Action, error) {
@@ -184,50 +255,152 @@ func getRecentActions(db *sql.DB, limit int) ([]Action, error) {
 	return actions, nil
 }
 
-func addAction(db *sql.DB, action string) error {
-	_, err := db.Exec("INSERT INTO actions (action) VALUES (?)", action)
-	return err
-}
-
-func addActionWithExecuted(db *sql.DB, action string, executed bool) error {
-	_, err := db.Exec("INSERT INTO actions (action, executed) VALUES (?, ?)", action, executed)
-	return err
-}
+// getScheduledRuns преобразует запуски по расписанию в формат для шаблона
+func getScheduledRuns(runs []scheduler.Run) []ScheduledRun {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format("2006-01-02T15:04:05Z")
+	}
 
-func updateActionExecuted(db *sql.DB, actionID int, executed bool) error {
-	_, err := db.Exec("UPDATE actions SET executed = ? WHERE id = ?", executed, actionID)
-	return err
+	var result []ScheduledRun
+	for _, run := range runs {
+		var categories []model.Category
+		for _, name := range strings.Split(run.Categories, ",") {
+			categories = append(categories, model.Category(name))
+		}
+		result = append(result, ScheduledRun{
+			Rule:        run.Rule,
+			Categories:  categories,
+			Status:      string(run.Status),
+			ScheduledAt: formatTime(&run.ScheduledAt),
+			StartedAt:   formatTime(run.StartedAt),
+			FinishedAt:  formatTime(run.FinishedAt),
+			Error:       run.Error,
+		})
+	}
+	return result
 }
 
-func getLatestPendingAction(db *sql.DB) (*Action, error) {
-	var action Action
-	err := db.QueryRow("SELECT id, action, executed, created_at FROM actions WHERE executed = FALSE ORDER BY created_at DESC LIMIT 1").Scan(&action.ID, &action.Action, &action.Executed, &action.CreatedAt)
+// getReviewItems возвращает непроверенные предложения с уверенностью ниже threshold, начиная с наименее уверенных
+func getReviewItems(db *sql.DB, threshold float64, limit int) ([]ReviewItem, error) {
+	rows, err := db.Query(`SELECT `+listingColumns+`,
+			COALESCE(il.name, ''), si.match_score, si.title_mismatch, si.corrected,
+			si.confidence, si.title_confidence, si.price_confidence, si.count_confidence, si.owner_confidence, si.row_top IS NOT NULL
+		FROM structured_items_corrected si
+		LEFT JOIN items_list il ON il.id = si.item_list_id
+		WHERE si.review_status IS NULL AND si.confidence < ?
+		ORDER BY si.confidence, si.created_at DESC
+		LIMIT ?`, threshold, limit)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, err
 	}
-	return &action, nil
+	defer rows.Close()
+
+	var items []ReviewItem
+	for rows.Next() {
+		var item ReviewItem
+		var row listingRow
+		var matchScore sql.NullFloat64
+		var fields [4]sql.NullFloat64
+		if err := rows.Scan(append(row.dest(&item.Listing),
+			&item.MatchedName, &matchScore, &item.TitleMismatch, &item.Corrected,
+			&item.Confidence, &fields[0], &fields[1], &fields[2], &fields[3], &item.HasCrop)...); err != nil {
+			return nil, err
+		}
+		row.apply(&item.Listing)
+		item.MatchScore = matchScore.Float64
+		item.FieldConfidence = make(map[string]float64)
+		for i, field := range []string{"title", "price", "count", "owner"} {
+			if fields[i].Valid {
+				item.FieldConfidence[field] = fields[i].Float64
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
 }
 
-func updateStatus(db *sql.DB, status string) error {
-	_, err := db.Exec("INSERT INTO status (current_status) VALUES (?)", status)
-	return err
+// sameValue сообщает, что исправление value поля field из очереди проверки не меняет значение current:
+// цена и количество сравниваются числами, чтобы "1500" не считалось исправлением "1,500"
+func sameValue(field, value, current string) bool {
+	if value == current {
+		return true
+	}
+	switch field {
+	case "price":
+		a, errA := price.Parse(value)
+		b, errB := price.Parse(current)
+		return errA == nil && errB == nil && a == b
+	case "count":
+		a, errA := model.ParseCount(value)
+		b, errB := model.ParseCount(current)
+		return errA == nil && errB == nil && a == b
+	}
+	return false
 }
 
-func updateLatestPendingAction(db *sql.DB) error {
-	action, err := getLatestPendingAction(db)
+// cropRow вырезает из PNG изображения строку предложения; без координат строки возвращает изображение целиком
+func cropRow(data []byte, top, bottom sql.NullInt64) ([]byte, error) {
+	if !top.Valid || !bottom.Valid {
+		return data, nil
+	}
+	img, err := png.Decode(bytes.NewReader(data))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("ошибка декодирования изображения: %v", err)
+	}
+	bounds := img.Bounds()
+	rect := image.Rect(bounds.Min.X, bounds.Min.Y+int(top.Int64), bounds.Max.X, bounds.Min.Y+int(bottom.Int64)).Intersect(bounds)
+	if rect.Empty() {
+		return data, nil
+	}
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, sub.SubImage(rect)); err != nil {
+		return nil, fmt.Errorf("ошибка кодирования изображения: %v", err)
 	}
-	if action != nil {
-		err = updateActionExecuted(db, action.ID, true)
+	return buf.Bytes(), nil
+}
+
+// commandHandler возвращает обработчик кнопки, ставящий команду command в очередь команд бота.
+// check проверяет по текущему статусу, имеет ли команда смысл; nil - команда допустима всегда.
+// Необязательный параметр instance направляет команду конкретному экземпляру бота.
+func commandHandler(db *sql.DB, command string, check func(state lifecycle.State) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", 405)
+			return
+		}
+
+		if check != nil {
+			status, err := getCurrentStatus(db)
+			if err != nil {
+				log.Printf("Ошибка получения статуса: %v", err)
+				http.Error(w, "Internal server error", 500)
+				return
+			}
+			if err := check(lifecycle.ParseState(status.CurrentStatus)); err != nil {
+				http.Error(w, err.Error(), 409)
+				return
+			}
+		}
+
+		id, err := commands.Enqueue(db, command, r.FormValue("instance"))
 		if err != nil {
-			return err
+			log.Printf("Ошибка добавления команды %s: %v", command, err)
+			http.Error(w, "Internal server error", 500)
+			return
 		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "command": command})
 	}
-	return nil
 }
 
 func main() {
@@ -257,6 +430,11 @@ func main() {
 	}
 
 	log.Printf("Успешно подключились к базе данных: %s", dbDSN)
+
+	// Схему создает и обновляет cmd/migrate
+	if err := migrations.Check(db); err != nil {
+		log.Fatalf("%v", err)
+	}
 	log.Printf("Запускаем сервер на %s:%s", host, port)
 
 	// Настройка статических файлов
@@ -308,26 +486,28 @@ func main() {
 		if itemSearch != "" {
 			// Формируем список категорий для поиска
 			var categories []string
-			if categoryBuyConsumables {
-				categories = append(categories, "'buy_consumables'")
-			}
-			if categoryBuyEquipment {
-				categories = append(categories, "'buy_equipment'")
-			}
-			if categorySellConsumables {
-				categories = append(categories, "'sell_consumables'")
-			}
-			if categorySellEquipment {
-				categories = append(categories, "'sell_equipment'")
+			for category, selected := range map[model.Category]bool{
+				model.CategoryBuyConsumables:  categoryBuyConsumables,
+				model.CategoryBuyEquipment:    categoryBuyEquipment,
+				model.CategorySellConsumables: categorySellConsumables,
+				model.CategorySellEquipment:   categorySellEquipment,
+			} {
+				if selected {
+					categories = append(categories, "'"+string(category)+"'")
+				}
 			}
 
 			// Поиск по structured_items
-			itemQuery := fmt.Sprintf(`SELECT id, ocr_result_id, title, title_short, enhancement, price, package, owner, count, category, created_at 
-				FROM structured_items 
-				WHERE category IN (%s) AND title LIKE ? 
-				ORDER BY CAST(REPLACE(REPLACE(price, ',', ''), ' ', '') AS DECIMAL(10,2)), created_at DESC`, strings.Join(categories, ", "))
-
-			itemRows, err := db.Query(itemQuery, "%"+itemSearch+"%")
+			// Кроме названий, похожих на запрос, находим предложения, сопоставленные с предметом из items_list:
+			// так находятся и строки с ошибками распознавания вроде "go1d coin"
+			itemQuery := fmt.Sprintf(`SELECT `+listingColumns+`,
+					COALESCE(il.name, ''), si.match_score, si.title_mismatch, si.corrected
+				FROM structured_items_corrected si
+				LEFT JOIN items_list il ON il.id = si.item_list_id
+				WHERE si.category IN (%s) AND (si.title LIKE ? OR il.name LIKE ?)
+				ORDER BY si.price_value IS NULL, si.price_value, si.created_at DESC`, strings.Join(categories, ", "))
+
+			itemRows, err := db.Query(itemQuery, "%"+itemSearch+"%", "%"+itemSearch+"%")
 			if err != nil {
 				http.Error(w, "DB error", 500)
 				return
@@ -336,12 +516,75 @@ func main() {
 
 			for itemRows.Next() {
 				var item StructuredItem
-				if err := itemRows.Scan(&item.ID, &item.OCRResultID, &item.Title, &item.TitleShort, &item.Enhancement, &item.Price, &item.Package, &item.Owner, &item.Count, &item.Category, &item.CreatedAt); err == nil {
+				var row listingRow
+				var matchScore sql.NullFloat64
+				if err := itemRows.Scan(append(row.dest(&item.Listing), &item.MatchedName, &matchScore, &item.TitleMismatch, &item.Corrected)...); err == nil {
+					row.apply(&item.Listing)
+					item.MatchScore = matchScore.Float64
 					itemResults = append(itemResults, item)
 				}
 			}
 		}
 
+		// Вкладка проверки показывает предложения, распознанные с низкой уверенностью
+		if activeTab == "review" {
+			status, err := getCurrentStatus(db)
+			if err != nil {
+				log.Printf("Ошибка получения статуса: %v", err)
+				status = Status{ID: 0, CurrentStatus: "unknown", UpdatedAt: ""}
+			}
+
+			threshold := defaultReviewThreshold
+			if t, err := strconv.ParseFloat(r.URL.Query().Get("threshold"), 64); err == nil && t > 0 && t <= 1 {
+				threshold = t
+			}
+			reviewItems, err := getReviewItems(db, threshold, 100)
+			if err != nil {
+				log.Printf("Ошибка получения очереди проверки: %v", err)
+			}
+
+			renderTemplate(w, PageData{
+				ActiveTab:       activeTab,
+				Status:          status,
+				ReviewItems:     reviewItems,
+				ReviewThreshold: threshold,
+			})
+			return
+		}
+
+		// Вкладка расписания показывает ближайшие и прошедшие запуски по расписанию
+		if activeTab == "schedule" {
+			status, err := getCurrentStatus(db)
+			if err != nil {
+				log.Printf("Ошибка получения статуса: %v", err)
+				status = Status{ID: 0, CurrentStatus: "unknown", UpdatedAt: ""}
+			}
+
+			recentActions, err := getRecentActions(db, 5)
+			if err != nil {
+				log.Printf("Ошибка получения действий: %v", err)
+				recentActions = []Action{}
+			}
+
+			upcoming, err := scheduler.Upcoming(db, 20)
+			if err != nil {
+				log.Printf("Ошибка получения запланированных запусков: %v", err)
+			}
+			past, err := scheduler.Recent(db, 50)
+			if err != nil {
+				log.Printf("Ошибка получения прошедших запусков: %v", err)
+			}
+
+			renderTemplate(w, PageData{
+				ActiveTab:     activeTab,
+				Status:        status,
+				RecentActions: recentActions,
+				UpcomingRuns:  getScheduledRuns(upcoming),
+				PastRuns:      getScheduledRuns(past),
+			})
+			return
+		}
+
 		// Если активна вкладка поиска по предмету и есть результаты, показываем только их
 		if activeTab == "item_search" && itemSearch != "" {
 			// Получаем статус и действия
@@ -378,7 +621,7 @@ func main() {
 		itemsList, err := getItemsList(db)
 		if err != nil {
 			log.Printf("Ошибка получения items_list: %v", err)
-			itemsList = []ItemsListItem{} // Пустой список в случае ошибки
+			itemsList = []model.Item{} // Пустой список в случае ошибки
 		}
 
 		resultsPerPage := 10
@@ -391,11 +634,11 @@ func main() {
 		if searchQuery != "" || minPrice != "" || maxPrice != "" {
 			// Поиск по структурированным данным
 			countQuery = `SELECT COUNT(DISTINCT ocr.id) FROM ocr_results ocr 
-				LEFT JOIN structured_items si ON ocr.id = si.ocr_result_id 
+				LEFT JOIN structured_items_corrected si ON ocr.id = si.ocr_result_id 
 				WHERE (si.title LIKE ? OR si.owner LIKE ? OR si.price LIKE ? OR si.title_short LIKE ?)`
 			dataQuery = `SELECT DISTINCT ocr.id, ocr.image_path, ocr.image_data, ocr.ocr_text, ocr.debug_info, ocr.json_data, ocr.raw_text, ocr.created_at 
 				FROM ocr_results ocr 
-				LEFT JOIN structured_items si ON ocr.id = si.ocr_result_id 
+				LEFT JOIN structured_items_corrected si ON ocr.id = si.ocr_result_id 
 				WHERE (si.title LIKE ? OR si.owner LIKE ? OR si.price LIKE ? OR si.title_short LIKE ?)`
 
 			searchPattern := "%" + searchQuery + "%"
@@ -409,12 +652,12 @@ func main() {
 				priceArgs := []interface{}{}
 
 				if minPrice != "" {
-					priceConditions = append(priceConditions, "CAST(REPLACE(REPLACE(si.price, ',', ''), ' ', '') AS DECIMAL(10,2)) >= ?")
+					priceConditions = append(priceConditions, "si.price_value >= ?")
 					priceArgs = append(priceArgs, minPrice)
 				}
 
 				if maxPrice != "" {
-					priceConditions = append(priceConditions, "CAST(REPLACE(REPLACE(si.price, ',', ''), ' ', '') AS DECIMAL(10,2)) <= ?")
+					priceConditions = append(priceConditions, "si.price_value <= ?")
 					priceArgs = append(priceArgs, maxPrice)
 				}
 
@@ -477,12 +720,20 @@ func main() {
 			}
 
 			// Загружаем структурированные данные для этого OCR результата
-			itemRows, err := db.Query(`SELECT id, ocr_result_id, title, title_short, enhancement, price, package, owner, count, category, created_at FROM structured_items WHERE ocr_result_id = ? ORDER BY created_at`, res.ID)
+			itemRows, err := db.Query(`SELECT `+listingColumns+`,
+					COALESCE(il.name, ''), si.match_score, si.title_mismatch, si.corrected
+				FROM structured_items_corrected si
+				LEFT JOIN items_list il ON il.id = si.item_list_id
+				WHERE si.ocr_result_id = ? ORDER BY si.created_at`, res.ID)
 			if err == nil {
 				defer itemRows.Close()
 				for itemRows.Next() {
 					var item StructuredItem
-					if err := itemRows.Scan(&item.ID, &item.OCRResultID, &item.Title, &item.TitleShort, &item.Enhancement, &item.Price, &item.Package, &item.Owner, &item.Count, &item.Category, &item.CreatedAt); err == nil {
+					var row listingRow
+					var matchScore sql.NullFloat64
+					if err := itemRows.Scan(append(row.dest(&item.Listing), &item.MatchedName, &matchScore, &item.TitleMismatch, &item.Corrected)...); err == nil {
+						row.apply(&item.Listing)
+						item.MatchScore = matchScore.Float64
 						res.Items = append(res.Items, item)
 					}
 				}
@@ -526,94 +777,267 @@ func main() {
 		renderTemplate(w, pageData)
 	})
 
-	// Обработчик для кнопки Start
-	http.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+	// Кнопки управления ставят команды в очередь, бот забирает их оттуда
+	http.HandleFunc("/start", commandHandler(db, commands.Start, nil))
+	http.HandleFunc("/stop", commandHandler(db, commands.Stop, nil))
+	http.HandleFunc("/restart", commandHandler(db, commands.Restart, nil))
+	// Поставить на паузу можно только выполняющийся скрипт
+	http.HandleFunc("/pause", commandHandler(db, commands.Pause, func(state lifecycle.State) error {
+		if !state.IsRunning() {
+			return fmt.Errorf("скрипт не запущен")
+		}
+		return nil
+	}))
+	// Продолжить можно скрипт на паузе или отменить еще не наступившую паузу
+	http.HandleFunc("/resume", commandHandler(db, commands.Resume, func(state lifecycle.State) error {
+		if state != lifecycle.StatePaused && !state.IsRunning() {
+			return fmt.Errorf("скрипт не на паузе")
+		}
+		return nil
+	}))
+
+	// Сканирование одного предмета по запросу: бот выполнит его между предметами текущего обхода или в простое
+	http.HandleFunc("/scan", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			http.Error(w, "Method not allowed", 405)
 			return
 		}
 
-		// Помечаем последнее невыполненное действие как выполненное
-		err := updateLatestPendingAction(db)
+		args := commands.ScanItemArgs{
+			Item:     strings.TrimSpace(r.FormValue("item")),
+			Category: model.Category(r.FormValue("category")),
+		}
+		if args.Item == "" {
+			http.Error(w, "Не указан предмет", 400)
+			return
+		}
+		if _, err := model.ParseCategory(string(args.Category)); err != nil {
+			http.Error(w, "Неизвестная категория", 400)
+			return
+		}
+		data, err := json.Marshal(args)
 		if err != nil {
-			log.Printf("Ошибка обновления последнего действия: %v", err)
+			http.Error(w, "Internal server error", 500)
+			return
 		}
 
-		err = addActionWithExecuted(db, "start", false)
+		id, err := commands.EnqueueWithArgs(db, commands.ScanItem, string(data), r.FormValue("instance"))
 		if err != nil {
-			log.Printf("Ошибка добавления действия start: %v", err)
+			log.Printf("Ошибка добавления команды %s: %v", commands.ScanItem, err)
 			http.Error(w, "Internal server error", 500)
 			return
 		}
 
-		// Обновляем статус на start
-		err = updateStatus(db, "start")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "command": commands.ScanItem})
+	})
+
+	// Состояние одной команды очереди
+	http.HandleFunc("/command", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", 405)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
 		if err != nil {
-			log.Printf("Ошибка обновления статуса: %v", err)
+			http.Error(w, "Неверный ID команды", 400)
+			return
+		}
+		cmd, err := commands.Get(db, id)
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
 		}
 
-		w.WriteHeader(200)
-		w.Write([]byte("OK"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cmd)
 	})
 
-	// Обработчик для кнопки Stop
-	http.HandleFunc("/stop", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" {
+	// Последние команды очереди и их результаты
+	http.HandleFunc("/commands", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
 			http.Error(w, "Method not allowed", 405)
 			return
 		}
 
-		// Помечаем последнее невыполненное действие как выполненное
-		err := updateLatestPendingAction(db)
+		list, err := commands.Recent(db, 20)
+		if err != nil {
+			log.Printf("Ошибка получения команд: %v", err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	})
+
+	// Фрагмент изображения со строкой предложения для очереди проверки
+	http.HandleFunc("/review/crop", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
 		if err != nil {
-			log.Printf("Ошибка обновления последнего действия: %v", err)
+			http.Error(w, "Неверный ID предложения", 400)
+			return
 		}
 
-		err = addActionWithExecuted(db, "stop", false)
+		var data []byte
+		var top, bottom sql.NullInt64
+		err = db.QueryRow(`SELECT ocr.image_data, si.row_top, si.row_bottom
+			FROM structured_items si
+			INNER JOIN ocr_results ocr ON ocr.id = si.ocr_result_id
+			WHERE si.id = ?`, id).Scan(&data, &top, &bottom)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Предложение не найдено", 404)
+			return
+		}
 		if err != nil {
-			log.Printf("Ошибка добавления действия stop: %v", err)
+			log.Printf("Ошибка получения изображения предложения %d: %v", id, err)
 			http.Error(w, "Internal server error", 500)
 			return
 		}
 
-		// Обновляем статус на stop
-		err = updateStatus(db, "stop")
+		crop, err := cropRow(data, top, bottom)
 		if err != nil {
-			log.Printf("Ошибка обновления статуса: %v", err)
+			log.Printf("Ошибка вырезания строки предложения %d: %v", id, err)
+			crop = data
 		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(crop)
+	})
 
-		w.WriteHeader(200)
-		w.Write([]byte("OK"))
+	// Подтверждение распознанного предложения: оно уходит из очереди проверки без изменений
+	http.HandleFunc("/review/accept", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", 405)
+			return
+		}
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Неверный ID предложения", 400)
+			return
+		}
+
+		result, err := db.Exec("UPDATE structured_items SET review_status = 'accepted', reviewed_at = NOW() WHERE id = ?", id)
+		if err != nil {
+			log.Printf("Ошибка подтверждения предложения %d: %v", id, err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Предложение не найдено", 404)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
 	})
 
-	// Обработчик для кнопки Restart
-	http.HandleFunc("/restart", func(w http.ResponseWriter, r *http.Request) {
+	// Исправление полей предложения из очереди проверки: измененные поля записываются в item_corrections
+	http.HandleFunc("/review/correct", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			http.Error(w, "Method not allowed", 405)
 			return
 		}
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Неверный ID предложения", 400)
+			return
+		}
 
-		// Помечаем последнее невыполненное действие как выполненное
-		err := updateLatestPendingAction(db)
+		history, err := corrections.History(db, id)
+		if err != nil {
+			log.Printf("Ошибка получения исправлений предложения %d: %v", id, err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		var title, priceText, count, owner string
+		err = db.QueryRow("SELECT title, price, COALESCE(count, ''), COALESCE(owner, '') FROM structured_items_corrected WHERE id = ?", id).
+			Scan(&title, &priceText, &count, &owner)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Предложение не найдено", 404)
+			return
+		}
 		if err != nil {
-			log.Printf("Ошибка обновления последнего действия: %v", err)
+			log.Printf("Ошибка получения предложения %d: %v", id, err)
+			http.Error(w, "Internal server error", 500)
+			return
 		}
 
-		err = addActionWithExecuted(db, "restart", false)
+		// Предложение без изменений и прежних исправлений распознано верно
+		status := "accepted"
+		if len(history) > 0 {
+			status = "corrected"
+		}
+
+		// Сначала проверяются все измененные поля: неверное значение не должно оставить часть исправлений записанной
+		current := map[string]string{"title": title, "price": priceText, "count": count, "owner": owner}
+		var changed []string
+		for _, field := range []string{"title", "price", "count", "owner"} {
+			corrected := strings.TrimSpace(r.FormValue(field))
+			if sameValue(field, corrected, current[field]) {
+				continue
+			}
+			if _, _, err := corrections.Validate(field, corrected); err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+			changed = append(changed, field)
+		}
+
+		tx, err := db.Begin()
 		if err != nil {
-			log.Printf("Ошибка добавления действия restart: %v", err)
+			log.Printf("Ошибка начала транзакции исправления предложения %d: %v", id, err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		defer tx.Rollback()
+		for _, field := range changed {
+			if _, err := corrections.Record(tx, id, field, r.FormValue(field), "очередь проверки"); err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+			status = "corrected"
+		}
+		if _, err := tx.Exec("UPDATE structured_items SET review_status = ?, reviewed_at = NOW() WHERE id = ?", status, id); err != nil {
+			log.Printf("Ошибка исправления предложения %d: %v", id, err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			log.Printf("Ошибка подтверждения исправления предложения %d: %v", id, err)
 			http.Error(w, "Internal server error", 500)
 			return
 		}
+		w.WriteHeader(http.StatusNoContent)
+	})
 
-		// Обновляем статус на restart
-		err = updateStatus(db, "restart")
+	// Исправления полей предложения: GET - история по полям, POST - новое исправление поля
+	http.HandleFunc("/corrections", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.FormValue("item_id"))
 		if err != nil {
-			log.Printf("Ошибка обновления статуса: %v", err)
+			http.Error(w, "Неверный ID предложения", 400)
+			return
 		}
 
-		w.WriteHeader(200)
-		w.Write([]byte("OK"))
+		switch r.Method {
+		case "GET":
+			history, err := corrections.History(db, id)
+			if err != nil {
+				log.Printf("Ошибка получения исправлений предложения %d: %v", id, err)
+				http.Error(w, "Internal server error", 500)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(history)
+		case "POST":
+			correction, err := corrections.Record(db, id, r.FormValue("field"), r.FormValue("value"), strings.TrimSpace(r.FormValue("comment")))
+			if err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(correction)
+		default:
+			http.Error(w, "Method not allowed", 405)
+		}
 	})
 
 	// Обработчик для получения статуса в формате JSON
@@ -637,6 +1061,8 @@ func main() {
 		// Формируем JSON ответ
 		response := map[string]interface{}{
 			"status":    status.CurrentStatus,
+			"label":     formatStatus(status.CurrentStatus),
+			"reason":    status.Reason,
 			"updatedAt": status.UpdatedAt,
 		}
 
@@ -658,7 +1084,7 @@ func main() {
 		query := `WITH gold_coin_ocr AS (
 			SELECT DISTINCT ocr.id as ocr_id
 			FROM octopus.ocr_results ocr
-			INNER JOIN octopus.structured_items si ON ocr.id = si.ocr_result_id
+			INNER JOIN octopus.structured_items_corrected si ON ocr.id = si.ocr_result_id
 			WHERE si.title = 'gold coin' AND si.category = 'buy_consumables'
 		),
 		price_analysis AS (
@@ -671,10 +1097,10 @@ func main() {
 				si.owner,
 				si.count,
 				si.package,
-				CAST(REPLACE(REPLACE(si.price, ',', ''), ' ', '') AS DECIMAL(15,2)) as price_numeric
+				si.price_value as price_numeric
 			FROM gold_coin_ocr gco
-			INNER JOIN octopus.structured_items si ON gco.ocr_id = si.ocr_result_id
-			WHERE si.price IS NOT NULL AND si.price != '' AND CAST(REPLACE(REPLACE(si.price, ',', ''), ' ', '') AS DECIMAL(15,2)) > 0
+			INNER JOIN octopus.structured_items_corrected si ON gco.ocr_id = si.ocr_result_id
+			WHERE si.price_value > 0
 		),
 		top_3_prices AS (
 			SELECT 
@@ -752,6 +1178,41 @@ func main() {
 		}
 	})
 
+	// Endpoint для Prometheus: доля страниц, взятых из кэша OCR, за последний час и сутки
+	http.HandleFunc("/metrics/ocr_cache", func(w http.ResponseWriter, r *http.Request) {
+		// Метрики собираются в буфер: при ошибке запроса код 500 отправляется до тела ответа
+		var buf bytes.Buffer
+		fmt.Fprintln(&buf, "# HELP ocr_cache_pages Распознанные страницы за окно")
+		fmt.Fprintln(&buf, "# TYPE ocr_cache_pages gauge")
+		fmt.Fprintln(&buf, "# HELP ocr_cache_hits Страницы, взятые из кэша OCR, за окно")
+		fmt.Fprintln(&buf, "# TYPE ocr_cache_hits gauge")
+		fmt.Fprintln(&buf, "# HELP ocr_cache_hit_ratio Доля попаданий кэша OCR за окно")
+		fmt.Fprintln(&buf, "# TYPE ocr_cache_hit_ratio gauge")
+
+		for _, window := range []struct {
+			label string
+			hours int
+		}{{"1h", 1}, {"24h", 24}} {
+			var pages, hits int
+			err := db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(ocr_cache_hit), 0) FROM octopus.ocr_results
+				WHERE created_at >= NOW() - INTERVAL ? HOUR`, window.hours).Scan(&pages, &hits)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("# error: %v", err), 500)
+				return
+			}
+			ratio := 0.0
+			if pages > 0 {
+				ratio = float64(hits) / float64(pages)
+			}
+			fmt.Fprintf(&buf, "ocr_cache_pages{window=\"%s\"} %d\n", window.label, pages)
+			fmt.Fprintf(&buf, "ocr_cache_hits{window=\"%s\"} %d\n", window.label, hits)
+			fmt.Fprintf(&buf, "ocr_cache_hit_ratio{window=\"%s\"} %f\n", window.label, ratio)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+
 	fmt.Printf("🚀 ШНЫРЬ v0.1 запущен на порту %s\n", port)
 	fmt.Printf("📊 База данных: %s\n", dbDSN)
 	fmt.Printf("🌐 Откройте http://localhost:%s в браузере\n", port)
@@ -779,12 +1240,21 @@ func renderTemplate(w http.ResponseWriter, data PageData) {
 		"jsEscape": func(s string) string {
 			return strings.ReplaceAll(strings.ReplaceAll(s, `\\`, `\\\\`), `\"`, `\\\"`)
 		},
-		"formatDateTime": func(dateTimeStr string) string {
-			// Парсим время из строки
-			t, err := time.Parse("2006-01-02T15:04:05Z", dateTimeStr)
-			if err != nil {
-				// Если не удалось распарсить, возвращаем исходную строку
-				return dateTimeStr
+		"formatDateTime": func(value interface{}) string {
+			// Время из базы приходит как time.Time, время статуса и расписания - строкой
+			var t time.Time
+			switch v := value.(type) {
+			case time.Time:
+				t = v.UTC()
+			case string:
+				parsed, err := time.Parse("2006-01-02T15:04:05Z", v)
+				if err != nil {
+					// Если не удалось распарсить, возвращаем исходную строку
+					return v
+				}
+				t = parsed
+			default:
+				return fmt.Sprint(value)
 			}
 
 			// Добавляем 8 часов (UTC+8)
@@ -793,12 +1263,12 @@ func renderTemplate(w http.ResponseWriter, data PageData) {
 			// Форматируем в читаемый вид
 			return localTime.Format("02.01.2006 15:04:05")
 		},
-		"formatPrice": func(price string) string {
-			// Убираем все нецифровые символы
-			cleanPrice := strings.ReplaceAll(strings.ReplaceAll(price, ",", ""), " ", "")
-			if cleanPrice == "" {
-				return price
+		"formatPrice": func(value int64, text string) string {
+			// Цена, которую не удалось разобрать, показывается так, как ее распознал OCR
+			if value <= 0 {
+				return text
 			}
+			cleanPrice := strconv.FormatInt(value, 10)
 
 			// Добавляем пробелы каждые 3 цифры справа
 			var result string
@@ -825,51 +1295,31 @@ func renderTemplate(w http.ResponseWriter, data PageData) {
 			}
 			return pages
 		},
-		"formatCategory": func(category string) string {
-			switch category {
-			case "buy_consumables":
-				return "💰 Покупай! (расходники)"
-			case "buy_equipment":
-				return "💰 Покупай! (экипировка)"
-			case "sell_consumables":
-				return "💸 Продавай! (расходники)"
-			case "sell_equipment":
-				return "💸 Продавай! (экипировка)"
-			case "unknown":
-				return "❓ Неизвестно"
-			default:
-				return category
-			}
+		"formatCategory": func(category model.Category) string {
+			return category.Label()
 		},
-		"formatStatus": func(status string) string {
-			switch status {
-			case "stopped":
-				return "🔴 СТРАДАЕТ ХУЙНЕЙ"
-			case "main":
-				return "🟢 ОХОТА НА ЛОХА: Запуск приложения"
-			case "ready":
-				return "🟢 ОХОТА НА ЛОХА: Готов к работе"
-			case "cycle_all_items":
-				return "🟢 ОХОТА НА ЛОХА: cycle_all_items"
-			case "cycle_listed_items":
-				return "🟢 ОХОТА НА ЛОХА: cycle_listed_items"
-			case "running":
-				return "🟢 ОХОТА НА ЛОХА"
-			case "paused":
-				return "🟡 ОХОТА НА ЛОХА: Приостановлено"
-			case "error":
-				return "❌ ОХОТА НА ЛОХА: Ошибка"
-			case "unknown":
-				return "❓ ОХОТА НА ЛОХА: Неизвестно"
+		"formatStatus": formatStatus,
+		"formatRunStatus": func(status string) string {
+			switch scheduler.RunStatus(status) {
+			case scheduler.RunScheduled:
+				return "🗓️ Запланирован"
+			case scheduler.RunRunning:
+				return "🟢 Выполняется"
+			case scheduler.RunSucceeded:
+				return "✅ Выполнен"
+			case scheduler.RunInterrupted:
+				return "⏹️ Прерван"
+			case scheduler.RunFailed:
+				return "❌ Ошибка"
+			case scheduler.RunCancelled:
+				return "🚫 Отменен"
 			default:
-				// Если статус содержит название скрипта, форматируем его
-				if strings.Contains(status, "cycle_") || strings.Contains(status, "ocr_") || strings.Contains(status, "web_") {
-					return "🟢 ОХОТА НА ЛОХА: " + status
-				}
-				return "🟢 ОХОТА НА ЛОХА: " + status
+				return status
 			}
 		},
-		"int": func(x float64) int { return int(x) },
+		"percent": func(x float64) string {
+			return fmt.Sprintf("%.0f%%", x*100)
+		},
 	}).ParseGlob(templatePath)
 
 	if err != nil {
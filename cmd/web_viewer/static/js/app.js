@@ -171,7 +171,7 @@ function openDetailModal(text, id, imageData, imagePath, debugInfo, hasItems, ..
 		});
 		
 		let tableHTML = '<table class="structured-table">';
-		tableHTML += '<thead><tr><th>Название</th><th>Краткое название</th><th>Улучшение</th><th>Цена</th><th>Количество</th><th>Пакет</th><th>Владелец</th><th>Категория</th></tr></thead>';
+		tableHTML += '<thead><tr><th>Название</th><th>Краткое название</th><th>Улучшение</th><th>Цена</th><th>Количество</th><th>Пакет</th><th>Владелец</th><th>Категория</th><th></th></tr></thead>';
 		tableHTML += '<tbody>';
 		
 		items.forEach(item => {
@@ -186,10 +186,12 @@ function openDetailModal(text, id, imageData, imagePath, debugInfo, hasItems, ..
 			tableHTML += '<td>' + (item.package ? '✔️' : '❌') + '</td>';
 			tableHTML += '<td>' + (item.owner || '') + '</td>';
 			tableHTML += '<td>' + formatCategory(item.category || '') + '</td>';
+			tableHTML += '<td><button class="edit-button" title="Исправить" onclick="openCorrection(' + item.id + ')">✏️</button>' + (item.corrected ? ' <small>исправлено</small>' : '') + '</td>';
 			tableHTML += '</tr>';
 		});
 		
 		tableHTML += '</tbody></table>';
+		detailModalItems = items;
 		console.log('Generated table HTML:', tableHTML);
 		modalStructuredData.innerHTML = tableHTML;
 		console.log('Table HTML set to modalStructuredData');
@@ -198,6 +200,8 @@ function openDetailModal(text, id, imageData, imagePath, debugInfo, hasItems, ..
 		modalStructuredData.innerHTML = '<p>Нет структурированных данных</p>';
 	}
 	
+	document.getElementById('correctionSection').style.display = 'none';
+	
 	// Показываем модальное окно
 	const detailModal = document.getElementById('detailModal');
 	detailModal.style.display = 'block';
@@ -378,4 +382,186 @@ function sendAction(action) {
 		console.error('Ошибка сети:', error);
 		alert('Ошибка сети при отправке действия');
 	});
-} 
\ No newline at end of file
+} 
+// scanNow ставит в очередь сканирование предмета из строки таблицы и ждет его завершения,
+// после чего открывает поиск по предмету с новыми результатами
+function scanNow(button) {
+	const item = button.dataset.item;
+	const category = button.dataset.category;
+	const body = new URLSearchParams({ item: item, category: category });
+
+	button.disabled = true;
+	button.textContent = '⏳ В очереди';
+
+	fetch('/scan', { method: 'POST', body: body })
+	.then(response => {
+		if (!response.ok) {
+			return response.text().then(text => { throw new Error(text || response.status); });
+		}
+		return response.json();
+	})
+	.then(data => waitForCommand(data.id, button, item, category))
+	.catch(error => {
+		console.error('Ошибка при запросе сканирования:', error);
+		alert('Ошибка при запросе сканирования: ' + error.message);
+		button.disabled = false;
+		button.textContent = '⚡ Сканировать';
+	});
+}
+
+function waitForCommand(id, button, item, category) {
+	fetch('/command?id=' + id)
+	.then(response => response.json())
+	.then(cmd => {
+		switch (cmd.Status) {
+		case 'succeeded':
+			window.location.href = '/?tab=item_search&item_search=' + encodeURIComponent(item) + '&category_' + category + '=1';
+			return;
+		case 'failed':
+		case 'cancelled':
+			alert('Сканирование не выполнено: ' + (cmd.Error || cmd.Status));
+			button.disabled = false;
+			button.textContent = '⚡ Сканировать';
+			return;
+		case 'running':
+			button.textContent = '🔍 Сканируется';
+			break;
+		}
+		setTimeout(() => waitForCommand(id, button, item, category), 2000);
+	})
+	.catch(error => {
+		console.error('Ошибка получения команды:', error);
+		setTimeout(() => waitForCommand(id, button, item, category), 5000);
+	});
+}
+
+// reviewItem подтверждает (accept) или исправляет (correct) предложение из очереди проверки
+// и убирает его строку из таблицы
+function reviewItem(button, action) {
+	const row = button.closest('.review-row');
+	const body = new URLSearchParams({ id: row.dataset.id });
+	if (action === 'correct') {
+		row.querySelectorAll('.review-input').forEach(input => body.append(input.name, input.value));
+	}
+
+	row.querySelectorAll('button').forEach(b => b.disabled = true);
+	fetch('/review/' + action, { method: 'POST', body: body })
+	.then(response => {
+		if (!response.ok) {
+			return response.text().then(text => { throw new Error(text || response.status); });
+		}
+		row.remove();
+	})
+	.catch(error => {
+		console.error('Ошибка проверки предложения:', error);
+		alert('Ошибка проверки предложения: ' + error.message);
+		row.querySelectorAll('button').forEach(b => b.disabled = false);
+	});
+}
+
+// Предложения, показанные в окне детального просмотра; по ним заполняется форма исправления
+let detailModalItems = [];
+
+// fieldValue возвращает значение поля field предложения в виде, в котором его принимает /corrections
+function fieldValue(item, field) {
+	switch (field) {
+	case 'title_short':
+		return item.titleShort || '';
+	case 'package':
+		return item.package ? '1' : '0';
+	default:
+		return item[field] || '';
+	}
+}
+
+// openCorrection открывает форму исправления предложения id и загружает историю его исправлений
+function openCorrection(id) {
+	const item = detailModalItems.find(i => i.id === id);
+	if (!item) return;
+
+	const field = document.getElementById('correctionField');
+	document.getElementById('correctionItemId').value = id;
+	document.getElementById('correctionItemTitle').textContent = '#' + id + ' ' + (item.title || '');
+	document.getElementById('correctionValue').value = fieldValue(item, field.value);
+	document.getElementById('correctionComment').value = '';
+	field.onchange = () => {
+		document.getElementById('correctionValue').value = fieldValue(item, field.value);
+	};
+
+	const section = document.getElementById('correctionSection');
+	section.style.display = 'block';
+	section.scrollIntoView({ behavior: 'smooth' });
+	loadCorrectionHistory(id);
+}
+
+function loadCorrectionHistory(id) {
+	const history = document.getElementById('correctionHistory');
+	fetch('/corrections?item_id=' + id)
+	.then(response => {
+		if (!response.ok) {
+			return response.text().then(text => { throw new Error(text || response.status); });
+		}
+		return response.json();
+	})
+	.then(list => {
+		if (!list || list.length === 0) {
+			history.innerHTML = '<p>Исправлений еще не было</p>';
+			return;
+		}
+		let html = '<table class="structured-table"><thead><tr><th>Поле</th><th>Было</th><th>Стало</th><th>Комментарий</th><th>Когда</th></tr></thead><tbody>';
+		list.forEach(c => {
+			html += '<tr><td>' + escapeHTML(c.Field) + '</td><td>' + escapeHTML(c.CurrentValue) + '</td><td>' + escapeHTML(c.CorrectedValue) + '</td><td>' + escapeHTML(c.Comment) + '</td><td>' + new Date(c.CreatedAt).toLocaleString('ru-RU') + '</td></tr>';
+		});
+		history.innerHTML = html + '</tbody></table>';
+	})
+	.catch(error => {
+		console.error('Ошибка получения истории исправлений:', error);
+		history.innerHTML = '<p>Не удалось загрузить историю исправлений</p>';
+	});
+}
+
+// saveCorrection записывает исправление поля; поиск и метрики покажут исправленное значение
+function saveCorrection() {
+	const id = parseInt(document.getElementById('correctionItemId').value, 10);
+	const field = document.getElementById('correctionField').value;
+	const value = document.getElementById('correctionValue').value;
+	const body = new URLSearchParams({
+		item_id: id,
+		field: field,
+		value: value,
+		comment: document.getElementById('correctionComment').value
+	});
+
+	fetch('/corrections', { method: 'POST', body: body })
+	.then(response => {
+		if (!response.ok) {
+			return response.text().then(text => { throw new Error(text || response.status); });
+		}
+		return response.json();
+	})
+	.then(correction => {
+		const item = detailModalItems.find(i => i.id === id);
+		if (item) {
+			if (field === 'title_short') {
+				item.titleShort = correction.CorrectedValue;
+			} else if (field === 'package') {
+				item.package = correction.CorrectedValue === '1';
+			} else {
+				item[field] = correction.CorrectedValue;
+			}
+			item.corrected = true;
+		}
+		document.getElementById('correctionComment').value = '';
+		loadCorrectionHistory(id);
+	})
+	.catch(error => {
+		console.error('Ошибка сохранения исправления:', error);
+		alert('Ошибка сохранения исправления: ' + error.message);
+	});
+}
+
+function escapeHTML(s) {
+	const div = document.createElement('div');
+	div.textContent = s || '';
+	return div.innerHTML;
+}
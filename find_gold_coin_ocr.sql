@@ -17,7 +17,7 @@ SELECT
     si.count,
     si.package
 FROM octopus.ocr_results ocr
-INNER JOIN octopus.structured_items si ON ocr.id = si.ocr_result_id
+INNER JOIN octopus.structured_items_corrected si ON ocr.id = si.ocr_result_id
 WHERE si.title = 'gold coin' 
   AND si.category = 'buy_consumables'
 ORDER BY ocr.created_at DESC;
@@ -28,7 +28,7 @@ SELECT DISTINCT
     si.title,
     si.category
 FROM octopus.ocr_results ocr
-INNER JOIN octopus.structured_items si ON ocr.id = si.ocr_result_id
+INNER JOIN octopus.structured_items_corrected si ON ocr.id = si.ocr_result_id
 WHERE si.title = 'gold coin' 
   AND si.category = 'buy_consumables'
 ORDER BY ocr.id;
@@ -39,7 +39,7 @@ SELECT
     si.category,
     COUNT(DISTINCT ocr.id) as total_ocr_results
 FROM octopus.ocr_results ocr
-INNER JOIN octopus.structured_items si ON ocr.id = si.ocr_result_id
+INNER JOIN octopus.structured_items_corrected si ON ocr.id = si.ocr_result_id
 WHERE si.title = 'gold coin' 
   AND si.category = 'buy_consumables'
 GROUP BY si.title, si.category;
@@ -53,7 +53,7 @@ SELECT
     MIN(ocr.created_at) as first_seen,
     MAX(ocr.created_at) as last_seen
 FROM octopus.ocr_results ocr
-INNER JOIN octopus.structured_items si ON ocr.id = si.ocr_result_id
+INNER JOIN octopus.structured_items_corrected si ON ocr.id = si.ocr_result_id
 WHERE si.title = 'gold coin' 
   AND si.category = 'buy_consumables'
 GROUP BY si.title, si.category, si.price
@@ -64,7 +64,7 @@ WITH gold_coin_ocr AS (
     -- Находим все ocr_results для gold coin в buy_consumables
     SELECT DISTINCT ocr.id as ocr_id
     FROM octopus.ocr_results ocr
-    INNER JOIN octopus.structured_items si ON ocr.id = si.ocr_result_id
+    INNER JOIN octopus.structured_items_corrected si ON ocr.id = si.ocr_result_id
     WHERE si.title = 'gold coin' 
       AND si.category = 'buy_consumables'
 ),
@@ -80,12 +80,10 @@ price_analysis AS (
         si.count,
         si.package,
         -- Преобразуем цену в числовое значение для сортировки
-        CAST(REPLACE(REPLACE(si.price, ',', ''), ' ', '') AS DECIMAL(15,2)) as price_numeric
+        si.price_value as price_numeric
     FROM gold_coin_ocr gco
-    INNER JOIN octopus.structured_items si ON gco.ocr_id = si.ocr_result_id
-    WHERE si.price IS NOT NULL 
-      AND si.price != ''
-      AND CAST(REPLACE(REPLACE(si.price, ',', ''), ' ', '') AS DECIMAL(15,2)) > 0
+    INNER JOIN octopus.structured_items_corrected si ON gco.ocr_id = si.ocr_result_id
+    WHERE si.price_value > 0
 ),
 top_3_prices AS (
     -- Выбираем 3 минимальные цены для каждого ocr_result
@@ -6,12 +6,10 @@ SELECT
     ocr.id as ocr_id,
     si.title,
     si.category,
-    CAST(REPLACE(REPLACE(si.price, ',', ''), ' ', '') AS DECIMAL(15,2)) as price_value
+    si.price_value
 FROM octopus.ocr_results ocr
-INNER JOIN octopus.structured_items si ON ocr.id = si.ocr_result_id
+INNER JOIN octopus.structured_items_corrected si ON ocr.id = si.ocr_result_id
 WHERE si.title = 'gold coin' 
   AND si.category = 'buy_consumables'
-  AND si.price IS NOT NULL 
-  AND si.price != ''
-  AND CAST(REPLACE(REPLACE(si.price, ',', ''), ' ', '') AS DECIMAL(15,2)) > 0
+  AND si.price_value > 0
 ORDER BY ocr.created_at ASC; 
\ No newline at end of file
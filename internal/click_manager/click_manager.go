@@ -43,6 +43,12 @@ func NewClickManager(port *serial.Port, config *config.Config, marginX, marginY
 	}
 }
 
+// SetMargins обновляет отступы окна брокера (например, после повторного поиска окна)
+func (m *ClickManager) SetMargins(marginX, marginY int) {
+	m.marginX = marginX
+	m.marginY = marginY
+}
+
 // FocusL2Window фокусирует окно L2, кликая по координатам Item1
 func (m *ClickManager) FocusL2Window() {
 	finalCoordinates := image.Point{
@@ -0,0 +1,280 @@
+package commands
+
+import (
+	"database/sql"
+	"fmt"
+	"shnyr/internal/model"
+	"time"
+)
+
+// Status представляет состояние команды в очереди
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusClaimed   Status = "claimed"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Команды, которые понимает бот
+const (
+	Start   = "start"
+	Stop    = "stop"
+	Restart = "restart"
+	Pause   = "pause"
+	Resume  = "resume"
+	// ScanItem - сканирование одного предмета одной категории, аргументы - ScanItemArgs
+	ScanItem = "scan_item"
+)
+
+// ScanItemArgs - аргументы команды scan_item
+type ScanItemArgs struct {
+	Item     string         `json:"item"`
+	Category model.Category `json:"category"`
+}
+
+// Command представляет одну запись таблицы commands
+type Command struct {
+	ID         int64
+	Command    string
+	Instance   string // пустая строка - команда для любого экземпляра бота
+	Args       string // аргументы команды в JSON
+	Status     Status
+	ClaimedBy  string
+	Result     string
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// Enqueue добавляет команду в очередь. Пустой instance - команда для любого экземпляра бота.
+func Enqueue(db *sql.DB, command string, instance string) (int64, error) {
+	return EnqueueWithArgs(db, command, "", instance)
+}
+
+// EnqueueWithArgs добавляет команду с аргументами args (JSON) в очередь
+func EnqueueWithArgs(db *sql.DB, command string, args string, instance string) (int64, error) {
+	res, err := db.Exec("INSERT INTO commands (command, args, instance) VALUES (?, ?, ?)", command, nullString(args), nullString(instance))
+	if err != nil {
+		return 0, fmt.Errorf("ошибка добавления команды %s: %v", command, err)
+	}
+	return res.LastInsertId()
+}
+
+// Get возвращает команду по ID
+func Get(db *sql.DB, id int64) (*Command, error) {
+	list, err := queryCommands(db, "WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("команда %d не найдена", id)
+	}
+	return &list[0], nil
+}
+
+// Recent возвращает последние команды очереди
+func Recent(db *sql.DB, limit int) ([]Command, error) {
+	return queryCommands(db, "ORDER BY id DESC LIMIT ?", limit)
+}
+
+func queryCommands(db *sql.DB, where string, args ...interface{}) ([]Command, error) {
+	rows, err := db.Query(`SELECT id, command, args, instance, status, claimed_by, result, error, created_at, finished_at
+		FROM commands `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения команд: %v", err)
+	}
+	defer rows.Close()
+
+	var list []Command
+	for rows.Next() {
+		var cmd Command
+		var status string
+		var cmdArgs, instance, claimedBy, result, errText sql.NullString
+		var finishedAt sql.NullTime
+		err := rows.Scan(&cmd.ID, &cmd.Command, &cmdArgs, &instance, &status, &claimedBy, &result, &errText, &cmd.CreatedAt, &finishedAt)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения команды: %v", err)
+		}
+		cmd.Status = Status(status)
+		cmd.Args = cmdArgs.String
+		cmd.Instance = instance.String
+		cmd.ClaimedBy = claimedBy.String
+		cmd.Result = result.String
+		cmd.Error = errText.String
+		if finishedAt.Valid {
+			cmd.FinishedAt = &finishedAt.Time
+		}
+		list = append(list, cmd)
+	}
+	return list, rows.Err()
+}
+
+// Queue - очередь команд с точки зрения одного экземпляра бота
+type Queue struct {
+	db       *sql.DB
+	instance string
+}
+
+// NewQueue создает очередь для экземпляра бота instance
+func NewQueue(db *sql.DB, instance string) *Queue {
+	return &Queue{
+		db:       db,
+		instance: instance,
+	}
+}
+
+// Instance возвращает имя экземпляра бота, от которого забираются команды
+func (q *Queue) Instance() string {
+	return q.instance
+}
+
+// Claim атомарно забирает самую старую ожидающую команду из allowed.
+// Возвращает nil, если подходящих команд нет.
+func (q *Queue) Claim(allowed ...string) (*Command, error) {
+	return q.ClaimMatching(nil, allowed...)
+}
+
+// claimPageSize - сколько ожидающих команд ClaimMatching читает за один запрос
+const claimPageSize = 20
+
+// ClaimMatching забирает самую старую ожидающую команду из allowed, для которой match возвращает true.
+// match == nil подходит для любой команды. Очередь просматривается страницами, пока подходящая
+// команда не будет забрана или ожидающие команды не закончатся.
+func (q *Queue) ClaimMatching(match func(cmd *Command) bool, allowed ...string) (*Command, error) {
+	if len(allowed) == 0 {
+		return nil, nil
+	}
+	placeholders := "?"
+	for i := 1; i < len(allowed); i++ {
+		placeholders += ", ?"
+	}
+
+	var afterID int64
+	for {
+		args := []interface{}{q.instance, afterID}
+		for _, name := range allowed {
+			args = append(args, name)
+		}
+		rows, err := q.db.Query(`SELECT id, command, args, created_at FROM commands
+			WHERE status = 'pending' AND (instance IS NULL OR instance = ?) AND id > ? AND command IN (`+placeholders+`)
+			ORDER BY id LIMIT ?`, append(args, claimPageSize)...)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка выборки команд: %v", err)
+		}
+		var candidates []Command
+		read := 0
+		for rows.Next() {
+			var cmd Command
+			var cmdArgs sql.NullString
+			if err := rows.Scan(&cmd.ID, &cmd.Command, &cmdArgs, &cmd.CreatedAt); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("ошибка чтения команды: %v", err)
+			}
+			read++
+			afterID = cmd.ID
+			cmd.Args = cmdArgs.String
+			if match != nil && !match(&cmd) {
+				continue
+			}
+			candidates = append(candidates, cmd)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("ошибка чтения команд: %v", err)
+		}
+
+		cmd, err := q.claimFirst(candidates)
+		if cmd != nil || err != nil {
+			return cmd, err
+		}
+		if read < claimPageSize {
+			return nil, nil
+		}
+	}
+}
+
+// claimFirst забирает первую из candidates, которую еще не забрал другой экземпляр
+func (q *Queue) claimFirst(candidates []Command) (*Command, error) {
+	// Команду забирает тот, чей UPDATE изменил строку: так два экземпляра не заберут одну команду
+	for _, cmd := range candidates {
+		res, err := q.db.Exec(`UPDATE commands SET status = 'claimed', claimed_by = ?, claimed_at = NOW()
+			WHERE id = ? AND status = 'pending'`, q.instance, cmd.ID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка захвата команды %d: %v", cmd.ID, err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка захвата команды %d: %v", cmd.ID, err)
+		}
+		if affected == 1 {
+			cmd.Status = StatusClaimed
+			cmd.ClaimedBy = q.instance
+			return &cmd, nil
+		}
+	}
+	return nil, nil
+}
+
+// Recover разбирает команды, оставшиеся от прошлого завершения экземпляра: забранные, но не начатые,
+// возвращаются в очередь, а выполнявшиеся завершаются ошибкой. Возвращает число возвращенных и завершенных команд.
+func (q *Queue) Recover() (int64, int64, error) {
+	res, err := q.db.Exec(`UPDATE commands SET status = 'pending', claimed_by = NULL, claimed_at = NULL
+		WHERE status = 'claimed' AND claimed_by = ?`, q.instance)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка возврата забранных команд в очередь: %v", err)
+	}
+	requeued, _ := res.RowsAffected()
+
+	res, err = q.db.Exec(`UPDATE commands SET status = 'failed', error = 'бот завершился во время выполнения', finished_at = NOW()
+		WHERE status = 'running' AND claimed_by = ?`, q.instance)
+	if err != nil {
+		return requeued, 0, fmt.Errorf("ошибка закрытия оборванных команд: %v", err)
+	}
+	failed, _ := res.RowsAffected()
+	return requeued, failed, nil
+}
+
+// Start помечает забранную команду как выполняющуюся
+func (q *Queue) Start(id int64) error {
+	_, err := q.db.Exec("UPDATE commands SET status = 'running', started_at = NOW() WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления команды %d: %v", id, err)
+	}
+	return nil
+}
+
+// Succeed завершает команду успешно с результатом result
+func (q *Queue) Succeed(id int64, result string) error {
+	return q.finish(id, StatusSucceeded, result, "")
+}
+
+// Fail завершает команду с ошибкой
+func (q *Queue) Fail(id int64, cause error) error {
+	return q.finish(id, StatusFailed, "", cause.Error())
+}
+
+// Cancel отменяет команду, не выполняя ее
+func (q *Queue) Cancel(id int64, reason string) error {
+	return q.finish(id, StatusCancelled, "", reason)
+}
+
+// finish записывает конечное состояние команды
+func (q *Queue) finish(id int64, status Status, result string, errText string) error {
+	_, err := q.db.Exec("UPDATE commands SET status = ?, result = ?, error = ?, finished_at = NOW() WHERE id = ?",
+		string(status), nullString(result), nullString(errText), id)
+	if err != nil {
+		return fmt.Errorf("ошибка завершения команды %d: %v", id, err)
+	}
+	return nil
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -48,27 +48,108 @@ type Click struct {
 	Scroll  image.Point `mapstructure:"scroll"`
 }
 
+// Правило расписания сканирования, например:
+// {name: sell_equipment, categories: [sell_equipment], every: 1h, between: "10:00-02:00"}
+type ScheduleRule struct {
+	Name       string   `mapstructure:"name"`
+	Categories []string `mapstructure:"categories"`
+	Every      string   `mapstructure:"every"`   // Интервал в формате time.ParseDuration: 20m, 1h
+	Between    string   `mapstructure:"between"` // Необязательное окно времени ЧЧ:ММ-ЧЧ:ММ, может переходить через полночь
+}
+
+// Настройки приоритизации предметов в cycle_listed_items
+type Prioritizer struct {
+	Enabled         bool    `mapstructure:"enabled"`
+	CycleBudget     string  `mapstructure:"cycle_budget"` // Бюджет времени на проход, например 15m; пусто - все предметы
+	StaleAfter      string  `mapstructure:"stale_after"`  // Через сколько предмет считается полностью устаревшим, по умолчанию 1h
+	VarianceWeight  float64 `mapstructure:"variance_weight"`
+	StalenessWeight float64 `mapstructure:"staleness_weight"`
+	ProximityWeight float64 `mapstructure:"proximity_weight"`
+}
+
+// Колонка таблицы предложений: отступ слева и ширина в пикселях обрезанного изображения
+type Column struct {
+	X     int `mapstructure:"x"`
+	Width int `mapstructure:"width"`
+}
+
+// Построчное распознавание таблицы предложений: каждая строка и колонка распознаются отдельно
+type OfferRows struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Name    Column `mapstructure:"name"` // название вместе с улучшением (+N)
+	Price   Column `mapstructure:"price"`
+	Count   Column `mapstructure:"count"`
+	Owner   Column `mapstructure:"owner"`
+	RowGap  int    `mapstructure:"row_gap"` // строки текста ближе этого расстояния относятся к одному предложению, по умолчанию 15
+}
+
+// Кэш результатов OCR по содержимому изображения: одинаковые страницы не распознаются повторно
+type OCRCache struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Store   string `mapstructure:"store"`   // file (по умолчанию) или db - таблица ocr_cache
+	Dir     string `mapstructure:"dir"`     // Каталог кэша для store: file, по умолчанию ./ocr_cache
+	Version string `mapstructure:"version"` // Дописывается к версии движка; смена значения сбрасывает кэш, например после обновления HTTP-сервиса
+}
+
+// Настройки конвейера захват → OCR → сохранение
+type Pipeline struct {
+	Workers   int `mapstructure:"workers"`    // Число параллельных распознаваний, по умолчанию 2
+	QueueSize int `mapstructure:"queue_size"` // Размер очередей между этапами, по умолчанию 4
+}
+
+// Настройки движка OCR, например:
+// {engine: tesseract, tesseract_path: tesseract, tesseract_lang: eng}
+type OCR struct {
+	Engine        string    `mapstructure:"engine"`         // cpp_ocr (по умолчанию), tesseract, http, glyph или stub
+	CppOCRPath    string    `mapstructure:"cpp_ocr_path"`   // Путь к cpp_ocr.exe
+	TesseractPath string    `mapstructure:"tesseract_path"` // Путь к tesseract, по умолчанию ищется в PATH
+	TesseractLang string    `mapstructure:"tesseract_lang"` // Языки tesseract, по умолчанию eng
+	TesseractPSM  int       `mapstructure:"tesseract_psm"`  // Режим сегментации страницы tesseract, по умолчанию 6
+	HTTPURL       string    `mapstructure:"http_url"`       // Адрес HTTP-сервиса OCR, принимающего PNG и отвечающего JSON
+	HTTPTimeout   string    `mapstructure:"http_timeout"`   // Таймаут запроса к HTTP-сервису, по умолчанию 30s
+	StubDir       string    `mapstructure:"stub_dir"`       // Каталог с заготовленными JSON-ответами для stub
+	GlyphSet      string    `mapstructure:"glyph_set"`      // Набор глифов для движка glyph, собирается командой glyph_trainer
+	Rows          OfferRows `mapstructure:"rows"`
+	Cache         OCRCache  `mapstructure:"cache"`
+}
+
 // Основная структура конфигурации
 type Config struct {
+	InstanceName                             string `mapstructure:"instance_name"` // Имя экземпляра бота для очереди команд (по умолчанию - имя хоста)
+	DSN                                      string `mapstructure:"dsn"`           // Строка подключения к MySQL; переопределяется флагом -dsn и SHNYR_DSN
+	LogFormat                                string `mapstructure:"log_format"`    // Формат лога: text (по умолчанию) или json
 	Port                                     string `mapstructure:"port"`
 	PortObj                                  *serial.Port
-	BaudRate                                 int        `mapstructure:"baud_rate"`
-	WindowTopOffset                          int        `mapstructure:"window_top_offset"`
-	ListButtonBottomYCoordinate              int        `mapstructure:"list_button_bottom_y_coordinate"`
-	MaxCyclesItemsList                       int        `mapstructure:"max_cycles_items_list"`
-	LogFilePath                              string     `mapstructure:"log_file_path"`
-	Screenshot                               Screenshot `mapstructure:"screenshot"`
-	Click                                    Click      `mapstructure:"click"`
-	SaveToDB                                 int        `mapstructure:"save_to_db"`
-	SaveAllScreenshots                       int        `mapstructure:"save_all_screenshots"`
-	ScrollBottomCheckPixelX                  int        `mapstructure:"scroll_bottom_check_pixel_x"`
-	ScrollBottomCheckPixelYScroll            int        `mapstructure:"scroll_bottom_check_pixel_y_scroll"`
-	BackButtonImageCropHeight                int        `mapstructure:"back_button_image_crop_height"`
-	BackButtonWithListButtonsImageCropHeight int        `mapstructure:"back_button_with_list_buttons_image_crop_height"`
-	ItemsImgsWidth                           int        `mapstructure:"items_imgs_width"`
-	ScrollWidth                              int        `mapstructure:"scroll_width"`
-	StartButtonIndex                         int        `mapstructure:"start_button_index"`
-	StartItemIndex                           int        `mapstructure:"start_item_index"` // Номер предмета (начиная с 1)
+	BaudRate                                 int            `mapstructure:"baud_rate"`
+	WindowTopOffset                          int            `mapstructure:"window_top_offset"`
+	ListButtonBottomYCoordinate              int            `mapstructure:"list_button_bottom_y_coordinate"`
+	MaxCyclesItemsList                       int            `mapstructure:"max_cycles_items_list"`
+	LogFilePath                              string         `mapstructure:"log_file_path"`
+	Screenshot                               Screenshot     `mapstructure:"screenshot"`
+	Click                                    Click          `mapstructure:"click"`
+	SaveToDB                                 int            `mapstructure:"save_to_db"`
+	SaveAllScreenshots                       int            `mapstructure:"save_all_screenshots"`
+	ScrollBottomCheckPixelX                  int            `mapstructure:"scroll_bottom_check_pixel_x"`
+	ScrollBottomCheckPixelYScroll            int            `mapstructure:"scroll_bottom_check_pixel_y_scroll"`
+	BackButtonImageCropHeight                int            `mapstructure:"back_button_image_crop_height"`
+	BackButtonWithListButtonsImageCropHeight int            `mapstructure:"back_button_with_list_buttons_image_crop_height"`
+	ItemsImgsWidth                           int            `mapstructure:"items_imgs_width"`
+	ScrollWidth                              int            `mapstructure:"scroll_width"`
+	StartButtonIndex                         int            `mapstructure:"start_button_index"`
+	StartItemIndex                           int            `mapstructure:"start_item_index"` // Номер предмета (начиная с 1)
+	Schedule                                 []ScheduleRule `mapstructure:"schedule"`
+	Prioritizer                              Prioritizer    `mapstructure:"prioritizer"`
+	OCR                                      OCR            `mapstructure:"ocr"`
+	Pipeline                                 Pipeline       `mapstructure:"pipeline"`
+	SpoolDir                                 string         `mapstructure:"spool_dir"` // Каталог спула результатов OCR, по умолчанию ./spool
+}
+
+// configFile - путь к файлу конфигурации; пустая строка - config.yaml в текущей директории
+var configFile string
+
+// SetConfigFile задает путь к файлу конфигурации до вызова InitConfig
+func SetConfigFile(path string) {
+	configFile = path
 }
 
 var InitConfig = func() (error, Config) {
@@ -76,6 +157,9 @@ var InitConfig = func() (error, Config) {
 	viper.SetConfigName("config") // Имя конфигурационного файла без расширения
 	viper.AddConfigPath(".")      // Путь к файлу конфигурации
 	viper.SetConfigType("yaml")   // Формат файла
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	}
 
 	// Чтение конфигурации
 	if err := viper.ReadInConfig(); err != nil {
@@ -96,3 +180,16 @@ var InitConfig = func() (error, Config) {
 
 	return nil, config
 }
+
+// ReloadConfig перечитывает config.yaml во время работы программы.
+// В отличие от InitConfig не завершает процесс при ошибке, а возвращает ее.
+func ReloadConfig() (Config, error) {
+	var config Config
+	if err := viper.ReadInConfig(); err != nil {
+		return config, fmt.Errorf("ошибка чтения config.yaml: %v", err)
+	}
+	if err := viper.Unmarshal(&config); err != nil {
+		return config, fmt.Errorf("ошибка разбора config.yaml: %v", err)
+	}
+	return config, nil
+}
@@ -0,0 +1,197 @@
+package corrections
+
+import (
+	"database/sql"
+	"fmt"
+	"shnyr/internal/model"
+	"shnyr/internal/price"
+	"strings"
+	"time"
+)
+
+// View - представление structured_items текущей версии обработки с примененными исправлениями.
+// Поиск, метрики и выгрузки читают его вместо structured_items: исходные значения OCR при исправлении
+// не меняются, а предложения прежних версий обработки (cmd/reprocess) остаются для сравнения.
+const View = "structured_items_corrected"
+
+// Fields - поля structured_items, которые можно исправить. Представление View перечисляет их явно:
+// новое поле требует миграции, пересоздающей представление (internal/migrations).
+var Fields = []string{"title", "title_short", "enhancement", "price", "package", "owner", "count", "category"}
+
+// substitutionFields - текстовые поля, повторяющиеся исправления которых попадают в словарь замен OCR.
+// Числа в словарь не попадают: одинаковая ошибка в разных ценах встречается реже, чем совпадение цен.
+var substitutionFields = []string{"title", "title_short", "owner"}
+
+// DefaultMinRepeats - сколько разных предложений должны получить одинаковое исправление, чтобы оно попало в словарь замен
+const DefaultMinRepeats = 3
+
+// Correction - одна запись истории исправлений item_corrections
+type Correction struct {
+	ID             int64
+	ItemID         int
+	Field          string
+	CurrentValue   string // значение поля до исправления (с учетом предыдущих исправлений)
+	CorrectedValue string
+	Comment        string
+	CreatedAt      time.Time
+}
+
+// IsField проверяет, что field - исправимое поле structured_items
+func IsField(field string) bool {
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Querier - *sql.DB или *sql.Tx: несколько исправлений одного предложения записываются одной транзакцией
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Validate проверяет значение поля field и возвращает его в том виде, в каком оно записывается,
+// и числовую цену для corrected_price_value (nil для остальных полей)
+func Validate(field, value string) (string, interface{}, error) {
+	if !IsField(field) {
+		return "", nil, fmt.Errorf("поле %s нельзя исправить", field)
+	}
+	value = strings.TrimSpace(value)
+
+	var priceValue interface{}
+	switch field {
+	case "title", "price":
+		if value == "" {
+			return "", nil, fmt.Errorf("пустое значение поля %s", field)
+		}
+	}
+	switch field {
+	case "price":
+		parsed, err := price.Parse(value)
+		if err != nil {
+			return "", nil, err
+		}
+		priceValue = parsed
+	case "enhancement", "count":
+		parse := model.ParseEnhancement
+		if field == "count" {
+			parse = model.ParseCount
+		}
+		if _, err := parse(value); err != nil {
+			return "", nil, err
+		}
+	case "category":
+		if _, err := model.ParseCategory(value); err != nil {
+			return "", nil, err
+		}
+	case "package":
+		switch strings.ToLower(value) {
+		case "1", "true", "да":
+			value = "1"
+		case "0", "false", "нет", "":
+			value = "0"
+		default:
+			return "", nil, fmt.Errorf("пакет должен быть 1 или 0, получено %q", value)
+		}
+	}
+	return value, priceValue, nil
+}
+
+// Record записывает исправление поля field предложения itemID. Текущее значение поля
+// (с учетом прежних исправлений) сохраняется в current_value, чтобы история читалась без structured_items.
+func Record(q Querier, itemID int, field, value, comment string) (*Correction, error) {
+	value, priceValue, err := Validate(field, value)
+	if err != nil {
+		return nil, err
+	}
+
+	var current sql.NullString
+	err = q.QueryRow("SELECT CAST("+field+" AS CHAR) FROM "+View+" WHERE id = ?", itemID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("предложение %d не найдено", itemID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения предложения %d: %v", itemID, err)
+	}
+	if current.Valid && current.String == value {
+		return nil, fmt.Errorf("значение поля %s не изменилось", field)
+	}
+
+	res, err := q.Exec("INSERT INTO item_corrections (item_id, field_name, current_value, corrected_value, corrected_price_value, comment) VALUES (?, ?, ?, ?, ?, ?)",
+		itemID, field, current, value, priceValue, nullString(comment))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка записи исправления: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return &Correction{ID: id, ItemID: itemID, Field: field, CurrentValue: current.String, CorrectedValue: value, Comment: comment, CreatedAt: time.Now()}, nil
+}
+
+// History возвращает историю исправлений предложения itemID по полям, от старых к новым
+func History(db *sql.DB, itemID int) ([]Correction, error) {
+	rows, err := db.Query(`SELECT id, item_id, field_name, COALESCE(current_value, ''), corrected_value, COALESCE(comment, ''), created_at
+		FROM item_corrections WHERE item_id = ? ORDER BY field_name, id`, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения истории исправлений: %v", err)
+	}
+	defer rows.Close()
+
+	var list []Correction
+	for rows.Next() {
+		var c Correction
+		if err := rows.Scan(&c.ID, &c.ItemID, &c.Field, &c.CurrentValue, &c.CorrectedValue, &c.Comment, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения исправления: %v", err)
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// Substitutions возвращает словарь замен для нормализатора OCR: поле -> распознанное значение -> исправленное.
+// Пара попадает в словарь, если исходное значение OCR одинаково исправлено не меньше чем у minRepeats предложений;
+// если одно значение исправляли по-разному, берется самое частое исправление.
+func Substitutions(db *sql.DB, minRepeats int) (map[string]map[string]string, error) {
+	original := "CASE c.field_name"
+	for _, field := range substitutionFields {
+		original += fmt.Sprintf(" WHEN '%s' THEN si.%s", field, field)
+	}
+	original += " END"
+
+	rows, err := db.Query(`SELECT c.field_name, `+original+` AS original, c.corrected_value, COUNT(*) AS repeats
+		FROM item_corrections c
+		INNER JOIN structured_items si ON si.id = c.item_id
+		WHERE c.field_name IN ('`+strings.Join(substitutionFields, "', '")+`')
+			AND c.id = (SELECT MAX(l.id) FROM item_corrections l WHERE l.item_id = c.item_id AND l.field_name = c.field_name)
+		GROUP BY c.field_name, original, c.corrected_value
+		HAVING repeats >= ? AND original <> '' AND original <> c.corrected_value
+		ORDER BY repeats DESC`, minRepeats)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения повторяющихся исправлений: %v", err)
+	}
+	defer rows.Close()
+
+	substitutions := make(map[string]map[string]string)
+	for rows.Next() {
+		var field, from, to string
+		var repeats int
+		if err := rows.Scan(&field, &from, &to, &repeats); err != nil {
+			return nil, fmt.Errorf("ошибка чтения исправления: %v", err)
+		}
+		if substitutions[field] == nil {
+			substitutions[field] = make(map[string]string)
+		}
+		// Строки отсортированы по убыванию повторов: первое исправление значения - самое частое
+		if _, ok := substitutions[field][from]; !ok {
+			substitutions[field][from] = to
+		}
+	}
+	return substitutions, rows.Err()
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"shnyr/internal/model"
+	"strconv"
+	"strings"
+)
+
+// DefaultCatalogFile - файл каталога предметов, который синхронизируется с items_list
+const DefaultCatalogFile = "items.txt"
+
+// CatalogItem - предмет каталога items.txt
+type CatalogItem struct {
+	Name     string
+	Category model.Category
+	MinPrice float64
+	Line     int // строка файла
+}
+
+// Действия синхронизации каталога с items_list
+const (
+	CatalogAdd     = "add"     // новый предмет
+	CatalogUpdate  = "update"  // изменилась минимальная цена или написание названия
+	CatalogRestore = "restore" // предмет вернулся в файл: снимается пометка удаления
+	CatalogRemove  = "remove"  // предмета нет в файле: помечается удаленным, id сохраняется
+)
+
+// CatalogChange - изменение одного предмета items_list
+type CatalogChange struct {
+	Action      string
+	ID          int // 0 - предмет еще не записан
+	Name        string
+	OldName     string // прежнее написание при update
+	Category    model.Category
+	OldMinPrice float64
+	MinPrice    float64
+}
+
+// CatalogDiff - разница между items.txt и items_list
+type CatalogDiff struct {
+	Changes   []CatalogChange
+	Moved     int // предметы, у которых изменился только порядок в файле
+	Unchanged int
+}
+
+// Count возвращает число изменений с действием action
+func (d *CatalogDiff) Count(action string) int {
+	count := 0
+	for _, change := range d.Changes {
+		if change.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Summary возвращает строку с числом изменений по действиям
+func (d *CatalogDiff) Summary() string {
+	return fmt.Sprintf("добавлено %d, изменено %d, восстановлено %d, удалено %d, перемещено %d, без изменений %d",
+		d.Count(CatalogAdd), d.Count(CatalogUpdate), d.Count(CatalogRestore), d.Count(CatalogRemove), d.Moved, d.Unchanged)
+}
+
+// ParseCatalog читает каталог в формате items.txt: строка "название:минимальная_цена", # - комментарий,
+// разделители --- (следующая категория) и === (продажа расходников). Первая категория - покупка расходников.
+// Неразобранная цена и повтор предмета в категории не прерывают чтение и возвращаются предупреждениями.
+func ParseCatalog(r io.Reader) ([]CatalogItem, []string, error) {
+	var items []CatalogItem
+	var warnings []string
+	seen := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	currentCategory := model.CategoryBuyConsumables
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Пропускаем пустые строки и комментарии
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch line {
+		case "---":
+			// Категории идут в порядке обхода; после продажи экипировки остаемся в ней
+			switch currentCategory {
+			case model.CategoryBuyConsumables:
+				currentCategory = model.CategoryBuyEquipment
+			case model.CategoryBuyEquipment:
+				currentCategory = model.CategorySellConsumables
+			case model.CategorySellConsumables, model.CategorySellEquipment:
+				currentCategory = model.CategorySellEquipment
+			}
+			continue
+		case "===":
+			currentCategory = model.CategorySellConsumables
+			continue
+		}
+
+		parts := strings.Split(line, ":")
+		item := CatalogItem{Name: strings.TrimSpace(parts[0]), Category: currentCategory, Line: lineNumber}
+		if len(parts) > 1 {
+			priceStr := strings.TrimSpace(parts[1])
+			if priceStr != "" {
+				if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
+					item.MinPrice = price
+				} else {
+					warnings = append(warnings, fmt.Sprintf("строка %d: ошибка парсинга цены '%s' для предмета '%s', цена 0", lineNumber, priceStr, item.Name))
+				}
+			}
+		}
+
+		key := catalogKey(item.Name, item.Category)
+		if first, ok := seen[key]; ok {
+			warnings = append(warnings, fmt.Sprintf("строка %d: предмет '%s' уже есть в категории %s на строке %d, повтор пропущен", lineNumber, item.Name, item.Category, first))
+			continue
+		}
+		seen[key] = lineNumber
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения каталога: %v", err)
+	}
+	return items, warnings, nil
+}
+
+// catalogKey - ключ предмета: уникальный ключ items_list (name, category) сравнивает названия без учета регистра
+func catalogKey(name string, category model.Category) string {
+	return strings.ToLower(name) + "\x00" + string(category)
+}
+
+// SyncItemsTable синхронизирует items_list с каталогом filename: добавляет новые предметы, обновляет минимальные цены
+// и порядок, помечает удаленными предметы, которых нет в файле. Id предметов сохраняются, поэтому ссылки
+// structured_items.item_list_id остаются. С dryRun только возвращает разницу, ничего не записывая.
+func (h *DatabaseManager) SyncItemsTable(filename string, dryRun bool) (*CatalogDiff, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла: %v", err)
+	}
+	defer file.Close()
+
+	items, warnings, err := ParseCatalog(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		h.logger.Info("⚠️ %s: %s", filename, warning)
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	type existingItem struct {
+		id       int
+		name     string
+		category model.Category
+		minPrice float64
+		position int
+		deleted  bool
+	}
+	rows, err := tx.Query("SELECT id, name, category, COALESCE(min_price, 0), position, deleted_at IS NOT NULL FROM items_list ORDER BY id FOR UPDATE")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения items_list: %v", err)
+	}
+	var existing []*existingItem
+	byKey := make(map[string]*existingItem)
+	for rows.Next() {
+		item := &existingItem{}
+		if err := rows.Scan(&item.id, &item.name, &item.category, &item.minPrice, &item.position, &item.deleted); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения items_list: %v", err)
+		}
+		existing = append(existing, item)
+		byKey[catalogKey(item.name, item.category)] = item
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения items_list: %v", err)
+	}
+
+	diff := &CatalogDiff{}
+	inCatalog := make(map[int]bool)
+	for i, item := range items {
+		position := i + 1
+		current, ok := byKey[catalogKey(item.Name, item.Category)]
+		if !ok {
+			diff.Changes = append(diff.Changes, CatalogChange{Action: CatalogAdd, Name: item.Name, Category: item.Category, MinPrice: item.MinPrice})
+			if !dryRun {
+				res, err := tx.Exec("INSERT INTO items_list (name, category, min_price, position) VALUES (?, ?, ?, ?)", item.Name, item.Category, item.MinPrice, position)
+				if err != nil {
+					return nil, fmt.Errorf("ошибка вставки предмета '%s' на строке %d: %v", item.Name, item.Line, err)
+				}
+				id, _ := res.LastInsertId()
+				diff.Changes[len(diff.Changes)-1].ID = int(id)
+			}
+			continue
+		}
+		inCatalog[current.id] = true
+
+		change := CatalogChange{ID: current.id, Name: item.Name, Category: item.Category, OldMinPrice: current.minPrice, MinPrice: item.MinPrice}
+		switch {
+		case current.deleted:
+			change.Action = CatalogRestore
+		case current.minPrice != item.MinPrice || current.name != item.Name:
+			change.Action = CatalogUpdate
+			if current.name != item.Name {
+				change.OldName = current.name
+			}
+		case current.position != position:
+			diff.Moved++
+		default:
+			diff.Unchanged++
+			continue
+		}
+		if change.Action != "" {
+			diff.Changes = append(diff.Changes, change)
+		}
+		if !dryRun {
+			_, err := tx.Exec("UPDATE items_list SET name = ?, min_price = ?, position = ?, deleted_at = NULL, updated_at = NOW() WHERE id = ?",
+				item.Name, item.MinPrice, position, current.id)
+			if err != nil {
+				return nil, fmt.Errorf("ошибка обновления предмета '%s' на строке %d: %v", item.Name, item.Line, err)
+			}
+		}
+	}
+
+	for _, item := range existing {
+		if item.deleted || inCatalog[item.id] {
+			continue
+		}
+		diff.Changes = append(diff.Changes, CatalogChange{Action: CatalogRemove, ID: item.id, Name: item.name, Category: item.category, OldMinPrice: item.minPrice})
+		if !dryRun {
+			if _, err := tx.Exec("UPDATE items_list SET deleted_at = NOW(), updated_at = NOW() WHERE id = ?", item.id); err != nil {
+				return nil, fmt.Errorf("ошибка удаления предмета '%s': %v", item.name, err)
+			}
+		}
+	}
+
+	if dryRun {
+		return diff, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+
+	// Сопоставитель названий перечитает каталог при следующем сохранении
+	h.matcherMu.Lock()
+	h.matcher = nil
+	h.matcherMu.Unlock()
+	return diff, nil
+}
@@ -1,22 +1,25 @@
 package database
 
 import (
-	"bufio"
 	"database/sql"
 	"fmt"
-	"os"
 	"shnyr/internal/config"
 	"shnyr/internal/logger"
-	"strconv"
-	"strings"
+	"shnyr/internal/matcher"
+	"shnyr/internal/model"
 	"sync"
+	"time"
 )
 
 // DatabaseManager содержит функции для работы с базой данных
 type DatabaseManager struct {
 	db     *sql.DB
 	logger *logger.LoggerManager
-	wg     sync.WaitGroup // для ожидания завершения асинхронных операций
+	spool  *Spool
+
+	matcherMu     sync.Mutex
+	matcher       *matcher.Matcher
+	matcherLoaded time.Time
 }
 
 // NewDatabaseManager создает новый экземпляр DatabaseManager
@@ -27,227 +30,153 @@ func NewDatabaseManager(db *sql.DB, loggerManager *logger.LoggerManager) *Databa
 	}
 }
 
-// SaveOCRResultToDB сохраняет результат OCR в базу данных
-func (h *DatabaseManager) SaveOCRResultToDB(imagePath, ocrResult string, debugInfo, jsonData string, rawText string, imageData []byte, cfg *config.Config, itemCategory string, currentItemName string) (int, error) {
+// SetSpool задает спул, через который сохраняются результаты OCR. Без спула результат пишется в базу напрямую.
+func (h *DatabaseManager) SetSpool(spool *Spool) {
+	h.spool = spool
+}
+
+// SaveOCRResultToDB сохраняет результат OCR в базу данных; cacheHit отмечает результат, взятый из кэша OCR.
+// Результат сначала попадает в спул на диске, затем ocr_results и structured_items записываются одной транзакцией.
+func (h *DatabaseManager) SaveOCRResultToDB(imagePath, ocrResult string, debugInfo, jsonData string, rawText string, imageData []byte, cfg *config.Config, itemCategory model.Category, currentItemName string, parse ParseReport, cacheHit bool) (int, error) {
 	// Проверяем настройку сохранения в БД
 	if cfg.SaveToDB != 1 {
 		h.logger.Info("Сохранение в БД отключено (save_to_db = %d)", cfg.SaveToDB)
 		return 0, nil
 	}
-	// Создаем таблицу, если она не существует
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS ocr_results (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		image_path VARCHAR(255) NOT NULL,
-		image_data LONGBLOB,
-		ocr_text LONGTEXT,
-		debug_info LONGTEXT,
-		json_data LONGTEXT,
-		raw_text LONGTEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	)`
-
-	_, err := h.db.Exec(createTableSQL)
-	if err != nil {
-		return 0, fmt.Errorf("ошибка создания таблицы: %v", err)
+
+	entry := &SpoolEntry{
+		ImagePath: imagePath,
+		OCRText:   ocrResult,
+		DebugInfo: debugInfo,
+		JSONData:  jsonData,
+		RawText:   rawText,
+		ImageData: imageData,
+		Category:  itemCategory,
+		ItemName:  currentItemName,
+		Parse:     parse,
+		CacheHit:  cacheHit,
+	}
+	if h.spool == nil {
+		return h.writeOCRResult(entry)
 	}
 
-	// Вставляем результат OCR с изображением
-	insertSQL := `INSERT INTO ocr_results (image_path, image_data, ocr_text, debug_info, json_data, raw_text) VALUES (?, ?, ?, ?, ?, ?)`
-	result, err := h.db.Exec(insertSQL, imagePath, imageData, ocrResult, debugInfo, jsonData, rawText)
-	if err != nil {
-		return 0, fmt.Errorf("ошибка вставки данных: %v", err)
+	if err := h.spool.Put(entry); err != nil {
+		return 0, err
 	}
+	return h.commitSpoolEntry(entry)
+}
 
-	// Получаем ID вставленной записи
-	ocrResultID, err := result.LastInsertId()
+// ReplaySpool записывает в базу результаты, оставшиеся в спуле после падения или ошибки базы.
+// Возвращает число записанных результатов; не записанные остаются в pending до следующего воспроизведения.
+func (h *DatabaseManager) ReplaySpool() (int, error) {
+	if h.spool == nil {
+		return 0, nil
+	}
+	entries, err := h.spool.Pending()
 	if err != nil {
-		return 0, fmt.Errorf("ошибка получения ID записи: %v", err)
+		return 0, err
 	}
 
-	h.logger.Info("✅ OCR результат сохранен с ID: %d", ocrResultID)
-
-	// Сохраняем структурированные данные асинхронно
-	if jsonData != "" {
-		h.logger.Info("🔧 Запускаем асинхронное сохранение структурированных данных для OCR ID: %d", ocrResultID)
-
-		// Запускаем асинхронное сохранение
-		h.wg.Add(1)
-		go func(ocrID int, jsonStr string) {
-			defer h.wg.Done()
-			err := SaveStructuredDataBatch(h.db, ocrID, jsonStr, itemCategory, currentItemName)
-			if err != nil {
-				h.logger.LogError(err, "Ошибка асинхронного сохранения структурированных данных")
-			} else {
-				h.logger.Info("✅ Структурированные данные успешно сохранены асинхронно для OCR ID: %d", ocrID)
-			}
-		}(int(ocrResultID), jsonData)
-	} else {
-		h.logger.Info("⚠️ JSON данные пустые, пропускаем сохранение structured items")
+	replayed := 0
+	for _, entry := range entries {
+		h.logger.Info("♻️ Воспроизводим результат OCR из спула: %s (%s)", entry.ID, entry.ImagePath)
+		if _, err := h.commitSpoolEntry(entry); err != nil {
+			continue
+		}
+		replayed++
 	}
-
-	h.logger.Info("OCR результат и изображение сохранены в базу данных для файла: %s (ID: %d)", imagePath, ocrResultID)
-	return int(ocrResultID), nil
+	return replayed, nil
 }
 
-// WaitForAsyncOperations ожидает завершения всех асинхронных операций сохранения
-func (h *DatabaseManager) WaitForAsyncOperations() {
-	h.logger.Info("⏳ Ожидаем завершения асинхронных операций сохранения...")
-	h.wg.Wait()
-	h.logger.Info("✅ Все асинхронные операции сохранения завершены")
-}
-
-// InitializeItemsTable создает таблицу предметов и инициализирует её из файла
-func (h *DatabaseManager) InitializeItemsTable() error {
-	h.logger.Info("🚀 Инициализация таблицы предметов...")
-
-	// Пересоздаем таблицу с новой структурой
-	err := h.RecreateItemsTable()
+// commitSpoolEntry записывает результат из спула в базу и убирает его из pending.
+// Пока база недоступна, результат остается в pending; если база отвечает, а запись не удалась
+// SpoolMaxAttempts раз, ошибка в самих данных и результат переносится в failed.
+func (h *DatabaseManager) commitSpoolEntry(entry *SpoolEntry) (int, error) {
+	id, err := h.writeOCRResult(entry)
 	if err != nil {
-		return err
+		if h.db.Ping() != nil || entry.Attempts+1 < SpoolMaxAttempts {
+			if postponeErr := h.spool.Postpone(entry, err); postponeErr != nil {
+				h.logger.LogError(postponeErr, "Ошибка обновления результата в спуле")
+			}
+			h.logger.LogError(err, fmt.Sprintf("Результат %s оставлен в спуле (%s), попытка %d", entry.ID, h.spool.Dir(), entry.Attempts))
+			return 0, err
+		}
+		if failErr := h.spool.Fail(entry, err); failErr != nil {
+			h.logger.LogError(failErr, "Ошибка переноса результата в failed")
+		}
+		h.logger.LogError(err, fmt.Sprintf("Результат %s перенесен в failed после %d попыток", entry.ID, entry.Attempts))
+		return 0, err
 	}
-
-	// Загружаем предметы из файла
-	err = h.loadItemsFromFile("items.txt")
-	if err != nil {
-		return err
+	if err := h.spool.Done(entry.ID); err != nil {
+		h.logger.LogError(err, "Ошибка удаления результата из спула")
 	}
-
-	h.logger.Info("✅ Таблица предметов инициализирована успешно")
-	return nil
+	return id, nil
 }
 
-// loadItemsFromFile загружает предметы из текстового файла
-func (h *DatabaseManager) loadItemsFromFile(filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("ошибка открытия файла: %v", err)
+// writeOCRResult записывает ocr_results и structured_items одной транзакцией.
+// Повторная запись результата из спула не создает дубликат: возвращается ID уже записанной строки.
+func (h *DatabaseManager) writeOCRResult(entry *SpoolEntry) (int, error) {
+	var spoolID interface{}
+	if entry.ID != "" {
+		spoolID = entry.ID
+		var existingID int
+		err := h.db.QueryRow("SELECT id FROM ocr_results WHERE spool_id = ?", entry.ID).Scan(&existingID)
+		if err == nil {
+			h.logger.Info("ℹ️ Результат %s уже записан с ID: %d", entry.ID, existingID)
+			return existingID, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, fmt.Errorf("ошибка проверки записи спула: %v", err)
+		}
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	// Без списка предметов предложения связываются только с искомым предметом
+	itemMatcher, err := h.itemMatcher()
+	if err != nil {
+		h.logger.LogError(err, "Ошибка загрузки списка предметов для сопоставления названий")
+	}
 
-	// Начинаем транзакцию
 	tx, err := h.db.Begin()
 	if err != nil {
-		return fmt.Errorf("ошибка начала транзакции: %v", err)
+		return 0, fmt.Errorf("ошибка начала транзакции: %v", err)
 	}
 	defer tx.Rollback()
 
-	// Подготавливаем запрос
-	stmt, err := tx.Prepare("INSERT IGNORE INTO items_list (name, category, min_price) VALUES (?, ?, ?)")
+	// Вставляем результат OCR с изображением
+	insertSQL := `INSERT INTO ocr_results (image_path, category, item_name, image_data, ocr_text, debug_info, json_data, raw_text, parse_status, parse_issues, spool_id, ocr_cache_hit)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(insertSQL, entry.ImagePath, nullIfEmpty(string(entry.Category)), nullIfEmpty(entry.ItemName), entry.ImageData, entry.OCRText, entry.DebugInfo, entry.JSONData, entry.RawText,
+		nullIfEmpty(entry.Parse.Status), nullIfEmpty(entry.Parse.Issues), spoolID, entry.CacheHit)
 	if err != nil {
-		return fmt.Errorf("ошибка подготовки запроса: %v", err)
+		return 0, fmt.Errorf("ошибка вставки данных: %v", err)
 	}
-	defer stmt.Close()
-
-	lineNumber := 0
-	currentCategory := "buy_consumables" // По умолчанию первая категория - покупка расходников
-	buyConsumablesCount := 0
-	buyEquipmentCount := 0
-	sellConsumablesCount := 0
-	sellEquipmentCount := 0
-
-	for scanner.Scan() {
-		lineNumber++
-		line := strings.TrimSpace(scanner.Text())
-
-		// Пропускаем пустые строки и комментарии
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// Проверяем разделители
-		switch line {
-		case "---":
-			// Определяем следующую категорию на основе текущей
-			switch currentCategory {
-			case "buy_consumables":
-				currentCategory = "buy_equipment"
-			case "buy_equipment":
-				// После buy_equipment переходим к sell_consumables
-				currentCategory = "sell_consumables"
-			case "sell_consumables":
-				currentCategory = "sell_equipment"
-			case "sell_equipment":
-				// Если уже в sell_equipment, остаемся там
-				currentCategory = "sell_equipment"
-			default:
-				// Если это первый разделитель, переходим к buy_equipment
-				currentCategory = "buy_equipment"
-			}
-			h.logger.Info("📋 Переключаемся на категорию: %s", currentCategory)
-			continue
-		case "===":
-			// Принудительно переходим к sell_consumables
-			currentCategory = "sell_consumables"
-			h.logger.Info("📋 Переключаемся на категорию: %s", currentCategory)
-			h.logger.Info("🔍 DEBUG: Найдем разделитель ===, переключаемся на sell_consumables")
-			continue
-		}
 
-		// Парсим строку в формате "название:цена"
-		parts := strings.Split(line, ":")
-		itemName := strings.TrimSpace(parts[0])
-		var minPrice float64 = 0
-
-		if len(parts) > 1 {
-			priceStr := strings.TrimSpace(parts[1])
-			if priceStr != "" {
-				if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
-					minPrice = price
-				} else {
-					h.logger.LogError(fmt.Errorf("ошибка парсинга цены '%s' для предмета '%s' на строке %d", priceStr, itemName, lineNumber), "")
-					// Продолжаем с ценой 0
-				}
-			}
-		}
+	// Получаем ID вставленной записи
+	ocrResultID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения ID записи: %v", err)
+	}
 
-		// Вставляем предмет с категорией и минимальной ценой
-		_, err := stmt.Exec(itemName, currentCategory, minPrice)
+	if entry.JSONData != "" {
+		err = saveStructuredItems(tx, int(ocrResultID), 1, entry.JSONData, entry.Category, entry.ItemName, itemMatcher)
 		if err != nil {
-			return fmt.Errorf("ошибка вставки предмета '%s' на строке %d: %v", itemName, lineNumber, err)
+			return 0, fmt.Errorf("ошибка сохранения структурированных данных: %v", err)
 		}
-
-		// Отладочное логирование для sell_consumables
-		if currentCategory == "sell_consumables" {
-			h.logger.Info("🔍 DEBUG: Вставляем предмет '%s' с категорией '%s' и ценой %.2f", itemName, currentCategory, minPrice)
-		}
-
-		// Подсчитываем количество предметов по категориям
-		switch currentCategory {
-		case "buy_consumables":
-			buyConsumablesCount++
-		case "buy_equipment":
-			buyEquipmentCount++
-		case "sell_consumables":
-			sellConsumablesCount++
-		case "sell_equipment":
-			sellEquipmentCount++
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("ошибка чтения файла: %v", err)
+	} else {
+		h.logger.Info("⚠️ JSON данные пустые, пропускаем сохранение structured items")
 	}
 
-	// Подтверждаем транзакцию
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка подтверждения транзакции: %v", err)
 	}
 
-	h.logger.Info("🔍 DEBUG: Транзакция подтверждена успешно")
-
-	h.logger.Info("📊 Загружено предметов: %d buy_consumables, %d buy_equipment, %d sell_consumables, %d sell_equipment",
-		buyConsumablesCount, buyEquipmentCount, sellConsumablesCount, sellEquipmentCount)
-
-	return nil
+	h.logger.Info("OCR результат и изображение сохранены в базу данных для файла: %s (ID: %d)", entry.ImagePath, ocrResultID)
+	return int(ocrResultID), nil
 }
 
 // GetItemsList возвращает список всех предметов из базы данных
 func (h *DatabaseManager) GetItemsList() ([]string, error) {
-	rows, err := h.db.Query("SELECT name FROM items_list ORDER BY id")
+	rows, err := h.db.Query("SELECT name FROM items_list WHERE deleted_at IS NULL ORDER BY position, id")
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса предметов: %v", err)
 	}
@@ -271,8 +200,8 @@ func (h *DatabaseManager) GetItemsList() ([]string, error) {
 }
 
 // GetItemsByCategory возвращает список предметов определенной категории
-func (h *DatabaseManager) GetItemsByCategory(category string) ([]string, error) {
-	rows, err := h.db.Query("SELECT name FROM items_list WHERE category = ? ORDER BY id", category)
+func (h *DatabaseManager) GetItemsByCategory(category model.Category) ([]string, error) {
+	rows, err := h.db.Query("SELECT name FROM items_list WHERE category = ? AND deleted_at IS NULL ORDER BY position, id", category)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса предметов категории %s: %v", category, err)
 	}
@@ -295,16 +224,17 @@ func (h *DatabaseManager) GetItemsByCategory(category string) ([]string, error)
 }
 
 // GetItemsWithCategories возвращает список предметов с их категориями
-func (h *DatabaseManager) GetItemsWithCategories() (map[string][]string, error) {
-	rows, err := h.db.Query("SELECT name, category FROM items_list ORDER BY category, id")
+func (h *DatabaseManager) GetItemsWithCategories() (map[model.Category][]string, error) {
+	rows, err := h.db.Query("SELECT name, category FROM items_list WHERE deleted_at IS NULL ORDER BY category, position, id")
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса предметов с категориями: %v", err)
 	}
 	defer rows.Close()
 
-	itemsByCategory := make(map[string][]string)
+	itemsByCategory := make(map[model.Category][]string)
 	for rows.Next() {
-		var itemName, category string
+		var itemName string
+		var category model.Category
 		err := rows.Scan(&itemName, &category)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка чтения предмета: %v", err)
@@ -319,113 +249,39 @@ func (h *DatabaseManager) GetItemsWithCategories() (map[string][]string, error)
 	return itemsByCategory, nil
 }
 
-// GetItemIDByName возвращает ID предмета по названию
-func (h *DatabaseManager) GetItemIDByName(itemName string) (int, error) {
+// GetItemIDByName возвращает ID активного предмета по названию и категории: один предмет может быть и в скупке, и в продаже
+func (h *DatabaseManager) GetItemIDByName(itemName string, category model.Category) (int, error) {
 	var id int
-	err := h.db.QueryRow("SELECT id FROM items_list WHERE name = ?", itemName).Scan(&id)
+	err := h.db.QueryRow("SELECT id FROM items_list WHERE name = ? AND category = ? AND deleted_at IS NULL", itemName, category).Scan(&id)
 	if err != nil {
-		return 0, fmt.Errorf("ошибка получения ID предмета '%s': %v", itemName, err)
+		return 0, fmt.Errorf("ошибка получения ID предмета '%s' (%s): %v", itemName, category, err)
 	}
 	return id, nil
 }
 
-// GetItemCategory возвращает категорию конкретного предмета
-func (h *DatabaseManager) GetItemCategory(itemName string) (string, error) {
-	var category string
-	err := h.db.QueryRow("SELECT category FROM items_list WHERE name = ?", itemName).Scan(&category)
-	if err != nil {
-		return "", fmt.Errorf("ошибка получения категории предмета '%s': %v", itemName, err)
-	}
-	return category, nil
-}
-
-func (h *DatabaseManager) RecreateItemsTable() error {
-	h.logger.Info("🔄 Пересоздаем таблицу items_list...")
-
-	// Удаляем внешний ключ, если он есть
-	_, err := h.db.Exec("ALTER TABLE structured_items DROP FOREIGN KEY structured_items_ibfk_2")
+// GetItemCategories возвращает категории, в которых активен предмет с названием itemName
+func (h *DatabaseManager) GetItemCategories(itemName string) ([]model.Category, error) {
+	rows, err := h.db.Query("SELECT category FROM items_list WHERE name = ? AND deleted_at IS NULL ORDER BY category", itemName)
 	if err != nil {
-		h.logger.Info("⚠️ Не удалось удалить внешний ключ structured_items_ibfk_2: %v", err)
+		return nil, fmt.Errorf("ошибка получения категорий предмета '%s': %v", itemName, err)
 	}
+	defer rows.Close()
 
-	// Удаляем существующую таблицу
-	_, err = h.db.Exec("DROP TABLE IF EXISTS items_list")
-	if err != nil {
-		return fmt.Errorf("ошибка удаления таблицы items_list: %v", err)
-	}
-
-	// Создаем таблицу заново
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS items_list (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		name VARCHAR(255) NOT NULL,
-		category VARCHAR(50) NOT NULL DEFAULT 'consumables',
-		min_price DECIMAL(15,2) DEFAULT 0,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE KEY unique_item_category (name, category)
-	)`
-
-	_, err = h.db.Exec(createTableSQL)
-	if err != nil {
-		return fmt.Errorf("ошибка создания таблицы items_list: %v", err)
-	}
-
-	// Очищаем ссылки на items_list в structured_items
-	_, err = h.db.Exec("UPDATE structured_items SET item_list_id = NULL")
-	if err != nil {
-		return fmt.Errorf("ошибка очистки ссылок в structured_items: %v", err)
-	}
-
-	// Восстанавливаем внешний ключ
-	_, err = h.db.Exec(`
-		ALTER TABLE structured_items
-		ADD CONSTRAINT structured_items_ibfk_2
-		FOREIGN KEY (item_list_id) REFERENCES items_list(id)
-		ON DELETE SET NULL
-	`)
-	if err != nil {
-		return fmt.Errorf("ошибка добавления внешнего ключа: %v", err)
-	}
-
-	h.logger.Info("✅ Таблица items_list пересоздана успешно")
-	return nil
-}
-
-// GetCurrentStatus получает текущий статус из базы данных
-func (h *DatabaseManager) GetCurrentStatus() (string, error) {
-	var status string
-	err := h.db.QueryRow("SELECT current_status FROM status ORDER BY updated_at DESC LIMIT 1").Scan(&status)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return "stopped", nil // По умолчанию считаем что система остановлена
+	var categories []model.Category
+	for rows.Next() {
+		var category model.Category
+		if err := rows.Scan(&category); err != nil {
+			return nil, fmt.Errorf("ошибка чтения категории предмета '%s': %v", itemName, err)
 		}
-		return "", err
+		categories = append(categories, category)
 	}
-	return status, nil
+	return categories, rows.Err()
 }
 
-// GetLatestUnexecutedAction получает последнее невыполненное действие
-func (h *DatabaseManager) GetLatestUnexecutedAction() (string, int, error) {
-	var action string
-	var id int
-	err := h.db.QueryRow("SELECT id, action FROM actions WHERE executed = 0 ORDER BY created_at DESC LIMIT 1").Scan(&id, &action)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", 0, nil // Нет невыполненных действий
-		}
-		return "", 0, err
+// nullIfEmpty возвращает NULL для пустой строки
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
 	}
-	return action, id, nil
-}
-
-// MarkActionAsExecuted помечает действие как выполненное
-func (h *DatabaseManager) MarkActionAsExecuted(actionID int) error {
-	_, err := h.db.Exec("UPDATE actions SET executed = 1 WHERE id = ?", actionID)
-	return err
-}
-
-// UpdateStatus обновляет статус в базе данных
-func (h *DatabaseManager) UpdateStatus(status string) error {
-	_, err := h.db.Exec("INSERT INTO status (current_status) VALUES (?)", status)
-	return err
+	return s
 }
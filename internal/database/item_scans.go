@@ -0,0 +1,110 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"shnyr/internal/model"
+	"strings"
+	"time"
+)
+
+// ItemScan - одно сканирование предмета: лучшее предложение и длительность
+type ItemScan struct {
+	BestPrice sql.NullFloat64
+	Offers    int
+	Duration  time.Duration
+	Age       time.Duration // сколько времени прошло с момента сканирования
+}
+
+// ListedItem - предмет из items_list с минимальной ценой
+type ListedItem struct {
+	Name     string
+	MinPrice float64
+}
+
+// ItemScanStart - отметка начала сканирования предмета
+type ItemScanStart struct {
+	started time.Time
+}
+
+// StartItemScan отмечает начало сканирования предмета
+func (h *DatabaseManager) StartItemScan() ItemScanStart {
+	return ItemScanStart{started: time.Now()}
+}
+
+// RecordItemScan записывает сканирование предмета, начатое в start.
+// Лучшее предложение берется из structured_items страниц ocrResultIDs этого сканирования:
+// для скупки (buy_) - максимальная цена, для продажи - минимальная.
+func (h *DatabaseManager) RecordItemScan(itemName string, category model.Category, start ItemScanStart, ocrResultIDs []int) error {
+	var best sql.NullFloat64
+	var offers int
+	if len(ocrResultIDs) > 0 {
+		aggregate := "MIN"
+		if category.IsBuy() {
+			aggregate = "MAX"
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ocrResultIDs)), ", ")
+		args := make([]interface{}, 0, len(ocrResultIDs))
+		for _, id := range ocrResultIDs {
+			args = append(args, id)
+		}
+		err := h.db.QueryRow("SELECT "+aggregate+"(price_value), COUNT(*) FROM structured_items WHERE ocr_result_id IN ("+placeholders+")", args...).
+			Scan(&best, &offers)
+		if err != nil {
+			return fmt.Errorf("ошибка получения лучшего предложения %s: %v", itemName, err)
+		}
+	}
+
+	_, err := h.db.Exec("INSERT INTO item_scans (item_name, category, best_price, offers, duration_ms) VALUES (?, ?, ?, ?, ?)",
+		itemName, category, best, offers, time.Since(start.started).Milliseconds())
+	if err != nil {
+		return fmt.Errorf("ошибка записи сканирования %s: %v", itemName, err)
+	}
+	return nil
+}
+
+// GetListedItemsByCategory возвращает предметы категории с минимальными ценами
+func (h *DatabaseManager) GetListedItemsByCategory(category model.Category) ([]ListedItem, error) {
+	rows, err := h.db.Query("SELECT name, COALESCE(min_price, 0) FROM items_list WHERE category = ? AND deleted_at IS NULL ORDER BY position, id", category)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса предметов категории %s: %v", category, err)
+	}
+	defer rows.Close()
+
+	var items []ListedItem
+	for rows.Next() {
+		var item ListedItem
+		if err := rows.Scan(&item.Name, &item.MinPrice); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования предмета: %v", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetItemScanHistory возвращает по каждому предмету категории не более limit последних сканирований, новые первыми
+func (h *DatabaseManager) GetItemScanHistory(category model.Category, limit int) (map[string][]ItemScan, error) {
+	rows, err := h.db.Query(`SELECT item_name, best_price, offers, duration_ms, TIMESTAMPDIFF(SECOND, scanned_at, NOW()) FROM item_scans
+		WHERE category = ? AND scanned_at >= NOW() - INTERVAL 7 DAY ORDER BY scanned_at DESC`, category)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса истории сканирований %s: %v", category, err)
+	}
+	defer rows.Close()
+
+	history := make(map[string][]ItemScan)
+	for rows.Next() {
+		var name string
+		var scan ItemScan
+		var durationMs, ageSeconds int64
+		if err := rows.Scan(&name, &scan.BestPrice, &scan.Offers, &durationMs, &ageSeconds); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования истории: %v", err)
+		}
+		if len(history[name]) >= limit {
+			continue
+		}
+		scan.Duration = time.Duration(durationMs) * time.Millisecond
+		scan.Age = time.Duration(ageSeconds) * time.Second
+		history[name] = append(history[name], scan)
+	}
+	return history, rows.Err()
+}
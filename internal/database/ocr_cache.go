@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ocrCacheHitsBatch - сколько попаданий накапливается в памяти до записи счетчиков в ocr_cache
+const ocrCacheHitsBatch = 50
+
+// OCRCacheStore - хранилище кэша OCR в таблице ocr_cache (ocr.cache.store: db).
+// Удобно, когда несколько экземпляров бота снимают одни и те же страницы.
+// Попадания считаются в памяти и записываются пачкой, чтобы чтение из кэша не требовало записи в базу.
+type OCRCacheStore struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	hits    map[string]int // попадания по ключу, еще не записанные в ocr_cache
+	pending int
+}
+
+// NewOCRCacheStore создает хранилище над таблицей ocr_cache
+func NewOCRCacheStore(db *sql.DB) *OCRCacheStore {
+	return &OCRCacheStore{db: db, hits: make(map[string]int)}
+}
+
+// Get читает запись кэша и считает попадание; каждые ocrCacheHitsBatch попаданий счетчики записываются в ocr_cache
+func (s *OCRCacheStore) Get(key string) ([]byte, bool, error) {
+	var data []byte
+	err := s.db.QueryRow("SELECT data FROM ocr_cache WHERE cache_key = ?", key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("ошибка чтения кэша OCR: %v", err)
+	}
+
+	s.mu.Lock()
+	s.hits[key]++
+	s.pending++
+	full := s.pending >= ocrCacheHitsBatch
+	s.mu.Unlock()
+	if full {
+		return data, true, s.Flush()
+	}
+	return data, true, nil
+}
+
+// Flush записывает накопленные попадания в ocr_cache одним запросом. При ошибке попадания теряются:
+// счетчики служат статистикой и не стоят повторной записи.
+func (s *OCRCacheStore) Flush() error {
+	s.mu.Lock()
+	hits := s.hits
+	s.hits = make(map[string]int)
+	s.pending = 0
+	s.mu.Unlock()
+	if len(hits) == 0 {
+		return nil
+	}
+
+	var cases []string
+	var keys []string
+	var args []interface{}
+	for key, count := range hits {
+		cases = append(cases, "WHEN ? THEN ?")
+		args = append(args, key, count)
+		keys = append(keys, "?")
+	}
+	for key := range hits {
+		args = append(args, key)
+	}
+	_, err := s.db.Exec("UPDATE ocr_cache SET hits = hits + CASE cache_key "+strings.Join(cases, " ")+" ELSE 0 END, last_hit_at = NOW() WHERE cache_key IN ("+strings.Join(keys, ", ")+")", args...)
+	if err != nil {
+		return fmt.Errorf("ошибка записи попаданий кэша OCR: %v", err)
+	}
+	return nil
+}
+
+// Put записывает запись кэша; запись, сохраненная параллельным воркером, заменяется
+func (s *OCRCacheStore) Put(key string, data []byte) error {
+	_, err := s.db.Exec("INSERT INTO ocr_cache (cache_key, data) VALUES (?, ?) ON DUPLICATE KEY UPDATE data = VALUES(data)", key, data)
+	if err != nil {
+		return fmt.Errorf("ошибка записи кэша OCR: %v", err)
+	}
+	return nil
+}
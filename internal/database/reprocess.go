@@ -0,0 +1,221 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"shnyr/internal/model"
+	"strings"
+	"time"
+)
+
+// ReprocessFilter - отбор результатов OCR для повторной обработки; пустые поля не ограничивают отбор
+type ReprocessFilter struct {
+	From          string   `json:"from,omitempty"` // created_at не раньше, 2006-01-02
+	To            string   `json:"to,omitempty"`   // created_at раньше, 2006-01-02
+	Item          string   `json:"item,omitempty"` // искомый или сопоставленный предмет
+	Category      string   `json:"category,omitempty"`
+	ParseStatuses []string `json:"parse_statuses,omitempty"` // none - результаты, сохраненные до появления parse_status
+}
+
+// where возвращает условие отбора по ocr_results ocr и его аргументы
+func (f ReprocessFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if f.From != "" {
+		conditions = append(conditions, "ocr.created_at >= ?")
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		conditions = append(conditions, "ocr.created_at < ?")
+		args = append(args, f.To)
+	}
+	if f.Item != "" {
+		conditions = append(conditions, `(ocr.item_name = ? OR EXISTS (SELECT 1 FROM structured_items si LEFT JOIN items_list il ON il.id = si.item_list_id
+			WHERE si.ocr_result_id = ocr.id AND si.processing_version = ocr.processing_version AND (il.name = ? OR si.title = ?)))`)
+		args = append(args, f.Item, f.Item, f.Item)
+	}
+	if f.Category != "" {
+		conditions = append(conditions, "(ocr.category = ? OR EXISTS (SELECT 1 FROM structured_items si WHERE si.ocr_result_id = ocr.id AND si.processing_version = ocr.processing_version AND si.category = ?))")
+		args = append(args, f.Category, f.Category)
+	}
+	if len(f.ParseStatuses) > 0 {
+		var statuses []string
+		for _, status := range f.ParseStatuses {
+			if status == "none" {
+				statuses = append(statuses, "ocr.parse_status IS NULL")
+				continue
+			}
+			statuses = append(statuses, "ocr.parse_status = ?")
+			args = append(args, status)
+		}
+		conditions = append(conditions, "("+strings.Join(statuses, " OR ")+")")
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// ReprocessRun - запуск повторной обработки. Результаты с processing_version ниже версии запуска
+// еще не обработаны, поэтому прерванный запуск продолжается с last_id без повторной обработки.
+type ReprocessRun struct {
+	ID        int
+	Version   int
+	Engine    string
+	Filter    ReprocessFilter
+	LastID    int
+	Processed int
+	Failed    int
+}
+
+// StartReprocessRun начинает запуск повторной обработки со следующей версией обработки
+func (h *DatabaseManager) StartReprocessRun(engine string, filter ReprocessFilter) (*ReprocessRun, error) {
+	var version int
+	err := h.db.QueryRow(`SELECT GREATEST(
+		COALESCE((SELECT MAX(processing_version) FROM ocr_results), 1),
+		COALESCE((SELECT MAX(processing_version) FROM reprocess_runs), 1)) + 1`).Scan(&version)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения версии обработки: %v", err)
+	}
+
+	filters, err := json.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации отбора: %v", err)
+	}
+	res, err := h.db.Exec("INSERT INTO reprocess_runs (processing_version, engine, filters) VALUES (?, ?, ?)", version, engine, string(filters))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка записи запуска повторной обработки: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return &ReprocessRun{ID: int(id), Version: version, Engine: engine, Filter: filter}, nil
+}
+
+// ResumeReprocessRun возвращает последний незавершенный запуск повторной обработки; nil - такого нет
+func (h *DatabaseManager) ResumeReprocessRun() (*ReprocessRun, error) {
+	var run ReprocessRun
+	var filters string
+	err := h.db.QueryRow(`SELECT id, processing_version, engine, filters, last_id, processed, failed
+		FROM reprocess_runs WHERE finished_at IS NULL ORDER BY id DESC LIMIT 1`).
+		Scan(&run.ID, &run.Version, &run.Engine, &filters, &run.LastID, &run.Processed, &run.Failed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения запуска повторной обработки: %v", err)
+	}
+	if err := json.Unmarshal([]byte(filters), &run.Filter); err != nil {
+		return nil, fmt.Errorf("ошибка разбора отбора запуска %d: %v", run.ID, err)
+	}
+	return &run, nil
+}
+
+// SaveReprocessProgress запоминает, до какого результата дошел запуск
+func (h *DatabaseManager) SaveReprocessProgress(run *ReprocessRun) error {
+	_, err := h.db.Exec("UPDATE reprocess_runs SET last_id = ?, processed = ?, failed = ? WHERE id = ?", run.LastID, run.Processed, run.Failed, run.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка записи прогресса запуска %d: %v", run.ID, err)
+	}
+	return nil
+}
+
+// FinishReprocessRun отмечает запуск завершенным
+func (h *DatabaseManager) FinishReprocessRun(run *ReprocessRun) error {
+	_, err := h.db.Exec("UPDATE reprocess_runs SET last_id = ?, processed = ?, failed = ?, finished_at = NOW() WHERE id = ?", run.LastID, run.Processed, run.Failed, run.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка завершения запуска %d: %v", run.ID, err)
+	}
+	return nil
+}
+
+// ReprocessCandidate - результат OCR для повторной обработки
+type ReprocessCandidate struct {
+	ID        int
+	ImagePath string
+	ImageData []byte
+	Category  model.Category // раздел сканирования; для результатов, сохраненных до ocr_results.category, - категория предложений текущей версии; пустая - неизвестна
+	ItemName  string         // искомый предмет; для старых результатов - сопоставленный предмет предложений текущей версии без расхождения названия
+	CreatedAt time.Time
+}
+
+// ReprocessCandidates возвращает до limit результатов с ID больше afterID, которые запуск run еще не обработал
+func (h *DatabaseManager) ReprocessCandidates(run *ReprocessRun, afterID int, limit int) ([]ReprocessCandidate, error) {
+	where, args := run.Filter.where()
+	query := `SELECT ocr.id, ocr.image_path, ocr.image_data, ocr.created_at,
+			COALESCE(ocr.category, (SELECT si.category FROM structured_items si WHERE si.ocr_result_id = ocr.id AND si.processing_version = ocr.processing_version LIMIT 1), ''),
+			COALESCE(ocr.item_name, (SELECT il.name FROM structured_items si INNER JOIN items_list il ON il.id = si.item_list_id
+				WHERE si.ocr_result_id = ocr.id AND si.processing_version = ocr.processing_version AND NOT si.title_mismatch LIMIT 1), '')
+		FROM ocr_results ocr
+		WHERE ocr.id > ? AND ocr.processing_version < ? AND ocr.image_data IS NOT NULL` + where + `
+		ORDER BY ocr.id LIMIT ?`
+	args = append([]interface{}{afterID, run.Version}, args...)
+	args = append(args, limit)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка отбора результатов OCR: %v", err)
+	}
+	defer rows.Close()
+
+	var candidates []ReprocessCandidate
+	for rows.Next() {
+		var c ReprocessCandidate
+		if err := rows.Scan(&c.ID, &c.ImagePath, &c.ImageData, &c.CreatedAt, &c.Category, &c.ItemName); err != nil {
+			return nil, fmt.Errorf("ошибка чтения результата OCR: %v", err)
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// SaveReprocessedResult записывает новый вывод OCR результата candidate версии run.Version одной транзакцией:
+// прежний вывод переносится в ocr_result_versions, предложения прежней версии остаются в structured_items.
+// Поиск и метрики читают только предложения текущей версии (structured_items_corrected).
+func (h *DatabaseManager) SaveReprocessedResult(run *ReprocessRun, candidate ReprocessCandidate, ocrText, debugInfo, jsonData, rawText string, parse ParseReport) error {
+	// Без раздела предложения сохранились бы без категории и сопоставлялись бы со всем каталогом
+	if candidate.Category == "" {
+		return fmt.Errorf("у результата %d неизвестен раздел сканирования", candidate.ID)
+	}
+
+	itemMatcher, err := h.itemMatcher()
+	if err != nil {
+		h.logger.LogError(err, "Ошибка загрузки списка предметов для сопоставления названий")
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Блокировка строки не дает двум запускам обработать результат одновременно
+	var current int
+	err = tx.QueryRow("SELECT processing_version FROM ocr_results WHERE id = ? FOR UPDATE", candidate.ID).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения результата %d: %v", candidate.ID, err)
+	}
+	if current >= run.Version {
+		return nil
+	}
+
+	_, err = tx.Exec(`INSERT IGNORE INTO ocr_result_versions (ocr_result_id, processing_version, ocr_text, debug_info, json_data, raw_text, parse_status, parse_issues)
+		SELECT id, processing_version, ocr_text, debug_info, json_data, raw_text, parse_status, parse_issues FROM ocr_results WHERE id = ?`, candidate.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения прежней версии результата %d: %v", candidate.ID, err)
+	}
+
+	_, err = tx.Exec(`UPDATE ocr_results SET ocr_text = ?, debug_info = ?, json_data = ?, raw_text = ?, parse_status = ?, parse_issues = ?, processing_version = ?
+		WHERE id = ?`, ocrText, debugInfo, jsonData, rawText, nullIfEmpty(parse.Status), nullIfEmpty(parse.Issues), run.Version, candidate.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления результата %d: %v", candidate.ID, err)
+	}
+
+	if err := saveStructuredItems(tx, candidate.ID, run.Version, jsonData, candidate.Category, candidate.ItemName, itemMatcher); err != nil {
+		return fmt.Errorf("ошибка сохранения структурированных данных: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"shnyr/internal/model"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSpoolDir - каталог спула, если spool_dir не задан в конфиге
+const DefaultSpoolDir = "./spool"
+
+// SpoolMaxAttempts - число неудачных попыток записи, после которого результат переносится в failed
+const SpoolMaxAttempts = 5
+
+// SpoolEntry - результат OCR, ожидающий записи в ocr_results и structured_items
+type SpoolEntry struct {
+	ID        string         `json:"id"`
+	ImagePath string         `json:"image_path"`
+	OCRText   string         `json:"ocr_text"`
+	DebugInfo string         `json:"debug_info"`
+	JSONData  string         `json:"json_data"`
+	RawText   string         `json:"raw_text"`
+	ImageData []byte         `json:"image_data"`
+	Category  model.Category `json:"category"`
+	ItemName  string         `json:"item_name"`
+	Parse     ParseReport    `json:"parse"`
+	CacheHit  bool           `json:"cache_hit,omitempty"` // результат взят из кэша OCR
+	CreatedAt time.Time      `json:"created_at"`
+	Attempts  int            `json:"attempts"`
+	LastError string         `json:"last_error,omitempty"`
+}
+
+// Spool - очередь результатов OCR на диске. Результат попадает в pending до записи в базу
+// и удаляется после подтверждения транзакции. Если запись не удалась, он остается в pending
+// с числом попыток и воспроизводится при следующем запуске; после SpoolMaxAttempts попыток или
+// при ошибке в самих данных он переносится в failed, где его можно посмотреть и вернуть
+// в очередь командой spool -retry.
+type Spool struct {
+	dir string
+	seq atomic.Int64
+}
+
+// NewSpool открывает спул в каталоге dir, создавая подкаталоги pending и failed
+func NewSpool(dir string) (*Spool, error) {
+	if dir == "" {
+		dir = DefaultSpoolDir
+	}
+	for _, sub := range []string{"pending", "failed"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("ошибка создания каталога спула %s: %v", filepath.Join(dir, sub), err)
+		}
+	}
+	return &Spool{dir: dir}, nil
+}
+
+// Dir возвращает каталог спула
+func (s *Spool) Dir() string {
+	return s.dir
+}
+
+// Put записывает результат в pending. Файл сбрасывается на диск до возврата, поэтому
+// результат переживает падение процесса, случившееся до записи в базу.
+func (s *Spool) Put(entry *SpoolEntry) error {
+	if entry.ID == "" {
+		entry.ID = fmt.Sprintf("%d_%04d", time.Now().UnixNano(), s.seq.Add(1)%10000)
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	return s.write("pending", entry)
+}
+
+// Done удаляет записанный в базу результат из pending
+func (s *Spool) Done(id string) error {
+	err := os.Remove(s.path("pending", id))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("ошибка удаления %s из спула: %v", id, err)
+	}
+	return nil
+}
+
+// Postpone оставляет результат в pending, записывая попытку и причину ошибки
+func (s *Spool) Postpone(entry *SpoolEntry, cause error) error {
+	entry.Attempts++
+	entry.LastError = cause.Error()
+	return s.write("pending", entry)
+}
+
+// Fail переносит результат в failed вместе с причиной ошибки
+func (s *Spool) Fail(entry *SpoolEntry, cause error) error {
+	entry.Attempts++
+	entry.LastError = cause.Error()
+	if err := s.write("failed", entry); err != nil {
+		return err
+	}
+	return s.Done(entry.ID)
+}
+
+// Retry возвращает результат id из failed в pending со сброшенным числом попыток;
+// он будет записан при следующем воспроизведении спула
+func (s *Spool) Retry(id string) error {
+	data, err := os.ReadFile(s.path("failed", id))
+	if err != nil {
+		return fmt.Errorf("ошибка возврата %s в очередь: %v", id, err)
+	}
+	var entry SpoolEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return fmt.Errorf("ошибка разбора %s: %v", id, err)
+	}
+	entry.ID = id
+	entry.Attempts = 0
+	if err := s.write("pending", &entry); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path("failed", id)); err != nil {
+		return fmt.Errorf("ошибка возврата %s в очередь: %v", id, err)
+	}
+	return nil
+}
+
+// Pending возвращает результаты, ожидающие записи, в порядке поступления
+func (s *Spool) Pending() ([]*SpoolEntry, error) {
+	return s.list("pending")
+}
+
+// Failed возвращает результаты, запись которых не удалась
+func (s *Spool) Failed() ([]*SpoolEntry, error) {
+	return s.list("failed")
+}
+
+func (s *Spool) path(sub string, id string) string {
+	return filepath.Join(s.dir, sub, id+".json")
+}
+
+// write атомарно записывает entry в подкаталог sub: через временный файл, fsync и переименование
+func (s *Spool) write(sub string, entry *SpoolEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации записи спула: %v", err)
+	}
+
+	tmp := s.path(sub, entry.ID) + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла спула: %v", err)
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("ошибка записи файла спула: %v", err)
+	}
+
+	if err := os.Rename(tmp, s.path(sub, entry.ID)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("ошибка записи файла спула: %v", err)
+	}
+	return nil
+}
+
+func (s *Spool) list(sub string) ([]*SpoolEntry, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, sub, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения каталога спула: %v", err)
+	}
+	// Имена начинаются с времени поступления, поэтому сортировка по имени сохраняет порядок
+	sort.Strings(files)
+
+	var entries []*SpoolEntry
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения %s: %v", file, err)
+		}
+		var entry SpoolEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("ошибка разбора %s: %v", file, err)
+		}
+		if entry.ID == "" {
+			entry.ID = strings.TrimSuffix(filepath.Base(file), ".json")
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
@@ -4,42 +4,27 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"shnyr/internal/matcher"
+	"shnyr/internal/model"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// SaveStructuredDataBatch сохраняет структурированные данные в базу данных
-func SaveStructuredDataBatch(db *sql.DB, ocrResultID int, jsonData string, itemCategory string, currentItemName string) error {
+// saveStructuredItems сохраняет структурированные данные результата OCR версии обработки processingVersion в транзакции tx.
+// Каждое предложение связывается с предметом items_list, на который больше всего похоже его название;
+// без matcher - с искомым предметом currentItemName.
+func saveStructuredItems(tx *sql.Tx, ocrResultID int, processingVersion int, jsonData string, itemCategory model.Category, currentItemName string, itemMatcher *matcher.Matcher) error {
 	if jsonData == "" {
 		return nil // Нет данных для сохранения
 	}
 
-	// Парсим JSON
-	var ocrResult OCRJSONResult
+	// Парсим JSON. Нечитаемый JSON не повод терять сам результат OCR: он сохраняется без structured_items.
+	var ocrResult model.OCRResult
 	err := json.Unmarshal([]byte(jsonData), &ocrResult)
 	if err != nil {
-		return fmt.Errorf("ошибка парсинга JSON: %v", err)
-	}
-
-	// Создаем таблицу, если она не существует
-	createTableSQL := `CREATE TABLE IF NOT EXISTS structured_items (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		ocr_result_id INT,
-		title VARCHAR(255) NOT NULL,
-		title_short VARCHAR(255),
-		enhancement VARCHAR(10),
-		price VARCHAR(50) NOT NULL,
-		package BOOLEAN DEFAULT FALSE,
-		owner VARCHAR(255),
-		count VARCHAR(10),
-		category VARCHAR(50),
-		item_list_id INT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (ocr_result_id) REFERENCES ocr_results(id) ON DELETE CASCADE,
-		FOREIGN KEY (item_list_id) REFERENCES items_list(id) ON DELETE SET NULL
-	)`
-
-	_, err = db.Exec(createTableSQL)
-	if err != nil {
-		return fmt.Errorf("ошибка создания таблицы structured_items: %v", err)
+		fmt.Printf("⚠️ Ошибка парсинга JSON, structured items не сохранены (OCR ID: %d): %v\n", ocrResultID, err)
+		return nil
 	}
 
 	// Если нет данных для сохранения, выходим
@@ -48,60 +33,139 @@ func SaveStructuredDataBatch(db *sql.DB, ocrResultID int, jsonData string, itemC
 		return nil
 	}
 
-	// Получаем ID текущего предмета из items_list
+	// Получаем ID текущего предмета из items_list: предмет ищется в разделе, который сканировался
 	var itemListID *int
 	if currentItemName != "" {
 		var id int
-		err := db.QueryRow("SELECT id FROM items_list WHERE name = ?", currentItemName).Scan(&id)
+		err := tx.QueryRow("SELECT id FROM items_list WHERE name = ? AND category = ? AND deleted_at IS NULL", currentItemName, itemCategory).Scan(&id)
 		if err == nil {
 			itemListID = &id
 		} else {
-			fmt.Printf("⚠️ Не удалось найти предмет '%s' в items_list: %v\n", currentItemName, err)
+			fmt.Printf("⚠️ Не удалось найти предмет '%s' (%s) в items_list: %v\n", currentItemName, itemCategory, err)
 		}
 	}
 
-	// Начинаем транзакцию для batch обработки
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("ошибка начала транзакции: %v", err)
-	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
 	// Подготавливаем запрос для batch вставки
-	insertSQL := `INSERT INTO structured_items (ocr_result_id, title, title_short, enhancement, price, package, owner, count, category, item_list_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	insertSQL := `INSERT INTO structured_items (ocr_result_id, title, title_short, enhancement, price, price_value, package, owner, count, category, item_list_id, match_score, title_mismatch,
+		confidence, title_confidence, price_confidence, count_confidence, owner_confidence, row_top, row_bottom, processing_version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	stmt, err := tx.Prepare(insertSQL)
 	if err != nil {
 		return fmt.Errorf("ошибка подготовки запроса: %v", err)
 	}
 	defer stmt.Close()
 
+	// Уверенность всего изображения используется для предложений, по которым движок не сообщил свою
+	imageConfidence, hasImageConfidence := model.ParseConfidence(ocrResult.TextRecognition.Confidence)
+
 	// Сохраняем каждый элемент в batch
 	processedCount := 0
 	for _, item := range ocrResult.TextRecognition.StructuredData {
-		// Устанавливаем "0" для пустого enhancement
+		// Поля, которые не удалось разобрать, сохраняются строкой OCR: их видно в проверке и исправлениях
+		listing, convErr := model.NewListing(item, itemCategory)
+		if convErr != nil {
+			fmt.Printf("⚠️ %v (OCR ID: %d)\n", convErr, ocrResultID)
+		}
+		var priceValue interface{}
+		if !model.IsFieldError(convErr, "price") {
+			priceValue = listing.Price
+		}
+		count := item.Count
+		if listing.Count > 0 {
+			count = strconv.Itoa(listing.Count)
+		}
 		enhancement := item.Enhancement
-		if enhancement == "" {
-			enhancement = "0"
+		if !model.IsFieldError(convErr, "enhancement") {
+			enhancement = strconv.Itoa(listing.Enhancement)
+		}
+
+		// Сопоставляем распознанное название с items_list; неуверенное совпадение оставляет ссылку на искомый предмет,
+		// но отмечается расхождением: название не подтверждает, что предложение относится к искомому предмету
+		linkedID := itemListID
+		var matchScore interface{}
+		mismatch := false
+		if itemMatcher != nil {
+			match, ok := itemMatcher.Find(string(itemCategory), listing.Title, listing.TitleShort)
+			if match.Item.ID != 0 {
+				matchScore = match.Score
+			}
+			if ok {
+				linkedID = &match.Item.ID
+				mismatch = currentItemName != "" && !strings.EqualFold(match.Item.Name, currentItemName)
+			} else {
+				mismatch = itemListID != nil
+			}
 		}
 
-		_, err = stmt.Exec(ocrResultID, item.Title, item.TitleShort, enhancement, item.Price, item.Package, item.Owner, item.Count, itemCategory, itemListID)
+		var confidence, rowTop, rowBottom interface{}
+		if value, ok := listing.RowConfidence(imageConfidence, hasImageConfidence); ok {
+			confidence = value
+		}
+		if listing.RowBottom > listing.RowTop {
+			rowTop, rowBottom = listing.RowTop, listing.RowBottom
+		}
+
+		_, err = stmt.Exec(ocrResultID, item.Title, item.TitleShort, enhancement, item.Price, priceValue, listing.Package, listing.Owner, count, listing.Category, linkedID, matchScore, mismatch,
+			confidence, fieldConfidence(listing, "title"), fieldConfidence(listing, "price"), fieldConfidence(listing, "count"), fieldConfidence(listing, "owner"),
+			rowTop, rowBottom, processingVersion)
 		if err != nil {
 			return fmt.Errorf("ошибка вставки структурированных данных: %v", err)
 		}
 		processedCount++
 	}
 
-	// Подтверждаем транзакцию
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("ошибка подтверждения транзакции: %v", err)
-	}
-
 	fmt.Printf("✅ Сохранено %d/%d структурированных элементов для OCR результата ID: %d (категория: %s, item_list_id: %v)\n",
 		processedCount, len(ocrResult.TextRecognition.StructuredData), ocrResultID, itemCategory, itemListID)
 	return nil
 }
+
+// fieldConfidence возвращает уверенность поля field предложения; nil - движок ее не сообщил
+func fieldConfidence(listing model.Listing, field string) interface{} {
+	if value, ok := listing.FieldConfidence[field]; ok {
+		return value
+	}
+	return nil
+}
+
+// matcherTTL - как долго используется загруженный список предметов и алиасов
+const matcherTTL = time.Minute
+
+// itemMatcher возвращает сопоставитель названий с items_list, перечитывая таблицы не чаще раза в matcherTTL
+func (h *DatabaseManager) itemMatcher() (*matcher.Matcher, error) {
+	h.matcherMu.Lock()
+	defer h.matcherMu.Unlock()
+	if h.matcher != nil && time.Since(h.matcherLoaded) < matcherTTL {
+		return h.matcher, nil
+	}
+
+	rows, err := h.db.Query("SELECT id, name, category FROM items_list WHERE deleted_at IS NULL")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения items_list: %v", err)
+	}
+	defer rows.Close()
+	var items []matcher.Item
+	for rows.Next() {
+		var item matcher.Item
+		if err := rows.Scan(&item.ID, &item.Name, &item.Category); err != nil {
+			return nil, fmt.Errorf("ошибка чтения items_list: %v", err)
+		}
+		items = append(items, item)
+	}
+
+	aliasRows, err := h.db.Query("SELECT alias, item_name FROM item_aliases")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения item_aliases: %v", err)
+	}
+	defer aliasRows.Close()
+	aliases := make(map[string]string)
+	for aliasRows.Next() {
+		var alias, name string
+		if err := aliasRows.Scan(&alias, &name); err != nil {
+			return nil, fmt.Errorf("ошибка чтения item_aliases: %v", err)
+		}
+		aliases[alias] = name
+	}
+
+	h.matcher = matcher.New(items, aliases)
+	h.matcherLoaded = time.Now()
+	return h.matcher, nil
+}
@@ -0,0 +1,114 @@
+package image
+
+import (
+	"image"
+	"shnyr/internal/config"
+)
+
+// OfferRow - одно предложение таблицы предложений и области его колонок
+type OfferRow struct {
+	Bounds image.Rectangle
+	Name   image.Rectangle
+	Price  image.Rectangle
+	Count  image.Rectangle
+	Owner  image.Rectangle
+}
+
+// SegmentOfferRows делит обрезанное изображение таблицы предложений на строки-предложения.
+// Как и в FindItemPositionsByTextColor, строки текста ищутся по горизонтальной проекции цветных пикселей,
+// а близкие строки текста объединяются в одно предложение. Колонки берутся из настроек layout.
+func SegmentOfferRows(img image.Image, layout config.OfferRows) []OfferRow {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	type bar struct{ yStart, yEnd int }
+	var allBars []bar
+
+	// --- Этап 1: Находим все отдельные строки текста ---
+	const minHorizontalPixels = 3
+	const colorThreshold = 20
+	const brightThreshold = 110
+
+	inBar := false
+	var barYStart int
+	for y := 0; y < height; y++ {
+		activePixelCount := 0
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			r8, g8, b8 := int(r>>8), int(g>>8), int(b>>8)
+			isGreen := g8 > r8+colorThreshold && g8 > b8+colorThreshold
+			isRed := r8 > g8+colorThreshold && r8 > b8+colorThreshold
+			// Кроме цветных названий в таблице есть светлые цены и имена продавцов
+			isBright := r8 >= brightThreshold && g8 >= brightThreshold && b8 >= brightThreshold
+			if isGreen || isRed || isBright {
+				activePixelCount++
+			}
+		}
+
+		isRowActive := activePixelCount >= minHorizontalPixels
+		if isRowActive && !inBar {
+			inBar = true
+			barYStart = y
+		} else if !isRowActive && inBar {
+			inBar = false
+			allBars = append(allBars, bar{yStart: barYStart, yEnd: y - 1})
+		}
+	}
+	if inBar {
+		allBars = append(allBars, bar{yStart: barYStart, yEnd: height - 1})
+	}
+
+	var rows []OfferRow
+	if len(allBars) == 0 {
+		return rows
+	}
+
+	// --- Этап 2: Группируем близкие строки текста в предложения ---
+	rowGap := layout.RowGap
+	if rowGap <= 0 {
+		rowGap = 15
+	}
+	addRow := func(group bar) {
+		// Оставляем по пикселю сверху и снизу, чтобы не обрезать края символов
+		top := group.yStart - 1
+		if top < 0 {
+			top = 0
+		}
+		bottom := group.yEnd + 2
+		if bottom > height {
+			bottom = height
+		}
+		rect := image.Rect(0, top, width, bottom).Add(bounds.Min)
+		rows = append(rows, OfferRow{
+			Bounds: rect,
+			Name:   columnRect(rect, layout.Name),
+			Price:  columnRect(rect, layout.Price),
+			Count:  columnRect(rect, layout.Count),
+			Owner:  columnRect(rect, layout.Owner),
+		})
+	}
+
+	currentGroup := allBars[0]
+	for i := 1; i < len(allBars); i++ {
+		nextBar := allBars[i]
+		if (nextBar.yStart - currentGroup.yEnd) < rowGap {
+			currentGroup.yEnd = nextBar.yEnd
+		} else {
+			addRow(currentGroup)
+			currentGroup = nextBar
+		}
+	}
+	addRow(currentGroup)
+
+	return rows
+}
+
+// columnRect возвращает область колонки column внутри строки row; пустая область - колонка не настроена
+func columnRect(row image.Rectangle, column config.Column) image.Rectangle {
+	if column.Width <= 0 {
+		return image.Rectangle{}
+	}
+	rect := image.Rect(row.Min.X+column.X, row.Min.Y, row.Min.X+column.X+column.Width, row.Max.Y)
+	return rect.Intersect(row)
+}
@@ -2,6 +2,8 @@ package interrupt
 
 import (
 	"shnyr/internal/logger"
+	"sync"
+	"sync/atomic"
 
 	"github.com/moutend/go-hook/pkg/keyboard"
 	"github.com/moutend/go-hook/pkg/types"
@@ -11,23 +13,28 @@ import (
 type InterruptManager struct {
 	scriptInterruptChan chan bool
 	scriptStartChan     chan bool
-	isScriptRunning     *bool
-	isInterrupted       *bool
-	loggerManager       *logger.LoggerManager
-	lastScriptType      string
+	// флаги читают и меняют опрос команд, планировщик, конвейер и горячие клавиши из разных горутин
+	isScriptRunning atomic.Bool
+	isInterrupted   atomic.Bool
+	loggerManager   *logger.LoggerManager
+	lastScriptType  string
+
+	// состояние паузы; скрипт останавливается в ближайшей безопасной точке (WaitIfPaused)
+	pauseMu        sync.Mutex
+	pauseRequested bool
+	paused         bool
+	resumeChan     chan bool
+	pauseHandler   func(paused bool)
 }
 
 // NewInterruptManager создает новый менеджер прерываний
 func NewInterruptManager(loggerManager *logger.LoggerManager) *InterruptManager {
-	isScriptRunning := false
-	isInterrupted := false
 	return &InterruptManager{
 		scriptInterruptChan: make(chan bool, 1),
 		scriptStartChan:     make(chan bool, 1),
-		isScriptRunning:     &isScriptRunning,
-		isInterrupted:       &isInterrupted,
 		loggerManager:       loggerManager,
 		lastScriptType:      "",
+		resumeChan:          make(chan bool, 1),
 	}
 }
 
@@ -48,12 +55,12 @@ func (im *InterruptManager) GetScriptStartChan() <-chan bool {
 
 // SetScriptRunning устанавливает состояние выполнения скрипта
 func (im *InterruptManager) SetScriptRunning(running bool) {
-	*im.isScriptRunning = running
+	im.isScriptRunning.Store(running)
 }
 
 // IsScriptRunning возвращает состояние выполнения скрипта
 func (im *InterruptManager) IsScriptRunning() bool {
-	return *im.isScriptRunning
+	return im.isScriptRunning.Load()
 }
 
 // GetLastScriptType возвращает тип последнего запущенного скрипта
@@ -68,12 +75,140 @@ func (im *InterruptManager) SetLastScriptType(scriptType string) {
 
 // IsInterrupted возвращает состояние прерывания
 func (im *InterruptManager) IsInterrupted() bool {
-	return *im.isInterrupted
+	return im.isInterrupted.Load()
 }
 
 // SetInterrupted устанавливает состояние прерывания
 func (im *InterruptManager) SetInterrupted(interrupted bool) {
-	*im.isInterrupted = interrupted
+	im.isInterrupted.Store(interrupted)
+}
+
+// ResetInterrupt сбрасывает флаг прерывания и необработанный сигнал прерывания перед новым запуском скрипта,
+// чтобы сигнал, оставшийся от предыдущего запуска, не прервал новый запуск или его паузу
+func (im *InterruptManager) ResetInterrupt() {
+	im.isInterrupted.Store(false)
+	select {
+	case <-im.scriptInterruptChan:
+	default:
+	}
+}
+
+// Interrupt прерывает выполняющийся скрипт, в том числе стоящий на паузе
+func (im *InterruptManager) Interrupt() {
+	if !im.IsScriptRunning() {
+		return
+	}
+	im.SetInterrupted(true)
+	select {
+	case im.scriptInterruptChan <- true:
+	default:
+		// сигнал прерывания уже ожидает обработки
+	}
+}
+
+// SetPauseHandler устанавливает обработчик, вызываемый при фактической постановке на паузу и снятии с нее
+func (im *InterruptManager) SetPauseHandler(handler func(paused bool)) {
+	im.pauseMu.Lock()
+	defer im.pauseMu.Unlock()
+	im.pauseHandler = handler
+}
+
+// RequestPause запрашивает паузу скрипта в ближайшей безопасной точке
+func (im *InterruptManager) RequestPause() {
+	im.pauseMu.Lock()
+	defer im.pauseMu.Unlock()
+	if im.pauseRequested {
+		return
+	}
+	im.pauseRequested = true
+	// Убираем сигнал возобновления, оставшийся от предыдущей паузы
+	select {
+	case <-im.resumeChan:
+	default:
+	}
+	im.loggerManager.Info("⏸️ Запрошена пауза, скрипт остановится в ближайшей безопасной точке")
+}
+
+// RequestResume снимает паузу или отменяет еще не наступившую паузу
+func (im *InterruptManager) RequestResume() {
+	im.pauseMu.Lock()
+	defer im.pauseMu.Unlock()
+	if !im.pauseRequested {
+		return
+	}
+	im.pauseRequested = false
+	if im.paused {
+		select {
+		case im.resumeChan <- true:
+		default:
+		}
+	}
+}
+
+// IsPauseRequested сообщает, запрошена ли пауза (скрипт может еще не дойти до безопасной точки)
+func (im *InterruptManager) IsPauseRequested() bool {
+	im.pauseMu.Lock()
+	defer im.pauseMu.Unlock()
+	return im.pauseRequested
+}
+
+// IsPaused сообщает, стоит ли скрипт на паузе
+func (im *InterruptManager) IsPaused() bool {
+	im.pauseMu.Lock()
+	defer im.pauseMu.Unlock()
+	return im.paused
+}
+
+// ResetPause сбрасывает состояние паузы перед новым запуском скрипта
+func (im *InterruptManager) ResetPause() {
+	im.pauseMu.Lock()
+	defer im.pauseMu.Unlock()
+	im.pauseRequested = false
+	im.paused = false
+	select {
+	case <-im.resumeChan:
+	default:
+	}
+}
+
+// WaitIfPaused - безопасная точка скрипта. Если запрошена пауза, блокируется до возобновления.
+// Возвращает true, если во время паузы скрипт был прерван.
+func (im *InterruptManager) WaitIfPaused() bool {
+	im.pauseMu.Lock()
+	if !im.pauseRequested {
+		im.pauseMu.Unlock()
+		return false
+	}
+	im.paused = true
+	handler := im.pauseHandler
+	im.pauseMu.Unlock()
+
+	if handler != nil {
+		handler(true)
+	}
+	im.loggerManager.Info("⏸️ Скрипт на паузе. Ctrl+Shift+P для продолжения, Q для прерывания")
+
+	interrupted := false
+	select {
+	case <-im.resumeChan:
+	case <-im.scriptInterruptChan:
+		interrupted = true
+	}
+
+	im.pauseMu.Lock()
+	im.paused = false
+	im.pauseRequested = false
+	im.pauseMu.Unlock()
+
+	if interrupted {
+		im.loggerManager.Info("⏹️ Прерывание во время паузы")
+		return true
+	}
+	if handler != nil {
+		handler(false)
+	}
+	im.loggerManager.Info("▶️ Скрипт продолжает работу")
+	return false
 }
 
 // monitorHotkeys мониторит горячие клавиши
@@ -114,13 +249,19 @@ func (im *InterruptManager) monitorHotkeys() {
 			im.scriptStartChan <- true
 		}
 
+		// Ctrl+Shift+P для паузы и продолжения
+		if event.Message == types.WM_KEYDOWN && event.VKCode == types.VK_P && shiftPressed && ctrlPressed {
+			if im.IsPauseRequested() {
+				im.RequestResume()
+			} else if im.IsScriptRunning() {
+				im.RequestPause()
+			}
+		}
+
 		// Q для прерывания
 		if event.Message == types.WM_KEYDOWN && (event.VKCode == types.VK_Q || event.VKCode == types.VK_CAPITAL) {
 			// Q всегда только прерывает скрипт, если он запущен
-			if im.isScriptRunning != nil && *im.isScriptRunning {
-				*im.isInterrupted = true
-				im.scriptInterruptChan <- true
-			}
+			im.Interrupt()
 		}
 	}
 }
@@ -0,0 +1,222 @@
+package lifecycle
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"shnyr/internal/logger"
+)
+
+// State представляет состояние жизненного цикла бота
+type State string
+
+const (
+	StateUnknown          State = "unknown"
+	StateMain             State = "main"
+	StateReady            State = "ready"
+	StateCycleAllItems    State = "cycle_all_items"
+	StateCycleListedItems State = "cycle_listed_items"
+	StatePaused           State = "paused"
+	StateRestarting       State = "restarting"
+	StateStopped          State = "stopped"
+	StateError            State = "error"
+)
+
+// states содержит все известные состояния
+var states = []State{
+	StateUnknown,
+	StateMain,
+	StateReady,
+	StateCycleAllItems,
+	StateCycleListedItems,
+	StatePaused,
+	StateRestarting,
+	StateStopped,
+	StateError,
+}
+
+// transitions описывает допустимые переходы между состояниями.
+// Переходы в main и stopped разрешены из любого состояния: это запуск и завершение процесса.
+// Переход restarting -> restarting используется для записи очередной фазы перезапуска.
+var transitions = map[State][]State{
+	StateUnknown:          {StateReady},
+	StateMain:             {StateReady, StateError},
+	StateReady:            {StateCycleAllItems, StateCycleListedItems, StateRestarting, StateError},
+	StateCycleAllItems:    {StateReady, StatePaused, StateRestarting, StateError},
+	StateCycleListedItems: {StateReady, StatePaused, StateRestarting, StateError},
+	StatePaused:           {StateCycleAllItems, StateCycleListedItems, StateRestarting, StateError},
+	StateRestarting:       {StateRestarting, StateReady, StateCycleAllItems, StateCycleListedItems, StateError},
+	StateStopped:          {StateReady, StateCycleAllItems, StateCycleListedItems, StateRestarting, StateError},
+	StateError:            {StateReady, StateCycleAllItems, StateCycleListedItems, StateRestarting},
+}
+
+// ParseState преобразует строку из базы данных в State.
+// Неизвестные строки превращаются в StateUnknown.
+func ParseState(s string) State {
+	for _, state := range states {
+		if string(state) == s {
+			return state
+		}
+	}
+	return StateUnknown
+}
+
+// ScriptState возвращает состояние, соответствующее запуску скрипта
+func ScriptState(scriptType string) (State, error) {
+	switch scriptType {
+	case "cycle_all_items":
+		return StateCycleAllItems, nil
+	case "cycle_listed_items":
+		return StateCycleListedItems, nil
+	default:
+		return StateUnknown, fmt.Errorf("неизвестный скрипт: %s", scriptType)
+	}
+}
+
+// IsRunning сообщает, выполняется ли в этом состоянии скрипт
+func (s State) IsRunning() bool {
+	return s == StateCycleAllItems || s == StateCycleListedItems
+}
+
+// CanTransition проверяет, допустим ли переход из from в to
+func CanTransition(from, to State) bool {
+	if to == StateMain || to == StateStopped {
+		return true
+	}
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError возвращается при попытке недопустимого перехода
+type TransitionError struct {
+	From State
+	To   State
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("недопустимый переход состояния: %s -> %s", e.From, e.To)
+}
+
+// Record представляет одну запись таблицы status
+type Record struct {
+	ID        int
+	State     State
+	Previous  State
+	Reason    string
+	ChangedAt time.Time
+}
+
+// Latest возвращает последнюю запись о состоянии из базы данных
+func Latest(db *sql.DB) (Record, error) {
+	var record Record
+	var state string
+	var previous, reason sql.NullString
+	err := db.QueryRow("SELECT id, current_status, previous_status, reason, updated_at FROM status ORDER BY id DESC LIMIT 1").
+		Scan(&record.ID, &state, &previous, &reason, &record.ChangedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Record{State: StateUnknown}, nil
+		}
+		return Record{}, fmt.Errorf("ошибка получения статуса: %v", err)
+	}
+	record.State = ParseState(state)
+	if previous.Valid {
+		record.Previous = ParseState(previous.String)
+	}
+	record.Reason = reason.String
+	return record, nil
+}
+
+// Machine проверяет переходы состояний и является единственным писателем таблицы status
+type Machine struct {
+	db         *sql.DB
+	logger     *logger.LoggerManager
+	mu         sync.Mutex
+	current    State
+	pausedFrom State // состояние скрипта, из которого выполнена пауза
+}
+
+// NewMachine создает машину состояний и загружает текущее состояние из базы данных
+func NewMachine(db *sql.DB, loggerManager *logger.LoggerManager) (*Machine, error) {
+	record, err := Latest(db)
+	if err != nil {
+		return nil, err
+	}
+	return &Machine{
+		db:      db,
+		logger:  loggerManager,
+		current: record.State,
+	}, nil
+}
+
+// Current возвращает текущее состояние
+func (m *Machine) Current() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current
+}
+
+// CanTransition проверяет, допустим ли переход из текущего состояния в to
+func (m *Machine) CanTransition(to State) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return CanTransition(m.current, to)
+}
+
+// Transition выполняет переход в состояние to и записывает его причину и время в базу данных
+func (m *Machine) Transition(to State, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.transitionLocked(to, reason)
+}
+
+// transitionLocked выполняет переход; вызывающий должен держать m.mu
+func (m *Machine) transitionLocked(to State, reason string) error {
+	from := m.current
+	if !CanTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+	// Из паузы можно вернуться только в тот скрипт, который был приостановлен
+	if from == StatePaused && to.IsRunning() && to != m.pausedFrom {
+		return &TransitionError{From: from, To: to}
+	}
+
+	_, err := m.db.Exec("INSERT INTO status (current_status, previous_status, reason) VALUES (?, ?, ?)",
+		string(to), string(from), reason)
+	if err != nil {
+		return fmt.Errorf("ошибка записи статуса %s: %v", to, err)
+	}
+
+	if to == StatePaused {
+		m.pausedFrom = from
+	}
+	m.current = to
+	if m.logger != nil {
+		m.logger.Info("🔁 Статус: %s -> %s (%s)", from, to, reason)
+	}
+	return nil
+}
+
+// Pause переводит выполняющийся скрипт в состояние paused
+func (m *Machine) Pause(reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.transitionLocked(StatePaused, reason)
+}
+
+// Resume возвращает приостановленный скрипт в его состояние выполнения
+func (m *Machine) Resume(reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current != StatePaused {
+		return &TransitionError{From: m.current, To: m.pausedFrom}
+	}
+	return m.transitionLocked(m.pausedFrom, reason)
+}
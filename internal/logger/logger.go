@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -17,10 +18,30 @@ const (
 	ERROR LogLevel = "ERROR"
 )
 
+// Format - формат строк лога
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat разбирает формат лога; пустая строка - текстовый формат
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return FormatText, fmt.Errorf("неизвестный формат лога: %s (ожидается text или json)", s)
+}
+
 // LoggerManager управляет логированием в файл
 type LoggerManager struct {
 	file   *os.File
 	logger *log.Logger
+	format Format
 }
 
 // NewLoggerManager создает новый экземпляр LoggerManager
@@ -43,9 +64,22 @@ func NewLoggerManager(logFilePath string) (*LoggerManager, error) {
 	return &LoggerManager{
 		file:   file,
 		logger: logger,
+		format: FormatText,
 	}, nil
 }
 
+// SetFormat задает формат строк лога. В формате json каждая строка - отдельный объект
+// с полями time, level и message, удобный для сборщиков логов при запуске без консоли.
+func (l *LoggerManager) SetFormat(format Format) {
+	l.format = format
+	if format == FormatJSON {
+		// Время уже есть в самой записи
+		l.logger.SetFlags(0)
+	} else {
+		l.logger.SetFlags(log.LstdFlags)
+	}
+}
+
 // Close закрывает файл логов
 func (l *LoggerManager) Close() error {
 	return l.file.Close()
@@ -53,9 +87,19 @@ func (l *LoggerManager) Close() error {
 
 // logWithLevel записывает сообщение с указанным уровнем
 func (l *LoggerManager) logWithLevel(level LogLevel, format string, args ...interface{}) {
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	now := time.Now()
 	message := fmt.Sprintf(format, args...)
-	logEntry := fmt.Sprintf("[%s] %s: %s", timestamp, level, message)
+	logEntry := fmt.Sprintf("[%s] %s: %s", now.Format("2006-01-02 15:04:05"), level, message)
+	if l.format == FormatJSON {
+		data, err := json.Marshal(map[string]string{
+			"time":    now.Format(time.RFC3339),
+			"level":   string(level),
+			"message": message,
+		})
+		if err == nil {
+			logEntry = string(data)
+		}
+	}
 
 	// Записываем в файл
 	l.logger.Println(logEntry)
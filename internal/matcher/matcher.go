@@ -0,0 +1,150 @@
+package matcher
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultMinScore - минимальное сходство, при котором название считается найденным
+const DefaultMinScore = 0.8
+
+// Item - предмет из items_list
+type Item struct {
+	ID       int
+	Name     string
+	Category string
+}
+
+// Match - результат сопоставления распознанного названия с items_list
+type Match struct {
+	Item  Item
+	Score float64 // сходство от 0 до 1; 1 - точное совпадение или алиас
+	Alias bool    // найдено по таблице алиасов
+}
+
+// Matcher сопоставляет распознанные OCR названия с предметами items_list
+// по расстоянию Левенштейна и таблице алиасов (item_aliases)
+type Matcher struct {
+	items    []Item
+	names    []string          // нормализованные названия items
+	aliases  map[string]string // нормализованный алиас -> название предмета
+	MinScore float64
+}
+
+// New создает сопоставитель для предметов items и алиасов aliases (алиас -> название предмета)
+func New(items []Item, aliases map[string]string) *Matcher {
+	m := &Matcher{
+		items:    items,
+		names:    make([]string, len(items)),
+		aliases:  make(map[string]string, len(aliases)),
+		MinScore: DefaultMinScore,
+	}
+	for i, item := range items {
+		m.names[i] = Normalize(item.Name)
+	}
+	for alias, name := range aliases {
+		m.aliases[Normalize(alias)] = name
+	}
+	return m
+}
+
+// Find возвращает лучший предмет для названий titles (title и title_short предложения).
+// Предметы категории category предпочитаются: предметы других категорий рассматриваются,
+// только если в категории нет ни одного предмета. false - ни одно название не набрало MinScore.
+func (m *Matcher) Find(category string, titles ...string) (Match, bool) {
+	candidates := m.candidates(category)
+
+	var best Match
+	found := false
+	for _, title := range titles {
+		normalized := Normalize(title)
+		if normalized == "" {
+			continue
+		}
+
+		if name, ok := m.aliases[normalized]; ok {
+			for _, i := range candidates {
+				if m.items[i].Name == name {
+					return Match{Item: m.items[i], Score: 1, Alias: true}, true
+				}
+			}
+		}
+
+		for _, i := range candidates {
+			score := Similarity(normalized, m.names[i])
+			if !found || score > best.Score {
+				best = Match{Item: m.items[i], Score: score}
+				found = true
+			}
+		}
+	}
+	return best, found && best.Score >= m.MinScore
+}
+
+// candidates возвращает индексы предметов категории category или всех предметов, если таких нет
+func (m *Matcher) candidates(category string) []int {
+	var inCategory, all []int
+	for i, item := range m.items {
+		all = append(all, i)
+		if item.Category == category {
+			inCategory = append(inCategory, i)
+		}
+	}
+	if len(inCategory) > 0 {
+		return inCategory
+	}
+	return all
+}
+
+// Normalize приводит название к виду для сравнения: нижний регистр, без знаков препинания и лишних пробелов
+func Normalize(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteRune(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// Similarity возвращает сходство строк от 0 до 1: 1 - расстояние Левенштейна, деленное на длину большей строки
+func Similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(Distance(ra, rb))/float64(longest)
+}
+
+// Distance - расстояние Левенштейна между a и b
+func Distance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,86 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// legacyColumns - колонки, которые бот раньше добавлял при старте в таблицы, созданные до их появления.
+// Базовая миграция 0001 создает таблицы только если их нет, поэтому в старых базах их добавляет 0002.
+var legacyColumns = []struct{ table, column, definition string }{
+	{"ocr_results", "parse_status", "VARCHAR(16) NULL AFTER raw_text, ADD INDEX idx_ocr_results_parse_status (parse_status)"},
+	{"ocr_results", "parse_issues", "TEXT NULL AFTER parse_status"},
+	{"ocr_results", "spool_id", "VARCHAR(64) NULL UNIQUE AFTER parse_issues"},
+	{"ocr_results", "processing_version", "INT NOT NULL DEFAULT 1 AFTER spool_id"},
+	{"ocr_results", "ocr_cache_hit", "BOOLEAN NOT NULL DEFAULT FALSE AFTER processing_version"},
+	{"structured_items", "price_value", "BIGINT NULL AFTER price, ADD INDEX idx_structured_items_price_value (price_value)"},
+	{"structured_items", "match_score", "DECIMAL(4,3) NULL AFTER item_list_id"},
+	{"structured_items", "title_mismatch", "BOOLEAN NOT NULL DEFAULT FALSE AFTER match_score"},
+	{"structured_items", "confidence", "DECIMAL(4,3) NULL AFTER title_mismatch, ADD INDEX idx_structured_items_confidence (confidence)"},
+	{"structured_items", "title_confidence", "DECIMAL(4,3) NULL AFTER confidence"},
+	{"structured_items", "price_confidence", "DECIMAL(4,3) NULL AFTER title_confidence"},
+	{"structured_items", "count_confidence", "DECIMAL(4,3) NULL AFTER price_confidence"},
+	{"structured_items", "owner_confidence", "DECIMAL(4,3) NULL AFTER count_confidence"},
+	{"structured_items", "row_top", "SMALLINT NULL AFTER owner_confidence"},
+	{"structured_items", "row_bottom", "SMALLINT NULL AFTER row_top"},
+	{"structured_items", "review_status", "VARCHAR(16) NULL AFTER row_bottom"},
+	{"structured_items", "reviewed_at", "TIMESTAMP NULL AFTER review_status"},
+	{"structured_items", "processing_version", "INT NOT NULL DEFAULT 1 AFTER reviewed_at, ADD INDEX idx_structured_items_version (ocr_result_id, processing_version)"},
+	{"item_corrections", "corrected_price_value", "BIGINT NULL AFTER corrected_value, ADD INDEX idx_item_corrections_field (item_id, field_name, id)"},
+	{"status", "previous_status", "VARCHAR(100) NULL AFTER current_status"},
+	{"status", "reason", "VARCHAR(255) NULL AFTER previous_status"},
+	{"commands", "args", "TEXT NULL AFTER command"},
+}
+
+// upgradeLegacySchema приводит базу, созданную до миграций, к схеме 0001:
+// добавляет недостающие колонки и заменяет уникальность имени в items_list (db_init)
+// на уникальность пары имя-категория, чтобы предмет мог быть и в скупке, и в продаже
+func upgradeLegacySchema(ctx context.Context, conn *sql.Conn) error {
+	for _, c := range legacyColumns {
+		exists, err := columnExists(ctx, conn, c.table, c.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, "ALTER TABLE "+c.table+" ADD COLUMN "+c.column+" "+c.definition); err != nil {
+			return fmt.Errorf("ошибка добавления колонки %s.%s: %v", c.table, c.column, err)
+		}
+	}
+
+	var nameUnique int
+	err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'items_list' AND INDEX_NAME = 'name'`).Scan(&nameUnique)
+	if err != nil {
+		return fmt.Errorf("ошибка проверки индексов items_list: %v", err)
+	}
+	if nameUnique > 0 {
+		if _, err := conn.ExecContext(ctx, "ALTER TABLE items_list DROP INDEX name"); err != nil {
+			return fmt.Errorf("ошибка удаления уникального индекса name в items_list: %v", err)
+		}
+	}
+
+	var pairUnique int
+	err = conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'items_list' AND INDEX_NAME = 'unique_item_category'`).Scan(&pairUnique)
+	if err != nil {
+		return fmt.Errorf("ошибка проверки индексов items_list: %v", err)
+	}
+	if pairUnique == 0 {
+		if _, err := conn.ExecContext(ctx, "ALTER TABLE items_list ADD UNIQUE KEY unique_item_category (name, category)"); err != nil {
+			return fmt.Errorf("ошибка добавления уникального ключа unique_item_category: %v", err)
+		}
+	}
+	return nil
+}
+
+func columnExists(ctx context.Context, conn *sql.Conn, table, column string) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?", table, column).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки колонки %s.%s: %v", table, column, err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,316 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Миграции схемы лежат в sql/ парами NNNN_имя.up.sql и NNNN_имя.down.sql и встраиваются в бинарник.
+// Примененные версии записываются в schema_migrations; бот и веб-интерфейс схему не меняют,
+// а только проверяют при старте, что все миграции применены (Check).
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+// Table - таблица учета примененных миграций
+const Table = "schema_migrations"
+
+// lockName - именованная блокировка MySQL, чтобы два cmd/migrate не применяли миграции одновременно
+const lockName = "shnyr_schema_migrations"
+
+// Migration - одна версия схемы
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+	upFunc  func(ctx context.Context, conn *sql.Conn) error // миграция, которую нельзя выразить SQL без условий
+}
+
+// State - миграция и время ее применения; пустой AppliedAt - миграция не применена
+type State struct {
+	Migration
+	AppliedAt string
+}
+
+// Applied сообщает, применена ли миграция
+func (s State) Applied() bool {
+	return s.AppliedAt != ""
+}
+
+// goMigrations - миграции на Go по версии; для них в sql/ лежит только .down.sql
+var goMigrations = map[int]func(ctx context.Context, conn *sql.Conn) error{
+	2: upgradeLegacySchema,
+}
+
+// All возвращает все миграции по возрастанию версии
+func All() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения миграций: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("неверное имя файла миграции %s", name)
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, title, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("неверное имя файла миграции %s: ожидается NNNN_имя.up.sql", name)
+		}
+		data, err := files.ReadFile(path.Join("sql", name))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения миграции %s: %v", name, err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		} else if m.Name != title {
+			return nil, fmt.Errorf("у миграции %d два имени: %s и %s", version, m.Name, title)
+		}
+		if direction == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	for version, upFunc := range goMigrations {
+		m := byVersion[version]
+		if m == nil {
+			return nil, fmt.Errorf("для миграции %d на Go нет файла .down.sql", version)
+		}
+		m.upFunc = upFunc
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" && m.upFunc == nil {
+			return nil, fmt.Errorf("у миграции %04d_%s нет .up.sql", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Status возвращает все миграции с отметкой о применении
+func Status(db *sql.DB) ([]State, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]State, 0, len(all))
+	for _, m := range all {
+		states = append(states, State{Migration: m, AppliedAt: applied[m.Version]})
+	}
+	return states, nil
+}
+
+// Check возвращает ошибку, если в базе применены не все миграции. Вызывается при старте бота и веб-интерфейса.
+func Check(db *sql.DB) error {
+	states, err := Status(db)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, s := range states {
+		if !s.Applied() {
+			pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("схема базы устарела, не применены миграции %s: выполните go run ./cmd/migrate up", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// Up применяет все непримененные миграции по порядку и возвращает примененные
+func Up(db *sql.DB) ([]Migration, error) {
+	ctx := context.Background()
+	conn, unlock, err := lock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	states, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, s := range states {
+		if s.Applied() {
+			continue
+		}
+		if err := apply(ctx, conn, s.Migration); err != nil {
+			return done, err
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// Down откатывает steps последних примененных миграций и возвращает откаченные
+func Down(db *sql.DB, steps int) ([]Migration, error) {
+	ctx := context.Background()
+	conn, unlock, err := lock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	states, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(states) - 1; i >= 0 && len(done) < steps; i-- {
+		if !states[i].Applied() {
+			continue
+		}
+		if err := revert(ctx, conn, states[i].Migration); err != nil {
+			return done, err
+		}
+		done = append(done, states[i].Migration)
+	}
+	return done, nil
+}
+
+func ensureTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + Table + ` (
+		version INT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("ошибка создания таблицы %s: %v", Table, err)
+	}
+	return nil
+}
+
+func appliedVersions(db *sql.DB) (map[int]string, error) {
+	rows, err := db.Query("SELECT version, CAST(applied_at AS CHAR) FROM " + Table)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения %s: %v", Table, err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения %s: %v", Table, err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// lock берет именованную блокировку на отдельном соединении: GET_LOCK действует в пределах соединения
+func lock(ctx context.Context, db *sql.DB) (*sql.Conn, func(), error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка подключения к базе: %v", err)
+	}
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 10)", lockName).Scan(&got); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("ошибка блокировки миграций: %v", err)
+	}
+	if !got.Valid || got.Int64 != 1 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("миграции уже применяются другим процессом")
+	}
+	unlock := func() {
+		conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+		conn.Close()
+	}
+	return conn, unlock, nil
+}
+
+// apply выполняет миграцию и записывает ее версию. DDL в MySQL не откатывается транзакцией,
+// поэтому миграции пишутся так, чтобы их можно было повторить после сбоя (IF NOT EXISTS, проверка колонок).
+func apply(ctx context.Context, conn *sql.Conn, m Migration) error {
+	if m.upFunc != nil {
+		if err := m.upFunc(ctx, conn); err != nil {
+			return fmt.Errorf("ошибка миграции %04d_%s: %v", m.Version, m.Name, err)
+		}
+	} else if err := execScript(ctx, conn, m.up); err != nil {
+		return fmt.Errorf("ошибка миграции %04d_%s: %v", m.Version, m.Name, err)
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO "+Table+" (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		return fmt.Errorf("ошибка записи миграции %04d_%s: %v", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+func revert(ctx context.Context, conn *sql.Conn, m Migration) error {
+	if err := execScript(ctx, conn, m.down); err != nil {
+		return fmt.Errorf("ошибка отката миграции %04d_%s: %v", m.Version, m.Name, err)
+	}
+	if _, err := conn.ExecContext(ctx, "DELETE FROM "+Table+" WHERE version = ?", m.Version); err != nil {
+		return fmt.Errorf("ошибка удаления записи миграции %04d_%s: %v", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+// execScript выполняет запросы файла миграции по одному: запрос заканчивается строкой с ";" в конце,
+// строки-комментарии "--" пропускаются
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%v\n%s", err, statement)
+		}
+	}
+	return nil
+}
+
+func splitStatements(script string) []string {
+	var statements []string
+	var current []string
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			statement := strings.TrimSuffix(strings.TrimSpace(strings.Join(current, "\n")), ";")
+			statements = append(statements, statement)
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		statements = append(statements, strings.TrimSpace(strings.Join(current, "\n")))
+	}
+	return statements
+}
@@ -0,0 +1,16 @@
+-- Удаляет все таблицы бота вместе с данными
+DROP VIEW IF EXISTS structured_items_corrected;
+DROP TABLE IF EXISTS item_scans;
+DROP TABLE IF EXISTS schedule_runs;
+DROP TABLE IF EXISTS schedule_rules;
+DROP TABLE IF EXISTS commands;
+DROP TABLE IF EXISTS actions;
+DROP TABLE IF EXISTS status;
+DROP TABLE IF EXISTS item_corrections;
+DROP TABLE IF EXISTS item_aliases;
+DROP TABLE IF EXISTS ocr_cache;
+DROP TABLE IF EXISTS reprocess_runs;
+DROP TABLE IF EXISTS ocr_result_versions;
+DROP TABLE IF EXISTS structured_items;
+DROP TABLE IF EXISTS items_list;
+DROP TABLE IF EXISTS ocr_results;
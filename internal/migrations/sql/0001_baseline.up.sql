@@ -0,0 +1,185 @@
+-- Схема на момент перехода на миграции. Таблицы создаются, только если их нет:
+-- в базах, созданных cmd/db_init или ботом до миграций, они уже есть, недостающие колонки добавляет 0002.
+
+CREATE TABLE IF NOT EXISTS ocr_results (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	image_path VARCHAR(255) NOT NULL,
+	image_data LONGBLOB,
+	ocr_text LONGTEXT,
+	debug_info LONGTEXT,
+	json_data LONGTEXT,
+	raw_text LONGTEXT,
+	parse_status VARCHAR(16) NULL,
+	parse_issues TEXT NULL,
+	spool_id VARCHAR(64) NULL UNIQUE,
+	processing_version INT NOT NULL DEFAULT 1,
+	ocr_cache_hit BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_ocr_results_parse_status (parse_status)
+);
+
+-- Один предмет может быть и в разделе скупки, и в разделе продажи
+CREATE TABLE IF NOT EXISTS items_list (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	category VARCHAR(50) NOT NULL DEFAULT 'consumables',
+	min_price DECIMAL(15,2) DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE KEY unique_item_category (name, category)
+);
+
+CREATE TABLE IF NOT EXISTS structured_items (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	ocr_result_id INT,
+	title VARCHAR(255) NOT NULL,
+	title_short VARCHAR(255),
+	enhancement VARCHAR(10),
+	price VARCHAR(50) NOT NULL,
+	price_value BIGINT NULL,
+	package BOOLEAN DEFAULT FALSE,
+	owner VARCHAR(255),
+	count VARCHAR(100),
+	category VARCHAR(50),
+	item_list_id INT,
+	match_score DECIMAL(4,3) NULL,
+	title_mismatch BOOLEAN NOT NULL DEFAULT FALSE,
+	confidence DECIMAL(4,3) NULL,
+	title_confidence DECIMAL(4,3) NULL,
+	price_confidence DECIMAL(4,3) NULL,
+	count_confidence DECIMAL(4,3) NULL,
+	owner_confidence DECIMAL(4,3) NULL,
+	row_top SMALLINT NULL,
+	row_bottom SMALLINT NULL,
+	review_status VARCHAR(16) NULL,
+	reviewed_at TIMESTAMP NULL,
+	processing_version INT NOT NULL DEFAULT 1,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_structured_items_price_value (price_value),
+	INDEX idx_structured_items_confidence (confidence),
+	INDEX idx_structured_items_version (ocr_result_id, processing_version),
+	FOREIGN KEY (ocr_result_id) REFERENCES ocr_results(id) ON DELETE CASCADE,
+	FOREIGN KEY (item_list_id) REFERENCES items_list(id) ON DELETE SET NULL
+);
+
+-- Вывод OCR, замененный повторной обработкой (cmd/reprocess), и запуски повторной обработки
+CREATE TABLE IF NOT EXISTS ocr_result_versions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	ocr_result_id INT NOT NULL,
+	processing_version INT NOT NULL,
+	ocr_text LONGTEXT,
+	debug_info LONGTEXT,
+	json_data LONGTEXT,
+	raw_text LONGTEXT,
+	parse_status VARCHAR(16) NULL,
+	parse_issues TEXT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE KEY uniq_ocr_result_versions (ocr_result_id, processing_version),
+	FOREIGN KEY (ocr_result_id) REFERENCES ocr_results(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS reprocess_runs (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	processing_version INT NOT NULL,
+	engine VARCHAR(50) NOT NULL,
+	filters TEXT NOT NULL,
+	last_id INT NOT NULL DEFAULT 0,
+	processed INT NOT NULL DEFAULT 0,
+	failed INT NOT NULL DEFAULT 0,
+	started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	finished_at TIMESTAMP NULL
+);
+
+-- Кэш OCR для ocr.cache.store: db
+CREATE TABLE IF NOT EXISTS ocr_cache (
+	cache_key CHAR(64) PRIMARY KEY,
+	data LONGTEXT NOT NULL,
+	hits INT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_hit_at TIMESTAMP NULL
+);
+
+-- Алиасы ссылаются на предмет по имени, а не по id items_list
+CREATE TABLE IF NOT EXISTS item_aliases (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	alias VARCHAR(255) NOT NULL UNIQUE,
+	item_name VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS item_corrections (
+	id INTEGER PRIMARY KEY AUTO_INCREMENT,
+	item_id INTEGER NOT NULL,
+	field_name VARCHAR(50) NOT NULL,
+	current_value TEXT,
+	corrected_value TEXT NOT NULL,
+	corrected_price_value BIGINT NULL,
+	comment TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_item_corrections_field (item_id, field_name, id),
+	FOREIGN KEY (item_id) REFERENCES structured_items(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS status (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	current_status VARCHAR(100) NOT NULL DEFAULT 'stopped',
+	previous_status VARCHAR(100) NULL,
+	reason VARCHAR(255) NULL,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS actions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	action VARCHAR(255) NOT NULL,
+	executed BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS commands (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	command VARCHAR(50) NOT NULL,
+	args TEXT NULL,
+	instance VARCHAR(100) NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	claimed_by VARCHAR(100) NULL,
+	result TEXT NULL,
+	error TEXT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	claimed_at TIMESTAMP NULL,
+	started_at TIMESTAMP NULL,
+	finished_at TIMESTAMP NULL,
+	INDEX idx_commands_status (status, id)
+);
+
+CREATE TABLE IF NOT EXISTS schedule_rules (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL UNIQUE,
+	categories VARCHAR(255) NOT NULL,
+	every VARCHAR(20) NOT NULL,
+	between_hours VARCHAR(20) NULL,
+	enabled BOOLEAN DEFAULT TRUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS schedule_runs (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	rule_name VARCHAR(100) NOT NULL,
+	categories VARCHAR(255) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+	scheduled_at DATETIME NOT NULL,
+	started_at DATETIME NULL,
+	finished_at DATETIME NULL,
+	error TEXT NULL,
+	INDEX idx_schedule_runs_status (status, scheduled_at)
+);
+
+-- История сканирований предметов для приоритизации
+CREATE TABLE IF NOT EXISTS item_scans (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	item_name VARCHAR(255) NOT NULL,
+	category VARCHAR(50) NOT NULL,
+	best_price DECIMAL(15,2) NULL,
+	offers INT NOT NULL DEFAULT 0,
+	duration_ms INT NOT NULL DEFAULT 0,
+	scanned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_item_scans_item (category, item_name, scanned_at)
+);
@@ -0,0 +1 @@
+-- Колонки, добавленные 0002, входят в схему 0001 и удаляются вместе с таблицами при ее откате
@@ -0,0 +1 @@
+DROP VIEW IF EXISTS structured_items_corrected;
@@ -0,0 +1,32 @@
+-- Предложения текущей версии обработки с последними исправлениями полей из item_corrections.
+-- Список полей совпадает с corrections.Fields: новое исправимое поле требует миграции, пересоздающей представление.
+
+CREATE OR REPLACE VIEW structured_items_corrected AS SELECT
+	si.id,
+	si.ocr_result_id,
+	COALESCE((SELECT c.corrected_value FROM item_corrections c WHERE c.item_id = si.id AND c.field_name = 'title' ORDER BY c.id DESC LIMIT 1), si.title) AS title,
+	COALESCE((SELECT c.corrected_value FROM item_corrections c WHERE c.item_id = si.id AND c.field_name = 'title_short' ORDER BY c.id DESC LIMIT 1), si.title_short) AS title_short,
+	COALESCE((SELECT c.corrected_value FROM item_corrections c WHERE c.item_id = si.id AND c.field_name = 'enhancement' ORDER BY c.id DESC LIMIT 1), si.enhancement) AS enhancement,
+	COALESCE((SELECT c.corrected_value FROM item_corrections c WHERE c.item_id = si.id AND c.field_name = 'price' ORDER BY c.id DESC LIMIT 1), si.price) AS price,
+	COALESCE((SELECT c.corrected_price_value FROM item_corrections c WHERE c.item_id = si.id AND c.field_name = 'price' ORDER BY c.id DESC LIMIT 1), si.price_value) AS price_value,
+	COALESCE(CAST((SELECT c.corrected_value FROM item_corrections c WHERE c.item_id = si.id AND c.field_name = 'package' ORDER BY c.id DESC LIMIT 1) AS UNSIGNED), si.package) AS package,
+	COALESCE((SELECT c.corrected_value FROM item_corrections c WHERE c.item_id = si.id AND c.field_name = 'owner' ORDER BY c.id DESC LIMIT 1), si.owner) AS owner,
+	COALESCE((SELECT c.corrected_value FROM item_corrections c WHERE c.item_id = si.id AND c.field_name = 'count' ORDER BY c.id DESC LIMIT 1), si.count) AS count,
+	COALESCE((SELECT c.corrected_value FROM item_corrections c WHERE c.item_id = si.id AND c.field_name = 'category' ORDER BY c.id DESC LIMIT 1), si.category) AS category,
+	si.item_list_id,
+	si.match_score,
+	si.title_mismatch,
+	si.confidence,
+	si.title_confidence,
+	si.price_confidence,
+	si.count_confidence,
+	si.owner_confidence,
+	si.row_top,
+	si.row_bottom,
+	si.review_status,
+	si.reviewed_at,
+	si.processing_version,
+	si.created_at,
+	EXISTS (SELECT 1 FROM item_corrections c WHERE c.item_id = si.id) AS corrected
+FROM structured_items si
+INNER JOIN ocr_results ocr ON ocr.id = si.ocr_result_id AND ocr.processing_version = si.processing_version;
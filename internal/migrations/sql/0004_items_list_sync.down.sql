@@ -0,0 +1,6 @@
+-- Удаленные предметы при откате становятся снова активными
+ALTER TABLE items_list
+	DROP INDEX idx_items_list_active,
+	DROP COLUMN deleted_at,
+	DROP COLUMN updated_at,
+	DROP COLUMN position;
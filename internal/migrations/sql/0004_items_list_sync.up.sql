@@ -0,0 +1,9 @@
+-- Каталог items_list синхронизируется с items.txt без пересоздания: предмет, убранный из файла,
+-- помечается deleted_at и сохраняет id, на который ссылаются structured_items; position - порядок в файле
+ALTER TABLE items_list
+	ADD COLUMN position INT NOT NULL DEFAULT 0 AFTER min_price,
+	ADD COLUMN updated_at TIMESTAMP NULL AFTER created_at,
+	ADD COLUMN deleted_at TIMESTAMP NULL AFTER updated_at,
+	ADD INDEX idx_items_list_active (category, deleted_at, position);
+
+UPDATE items_list SET position = id;
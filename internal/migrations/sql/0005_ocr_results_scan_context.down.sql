@@ -0,0 +1,3 @@
+ALTER TABLE ocr_results
+	DROP COLUMN item_name,
+	DROP COLUMN category;
@@ -0,0 +1,5 @@
+-- Раздел и искомый предмет, при сканировании которых снята страница. Раньше они были видны только
+-- в structured_items, поэтому для страницы без предложений cmd/reprocess не знал категорию.
+ALTER TABLE ocr_results
+	ADD COLUMN category VARCHAR(50) NULL AFTER image_path,
+	ADD COLUMN item_name VARCHAR(255) NULL AFTER category;
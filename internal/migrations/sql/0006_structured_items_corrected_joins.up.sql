@@ -0,0 +1,55 @@
+-- Представление structured_items_corrected без коррелированных подзапросов: последние исправления
+-- каждого поля находятся одним проходом по item_corrections и присоединяются по первичному ключу.
+-- Раньше на каждую строку выполнялось по подзапросу на поле, и поиск по названию в веб-интерфейсе
+-- выполнял их для всех предложений. Список полей совпадает с corrections.Fields.
+
+CREATE OR REPLACE VIEW structured_items_corrected AS SELECT
+	si.id,
+	si.ocr_result_id,
+	COALESCE(c_title.corrected_value, si.title) AS title,
+	COALESCE(c_title_short.corrected_value, si.title_short) AS title_short,
+	COALESCE(c_enhancement.corrected_value, si.enhancement) AS enhancement,
+	COALESCE(c_price.corrected_value, si.price) AS price,
+	COALESCE(c_price.corrected_price_value, si.price_value) AS price_value,
+	COALESCE(CAST(c_package.corrected_value AS UNSIGNED), si.package) AS package,
+	COALESCE(c_owner.corrected_value, si.owner) AS owner,
+	COALESCE(c_count.corrected_value, si.count) AS count,
+	COALESCE(c_category.corrected_value, si.category) AS category,
+	si.item_list_id,
+	si.match_score,
+	si.title_mismatch,
+	si.confidence,
+	si.title_confidence,
+	si.price_confidence,
+	si.count_confidence,
+	si.owner_confidence,
+	si.row_top,
+	si.row_bottom,
+	si.review_status,
+	si.reviewed_at,
+	si.processing_version,
+	si.created_at,
+	latest.item_id IS NOT NULL AS corrected
+FROM structured_items si
+INNER JOIN ocr_results ocr ON ocr.id = si.ocr_result_id AND ocr.processing_version = si.processing_version
+LEFT JOIN (
+	SELECT c.item_id,
+		MAX(CASE WHEN c.field_name = 'title' THEN c.id END) AS title_id,
+		MAX(CASE WHEN c.field_name = 'title_short' THEN c.id END) AS title_short_id,
+		MAX(CASE WHEN c.field_name = 'enhancement' THEN c.id END) AS enhancement_id,
+		MAX(CASE WHEN c.field_name = 'price' THEN c.id END) AS price_id,
+		MAX(CASE WHEN c.field_name = 'package' THEN c.id END) AS package_id,
+		MAX(CASE WHEN c.field_name = 'owner' THEN c.id END) AS owner_id,
+		MAX(CASE WHEN c.field_name = 'count' THEN c.id END) AS count_id,
+		MAX(CASE WHEN c.field_name = 'category' THEN c.id END) AS category_id
+	FROM item_corrections c
+	GROUP BY c.item_id
+) latest ON latest.item_id = si.id
+LEFT JOIN item_corrections c_title ON c_title.id = latest.title_id
+LEFT JOIN item_corrections c_title_short ON c_title_short.id = latest.title_short_id
+LEFT JOIN item_corrections c_enhancement ON c_enhancement.id = latest.enhancement_id
+LEFT JOIN item_corrections c_price ON c_price.id = latest.price_id
+LEFT JOIN item_corrections c_package ON c_package.id = latest.package_id
+LEFT JOIN item_corrections c_owner ON c_owner.id = latest.owner_id
+LEFT JOIN item_corrections c_count ON c_count.id = latest.count_id
+LEFT JOIN item_corrections c_category ON c_category.id = latest.category_id;
@@ -0,0 +1,55 @@
+package model
+
+import "fmt"
+
+// Category - раздел брокера, в котором снято предложение
+type Category string
+
+const (
+	CategoryBuyConsumables  Category = "buy_consumables"
+	CategoryBuyEquipment    Category = "buy_equipment"
+	CategorySellConsumables Category = "sell_consumables"
+	CategorySellEquipment   Category = "sell_equipment"
+	// CategoryUnknown - раздел не определен, например у предложений, сохраненных без категории
+	CategoryUnknown Category = "unknown"
+)
+
+// Categories - категории предметов в порядке обхода: сначала раздел скупки, затем раздел продажи
+var Categories = []Category{CategoryBuyConsumables, CategoryBuyEquipment, CategorySellConsumables, CategorySellEquipment}
+
+// ParseCategory проверяет, что s - одна из категорий Categories
+func ParseCategory(s string) (Category, error) {
+	for _, category := range Categories {
+		if string(category) == s {
+			return category, nil
+		}
+	}
+	return CategoryUnknown, fmt.Errorf("неизвестная категория %q", s)
+}
+
+// IsBuy сообщает, что категория относится к разделу скупки: лучшее предложение - максимальная цена
+func (c Category) IsBuy() bool {
+	return c == CategoryBuyConsumables || c == CategoryBuyEquipment
+}
+
+// IsEquipment сообщает, что категория относится к экипировке
+func (c Category) IsEquipment() bool {
+	return c == CategoryBuyEquipment || c == CategorySellEquipment
+}
+
+// Label возвращает название категории для интерфейса
+func (c Category) Label() string {
+	switch c {
+	case CategoryBuyConsumables:
+		return "💰 Покупай! (расходники)"
+	case CategoryBuyEquipment:
+		return "💰 Покупай! (экипировка)"
+	case CategorySellConsumables:
+		return "💸 Продавай! (расходники)"
+	case CategorySellEquipment:
+		return "💸 Продавай! (экипировка)"
+	case CategoryUnknown:
+		return "❓ Неизвестно"
+	}
+	return string(c)
+}
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"shnyr/internal/price"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// Улучшение - число до 99, в выводе cpp_ocr иногда с плюсом
+	enhancementPattern = regexp.MustCompile(`^\+?\d{1,2}$`)
+	// Количество - целое число, как и цена может быть с разделителями разрядов
+	countPattern = regexp.MustCompile(`^(\d+|\d{1,3}(,\d{3})+)$`)
+)
+
+// Listing - предложение брокера: строка structured_items с типизированными полями
+type Listing struct {
+	ID            int
+	ObservationID int // ocr_results.id
+	ItemID        int // items_list.id; 0 - предложение не связано с предметом
+	Title         string
+	TitleShort    string
+	Enhancement   int
+	Price         int64  // 0 - цену не удалось разобрать, см. PriceText
+	PriceText     string // цена в том виде, в каком ее распознал OCR
+	Package       bool
+	Owner         string
+	Count         int // 0 - количество не указано
+	Category      Category
+	// Уверенность распознавания от 0 до 1; 0 - движок ее не сообщил
+	Confidence      float64
+	FieldConfidence map[string]float64
+	RowTop          int
+	RowBottom       int
+	CreatedAt       time.Time
+}
+
+// FieldError - поле предложения OCR, которое не удалось перевести в Listing
+type FieldError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// IsFieldError сообщает, что err (в том числе объединенная errors.Join) содержит FieldError поля field
+func IsFieldError(err error, field string) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if IsFieldError(e, field) {
+				return true
+			}
+		}
+		return false
+	}
+	var fieldErr *FieldError
+	return errors.As(err, &fieldErr) && fieldErr.Field == field
+}
+
+// NewListing переводит предложение из JSON результата OCR в Listing категории category.
+// Поля, которые не удалось разобрать, остаются нулевыми, а ошибка перечисляет их (FieldError через errors.Join):
+// вызывающий решает, сохранять ли такое предложение.
+func NewListing(item OCRItem, category Category) (Listing, error) {
+	listing := Listing{
+		Title:           strings.TrimSpace(item.Title),
+		TitleShort:      strings.TrimSpace(item.TitleShort),
+		PriceText:       item.Price,
+		Package:         item.Package,
+		Owner:           item.Owner,
+		Category:        category,
+		Confidence:      item.Confidence,
+		FieldConfidence: item.FieldConfidence,
+	}
+	if item.RowBottom > item.RowTop {
+		listing.RowTop, listing.RowBottom = item.RowTop, item.RowBottom
+	}
+
+	var errs []error
+	if listing.Title == "" {
+		errs = append(errs, &FieldError{Field: "title", Value: item.Title, Err: errors.New("пустое название")})
+	}
+	value, err := price.Parse(item.Price)
+	if err != nil {
+		errs = append(errs, &FieldError{Field: "price", Value: item.Price, Err: err})
+	}
+	listing.Price = value
+	if listing.Enhancement, err = ParseEnhancement(item.Enhancement); err != nil {
+		errs = append(errs, &FieldError{Field: "enhancement", Value: item.Enhancement, Err: err})
+	}
+	if listing.Count, err = ParseCount(item.Count); err != nil {
+		errs = append(errs, &FieldError{Field: "count", Value: item.Count, Err: err})
+	}
+	return listing, errors.Join(errs...)
+}
+
+// ParseEnhancement переводит улучшение ("", "7" или "+7") в число; пустое улучшение - 0
+func ParseEnhancement(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if !enhancementPattern.MatchString(s) {
+		return 0, fmt.Errorf("улучшение %q должно быть числом до 99", s)
+	}
+	return strconv.Atoi(strings.TrimPrefix(s, "+"))
+}
+
+// ParseCount переводит количество ("", "15" или "1,500") в число; пустое количество - 0
+func ParseCount(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if !countPattern.MatchString(s) {
+		return 0, fmt.Errorf("количество %q должно быть целым числом", s)
+	}
+	count, err := strconv.Atoi(strings.ReplaceAll(s, ",", ""))
+	if err != nil {
+		return 0, fmt.Errorf("количество %q слишком велико", s)
+	}
+	return count, nil
+}
+
+// RowConfidence возвращает уверенность предложения: переданную движком, худшую из уверенностей полей
+// или imageConfidence - уверенность всего изображения; false - уверенность неизвестна
+func (l Listing) RowConfidence(imageConfidence float64, hasImageConfidence bool) (float64, bool) {
+	if l.Confidence > 0 {
+		return l.Confidence, true
+	}
+	if len(l.FieldConfidence) > 0 {
+		confidence := 1.0
+		for _, value := range l.FieldConfidence {
+			confidence = min(confidence, value)
+		}
+		return confidence, true
+	}
+	return imageConfidence, hasImageConfidence
+}
+
+// Item - предмет из items_list, по которому бот ищет предложения
+type Item struct {
+	ID        int
+	Name      string
+	Category  Category
+	MinPrice  int64 // порог цены из файла списка предметов; 0 - не задан
+	CreatedAt time.Time
+}
+
+// Observation - один снимок страницы брокера и результат его распознавания (строка ocr_results)
+type Observation struct {
+	ID                int
+	ImagePath         string
+	ImageData         []byte
+	OCRText           string
+	DebugInfo         string
+	JSONData          string
+	RawText           string
+	ParseStatus       string
+	ProcessingVersion int
+	CreatedAt         time.Time
+	Listings          []Listing
+}
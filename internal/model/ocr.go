@@ -0,0 +1,62 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+)
+
+// OCRItem - предложение из structured_data результата OCR в том виде, в каком его вернул движок.
+// Значения - распознанные строки; типизированное предложение получается через NewListing.
+type OCRItem struct {
+	Title       string `json:"title"`
+	TitleShort  string `json:"title_short"`
+	Enhancement string `json:"enhancement"`
+	Price       string `json:"price"`
+	Package     bool   `json:"package"`
+	Owner       string `json:"owner"`
+	Count       string `json:"count"`
+	// Начиная со schema_version 2: уверенность распознавания от 0 до 1 и строка предложения на изображении
+	Confidence      float64            `json:"confidence,omitempty"`
+	FieldConfidence map[string]float64 `json:"field_confidence,omitempty"` // title, price, count, owner
+	RowTop          int                `json:"row_top,omitempty"`
+	RowBottom       int                `json:"row_bottom,omitempty"`
+}
+
+// OCRResult - JSON результата OCR, который печатают движки и который хранится в ocr_results.json_data
+type OCRResult struct {
+	SchemaVersion int    `json:"schema_version,omitempty"`
+	ImageFile     string `json:"image_file"`
+	Processing    struct {
+		Enlargement         string `json:"enlargement"`
+		Grayscale           bool   `json:"grayscale"`
+		Denoising           string `json:"denoising"`
+		ContrastEnhancement string `json:"contrast_enhancement"`
+		Binarization        string `json:"binarization"`
+		OCREngine           string `json:"ocr_engine"`
+		OCRLanguages        string `json:"ocr_languages"`
+		OCRMode             string `json:"ocr_mode"`
+	} `json:"processing"`
+	TextRecognition struct {
+		Success        bool      `json:"success"`
+		RawText        string    `json:"raw_text"`
+		StructuredData []OCRItem `json:"structured_data"`
+		Confidence     string    `json:"confidence"`
+	} `json:"text_recognition"`
+}
+
+// ParseConfidence переводит уверенность из text_recognition.confidence ("0.93", "93%" или "93") в долю от 0 до 1
+func ParseConfidence(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	percent := strings.HasSuffix(s, "%")
+	value, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || value < 0 {
+		return 0, false
+	}
+	if percent || value > 1 {
+		value /= 100
+	}
+	if value > 1 {
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,269 @@
+package ocr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"shnyr/internal/config"
+	"shnyr/internal/model"
+	"sync/atomic"
+)
+
+// Хранилища кэша OCR в секции ocr.cache.store файла config.yaml
+const (
+	CacheStoreFile = "file"
+	CacheStoreDB   = "db"
+)
+
+// DefaultCacheDir - каталог кэша OCR, если ocr.cache.dir не задан
+const DefaultCacheDir = "./ocr_cache"
+
+// CacheStore хранит записи кэша OCR по ключу. Get возвращает false, если записи нет;
+// ошибка вместе с true - запись прочитана, но не удался сопутствующий учет попадания.
+type CacheStore interface {
+	Get(key string) ([]byte, bool, error)
+	Put(key string, data []byte) error
+}
+
+// CacheFlusher - хранилище, накапливающее учет попаданий; Flush записывает накопленное
+type CacheFlusher interface {
+	Flush() error
+}
+
+// FileCacheStore - кэш OCR в каталоге на диске: запись - файл <ключ>.json в подкаталоге по первым символам ключа
+type FileCacheStore struct {
+	dir string
+}
+
+// NewFileCacheStore открывает кэш в каталоге dir, создавая его при необходимости
+func NewFileCacheStore(dir string) (*FileCacheStore, error) {
+	if dir == "" {
+		dir = DefaultCacheDir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога кэша OCR %s: %v", dir, err)
+	}
+	return &FileCacheStore{dir: dir}, nil
+}
+
+func (s *FileCacheStore) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key+".json")
+}
+
+// Get читает запись кэша
+func (s *FileCacheStore) Get(key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("ошибка чтения кэша OCR: %v", err)
+	}
+	return data, true, nil
+}
+
+// Put записывает запись кэша через временный файл, чтобы параллельный Get не прочитал ее наполовину
+func (s *FileCacheStore) Put(key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("ошибка создания каталога кэша OCR: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("ошибка записи кэша OCR: %v", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("ошибка записи кэша OCR: %v", err)
+	}
+	return nil
+}
+
+// cachedResult - запись кэша: вывод движка и итог разбора до применения словаря замен
+type cachedResult struct {
+	Output   string       `json:"output"`
+	Debug    string       `json:"debug"`
+	JSON     string       `json:"json"`
+	RawText  string       `json:"raw_text"`
+	Status   string       `json:"parse_status"`
+	Version  int          `json:"schema_version"`
+	Warnings []ParseIssue `json:"warnings,omitempty"`
+	Errors   []ParseIssue `json:"errors,omitempty"`
+}
+
+// Cache - кэш результатов OCR по хэшу пикселей изображения и версии движка.
+// Попадание пропускает распознавание; словарь замен применяется к результату из кэша как к новому.
+type Cache struct {
+	store   CacheStore
+	version string
+	hits    atomic.Int64
+	misses  atomic.Int64
+}
+
+// NewCache создает кэш над store для движка и настроек cfg
+func NewCache(store CacheStore, cfg config.OCR) *Cache {
+	return &Cache{store: store, version: EngineVersion(cfg)}
+}
+
+// NewCacheFromConfig создает кэш по секции ocr.cache; nil - кэш выключен.
+// Хранилище db передается снаружи (database.NewOCRCacheStore), так как ocr не работает с базой.
+func NewCacheFromConfig(cfg config.OCR, dbStore CacheStore) (*Cache, error) {
+	if !cfg.Cache.Enabled {
+		return nil, nil
+	}
+	switch cfg.Cache.Store {
+	case "", CacheStoreFile:
+		store, err := NewFileCacheStore(cfg.Cache.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return NewCache(store, cfg), nil
+	case CacheStoreDB:
+		if dbStore == nil {
+			return nil, fmt.Errorf("для ocr.cache.store: db нужна база данных")
+		}
+		return NewCache(dbStore, cfg), nil
+	}
+	return nil, fmt.Errorf("неизвестное хранилище кэша OCR: %s", cfg.Cache.Store)
+}
+
+// EngineVersion возвращает версию движка для ключа кэша: имя движка, версию схемы JSON,
+// размер и время изменения файла движка (cpp_ocr.exe, tesseract, набор глифов), его параметры
+// и настройки построчного распознавания. Обновление движка или настроек дает новые ключи.
+func EngineVersion(cfg config.OCR) string {
+	engine := cfg.Engine
+	if engine == "" {
+		engine = EngineCppOCR
+	}
+	version := fmt.Sprintf("%s/schema%d/%s", engine, SchemaVersion, cfg.Cache.Version)
+
+	fingerprint := func(path string) string {
+		info, err := os.Stat(path)
+		if err != nil {
+			return path
+		}
+		return fmt.Sprintf("%s:%d:%d", path, info.Size(), info.ModTime().Unix())
+	}
+	switch engine {
+	case EngineCppOCR:
+		version += "/" + fingerprint(cfg.CppOCRPath)
+	case EngineTesseract:
+		version += fmt.Sprintf("/%s/%s/%d", fingerprint(cfg.TesseractPath), cfg.TesseractLang, cfg.TesseractPSM)
+	case EngineHTTP:
+		version += "/" + cfg.HTTPURL
+	case EngineStub:
+		version += "/" + cfg.StubDir
+	case EngineGlyph:
+		version += "/" + fingerprint(cfg.GlyphSet)
+	}
+	if cfg.Rows.Enabled {
+		version += fmt.Sprintf("/rows%+v", cfg.Rows)
+	}
+	return version
+}
+
+// Key возвращает ключ изображения: SHA-256 размеров, пикселей и версии движка
+func (c *Cache) Key(img image.Image) string {
+	bounds := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(bounds)
+		draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%dx%d\n", c.version, bounds.Dx(), bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		start := rgba.PixOffset(bounds.Min.X, y)
+		hash.Write(rgba.Pix[start : start+bounds.Dx()*4])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get возвращает результат из кэша; nil - промах. Ошибка хранилища или поврежденная запись считаются промахом
+// и возвращаются, чтобы вызывающий записал их в лог; ошибка учета попадания возвращается вместе с результатом.
+func (c *Cache) Get(key string) (*Result, error) {
+	data, ok, err := c.store.Get(key)
+	if !ok {
+		c.misses.Add(1)
+		return nil, err
+	}
+
+	var cached cachedResult
+	if jsonErr := json.Unmarshal(data, &cached); jsonErr != nil {
+		c.misses.Add(1)
+		return nil, fmt.Errorf("поврежденная запись кэша OCR %s: %v", key, jsonErr)
+	}
+	parse := &ParseResult{
+		Status:   cached.Status,
+		Version:  cached.Version,
+		Debug:    cached.Debug,
+		JSON:     cached.JSON,
+		RawText:  cached.RawText,
+		Warnings: cached.Warnings,
+		Errors:   cached.Errors,
+	}
+	if cached.Status != ParseInvalid {
+		var parsed model.OCRResult
+		if err := json.Unmarshal([]byte(cached.JSON), &parsed); err == nil {
+			parse.Result = &parsed
+		}
+	}
+	c.hits.Add(1)
+	return &Result{
+		Output:  cached.Output,
+		Debug:   cached.Debug,
+		JSON:    cached.JSON,
+		RawText: cached.RawText,
+		Parsed:  parse.Result,
+		Parse:   parse,
+		Cached:  true,
+	}, err
+}
+
+// Put сохраняет результат движка. Результаты без разобранного JSON и с нераспознанными полями
+// не кэшируются: сбой движка не должен повторяться для той же страницы.
+func (c *Cache) Put(key string, result *Result) error {
+	if result == nil || result.Parse == nil || result.Parse.Status == ParseInvalid || result.FieldErrors > 0 {
+		return nil
+	}
+	data, err := json.Marshal(cachedResult{
+		Output:   result.Output,
+		Debug:    result.Debug,
+		JSON:     result.JSON,
+		RawText:  result.RawText,
+		Status:   result.Parse.Status,
+		Version:  result.Parse.Version,
+		Warnings: result.Parse.Warnings,
+		Errors:   result.Parse.Errors,
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации результата OCR для кэша: %v", err)
+	}
+	return c.store.Put(key, data)
+}
+
+// Flush записывает накопленный хранилищем учет попаданий, если хранилище его накапливает
+func (c *Cache) Flush() error {
+	if flusher, ok := c.store.(CacheFlusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// Stats возвращает число попаданий и промахов с создания кэша
+func (c *Cache) Stats() (hits, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
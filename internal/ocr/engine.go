@@ -0,0 +1,273 @@
+package ocr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"shnyr/internal/config"
+	"shnyr/internal/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Имена движков OCR в секции ocr.engine файла config.yaml
+const (
+	EngineCppOCR    = "cpp_ocr"
+	EngineTesseract = "tesseract"
+	EngineHTTP      = "http"
+	EngineStub      = "stub"
+)
+
+// Result - результат распознавания одного изображения
+type Result struct {
+	Output  string           // полный вывод движка, сохраняется в ocr_results.ocr_text
+	Debug   string           // отладочная информация движка
+	JSON    string           // JSON в формате model.OCRResult
+	RawText string           // распознанный текст целиком
+	Parsed  *model.OCRResult // разобранный JSON; nil, если движок вернул некорректный JSON
+	Parse   *ParseResult     // статус, замечания и ошибки разбора
+	Cached  bool             // результат взят из кэша OCR без распознавания
+	// FieldErrors - число полей, которые движок не смог распознать при построчном распознавании
+	FieldErrors int
+}
+
+// Engine распознает текст на изображении
+type Engine interface {
+	// Name возвращает имя движка для логов и отчетов
+	Name() string
+	// Recognize распознает изображение imagePath
+	Recognize(imagePath string) (*Result, error)
+}
+
+// NewEngine создает движок OCR по настройкам из config.yaml
+func NewEngine(cfg config.OCR) (Engine, error) {
+	switch cfg.Engine {
+	case "", EngineCppOCR:
+		if cfg.CppOCRPath == "" {
+			return nil, fmt.Errorf("для движка cpp_ocr не задан ocr.cpp_ocr_path")
+		}
+		return NewCppOCREngine(cfg.CppOCRPath), nil
+	case EngineTesseract:
+		return NewTesseractEngine(cfg.TesseractPath, cfg.TesseractLang, cfg.TesseractPSM), nil
+	case EngineHTTP:
+		if cfg.HTTPURL == "" {
+			return nil, fmt.Errorf("для движка http не задан ocr.http_url")
+		}
+		timeout := 30 * time.Second
+		if cfg.HTTPTimeout != "" {
+			d, err := time.ParseDuration(cfg.HTTPTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("неверный ocr.http_timeout %q: %v", cfg.HTTPTimeout, err)
+			}
+			timeout = d
+		}
+		return NewHTTPEngine(cfg.HTTPURL, timeout), nil
+	case EngineStub:
+		return NewStubEngine(cfg.StubDir)
+	case EngineGlyph:
+		// Целиком изображение glyph распознает только в текст без structured_data: предложения дает построчное распознавание
+		if !cfg.Rows.Enabled {
+			return nil, fmt.Errorf("движок glyph работает только с построчным распознаванием: включите ocr.rows.enabled и задайте колонки ocr.rows")
+		}
+		return NewGlyphEngine(cfg.GlyphSet)
+	}
+	return nil, fmt.Errorf("неизвестный движок OCR: %s", cfg.Engine)
+}
+
+// resultFromOutput разбирает вывод движка, печатающего отладку и JSON в одном потоке
+func resultFromOutput(output string) *Result {
+	parsed := ParseOutput(output)
+	return &Result{
+		Output:  output,
+		Debug:   parsed.Debug,
+		JSON:    parsed.JSON,
+		RawText: parsed.RawText,
+		Parsed:  parsed.Result,
+		Parse:   parsed,
+	}
+}
+
+// resultFromParsed собирает результат движка, возвращающего только текст или готовую структуру
+func resultFromParsed(parsed *model.OCRResult, debugInfo string) (*Result, error) {
+	parsed.SchemaVersion = SchemaVersion
+	data, err := json.Marshal(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации результата OCR: %v", err)
+	}
+	return &Result{
+		Output:  string(data),
+		Debug:   debugInfo,
+		JSON:    string(data),
+		RawText: parsed.TextRecognition.RawText,
+		Parsed:  parsed,
+		Parse:   ValidateResult(parsed),
+	}, nil
+}
+
+// CppOCREngine запускает внешний cpp_ocr.exe, печатающий отладку и JSON между маркерами
+type CppOCREngine struct {
+	path string
+}
+
+// NewCppOCREngine создает движок для исполняемого файла cpp_ocr по пути path
+func NewCppOCREngine(path string) *CppOCREngine {
+	return &CppOCREngine{path: path}
+}
+
+func (e *CppOCREngine) Name() string {
+	return EngineCppOCR
+}
+
+func (e *CppOCREngine) Recognize(imagePath string) (*Result, error) {
+	cmd := exec.Command(e.path, imagePath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении OCR: %v, вывод: %s", err, string(output))
+	}
+	return resultFromOutput(string(output)), nil
+}
+
+// TesseractEngine распознает изображение через tesseract CLI.
+// Tesseract возвращает только текст, поэтому structured_data остается пустым.
+type TesseractEngine struct {
+	path string
+	lang string
+	psm  int
+}
+
+// NewTesseractEngine создает движок tesseract. Пустые параметры заменяются значениями по умолчанию.
+func NewTesseractEngine(path string, lang string, psm int) *TesseractEngine {
+	if path == "" {
+		path = "tesseract"
+	}
+	if lang == "" {
+		lang = "eng"
+	}
+	if psm == 0 {
+		psm = 6
+	}
+	return &TesseractEngine{path: path, lang: lang, psm: psm}
+}
+
+func (e *TesseractEngine) Name() string {
+	return EngineTesseract
+}
+
+func (e *TesseractEngine) Recognize(imagePath string) (*Result, error) {
+	cmd := exec.Command(e.path, imagePath, "stdout", "-l", e.lang, "--psm", strconv.Itoa(e.psm))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении tesseract: %v, вывод: %s", err, stderr.String())
+	}
+
+	var parsed model.OCRResult
+	parsed.ImageFile = imagePath
+	parsed.Processing.OCREngine = EngineTesseract
+	parsed.Processing.OCRLanguages = e.lang
+	parsed.Processing.OCRMode = "psm " + strconv.Itoa(e.psm)
+	parsed.TextRecognition.Success = true
+	parsed.TextRecognition.RawText = strings.TrimSpace(stdout.String())
+	return resultFromParsed(&parsed, strings.TrimSpace(stderr.String()))
+}
+
+// HTTPEngine отправляет PNG на HTTP-сервис OCR. Сервис отвечает JSON в формате model.OCRResult.
+type HTTPEngine struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPEngine создает движок для сервиса по адресу url
+func NewHTTPEngine(url string, timeout time.Duration) *HTTPEngine {
+	return &HTTPEngine{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (e *HTTPEngine) Name() string {
+	return EngineHTTP
+}
+
+func (e *HTTPEngine) Recognize(imagePath string) (*Result, error) {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения изображения %s: %v", imagePath, err)
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса OCR: %v", err)
+	}
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("X-Image-File", filepath.Base(imagePath))
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к сервису OCR: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения ответа сервиса OCR: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("сервис OCR вернул %d: %s", resp.StatusCode, string(body))
+	}
+	return resultFromOutput(string(body)), nil
+}
+
+// StubEngine возвращает заготовленные JSON-ответы вместо распознавания.
+// Ответ для image.png берется из файла image.json каталога, иначе из default.json.
+type StubEngine struct {
+	responses map[string]string
+}
+
+// NewStubEngine загружает заготовленные ответы из каталога dir
+func NewStubEngine(dir string) (*StubEngine, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("для движка stub не задан ocr.stub_dir")
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения каталога %s: %v", dir, err)
+	}
+	responses := make(map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения %s: %v", file, err)
+		}
+		responses[strings.TrimSuffix(filepath.Base(file), ".json")] = string(data)
+	}
+	return NewStubEngineWithResponses(responses), nil
+}
+
+// NewStubEngineWithResponses создает движок с ответами по имени изображения без расширения
+func NewStubEngineWithResponses(responses map[string]string) *StubEngine {
+	return &StubEngine{responses: responses}
+}
+
+func (e *StubEngine) Name() string {
+	return EngineStub
+}
+
+func (e *StubEngine) Recognize(imagePath string) (*Result, error) {
+	name := strings.TrimSuffix(filepath.Base(imagePath), filepath.Ext(imagePath))
+	response, ok := e.responses[name]
+	if !ok {
+		response, ok = e.responses["default"]
+	}
+	if !ok {
+		return nil, fmt.Errorf("нет заготовленного ответа для %s", imagePath)
+	}
+	return resultFromOutput(response), nil
+}
@@ -0,0 +1,372 @@
+package ocr
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"shnyr/internal/model"
+	"sort"
+	"strings"
+)
+
+// EngineGlyph - встроенный распознаватель по шаблонам глифов шрифта интерфейса брокера
+const EngineGlyph = "glyph"
+
+// DefaultInkThreshold - минимальная яркость канала, с которой пиксель считается текстом.
+// Текст брокера светлый (белый, желтый, зеленый, красный) на темном фоне.
+const DefaultInkThreshold = 110
+
+// Glyph - шаблон одного символа: битовая маска по плотной рамке символа
+type Glyph struct {
+	Char   string `json:"char"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Dy     int    `json:"dy"`   // смещение нижнего края символа относительно базовой линии строки
+	Bits   string `json:"bits"` // строки маски подряд, '#' - текст, '.' - фон
+	Count  int    `json:"count"`
+}
+
+// GlyphSet - набор шаблонов глифов, собранный командой glyph_trainer
+type GlyphSet struct {
+	Threshold  int     `json:"threshold"`   // порог яркости, с которым собирался набор
+	SpaceWidth int     `json:"space_width"` // ширина промежутка, начиная с которой он считается пробелом
+	Glyphs     []Glyph `json:"glyphs"`
+
+	bySize map[[2]int][]*Glyph
+}
+
+// NewGlyphSet создает пустой набор глифов
+func NewGlyphSet(threshold int) *GlyphSet {
+	if threshold <= 0 {
+		threshold = DefaultInkThreshold
+	}
+	return &GlyphSet{Threshold: threshold, SpaceWidth: 3}
+}
+
+// LoadGlyphSet читает набор глифов из JSON-файла
+func LoadGlyphSet(path string) (*GlyphSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения набора глифов %s: %v", path, err)
+	}
+	var set GlyphSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("ошибка разбора набора глифов %s: %v", path, err)
+	}
+	if set.Threshold <= 0 {
+		set.Threshold = DefaultInkThreshold
+	}
+	if set.SpaceWidth <= 0 {
+		set.SpaceWidth = 3
+	}
+	set.index()
+	return &set, nil
+}
+
+// Save записывает набор глифов в JSON-файл
+func (s *GlyphSet) Save(path string) error {
+	sort.SliceStable(s.Glyphs, func(i, j int) bool {
+		if s.Glyphs[i].Char != s.Glyphs[j].Char {
+			return s.Glyphs[i].Char < s.Glyphs[j].Char
+		}
+		return s.Glyphs[i].Count > s.Glyphs[j].Count
+	})
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации набора глифов: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи набора глифов %s: %v", path, err)
+	}
+	return nil
+}
+
+// Add добавляет образец символа char. Одинаковые маски объединяются и увеличивают счетчик.
+// Если та же маска уже записана за другим символом, возвращает ошибку.
+func (s *GlyphSet) Add(char string, mask GlyphMask) error {
+	s.index()
+	for _, g := range s.bySize[[2]int{mask.Width, mask.Height}] {
+		if g.Bits == mask.Bits && g.Dy == mask.Dy {
+			if g.Char != char {
+				return fmt.Errorf("маска уже записана как %q, а не %q", g.Char, char)
+			}
+			g.Count++
+			return nil
+		}
+	}
+	s.Glyphs = append(s.Glyphs, Glyph{Char: char, Width: mask.Width, Height: mask.Height, Dy: mask.Dy, Bits: mask.Bits, Count: 1})
+	s.bySize = nil
+	return nil
+}
+
+// index строит индекс шаблонов по размеру
+func (s *GlyphSet) index() {
+	if s.bySize != nil {
+		return
+	}
+	s.bySize = make(map[[2]int][]*Glyph)
+	for i := range s.Glyphs {
+		g := &s.Glyphs[i]
+		key := [2]int{g.Width, g.Height}
+		s.bySize[key] = append(s.bySize[key], g)
+	}
+}
+
+// Match возвращает символ, наиболее похожий на маску, и долю совпавших пикселей.
+// Сравниваются только шаблоны того же размера; "?" - подходящего шаблона нет.
+func (s *GlyphSet) Match(mask GlyphMask) (string, float64) {
+	s.index()
+	best, bestScore := "?", 0.0
+	for _, g := range s.bySize[[2]int{mask.Width, mask.Height}] {
+		if abs(g.Dy-mask.Dy) > 1 {
+			continue
+		}
+		same := 0
+		for i := 0; i < len(g.Bits) && i < len(mask.Bits); i++ {
+			if g.Bits[i] == mask.Bits[i] {
+				same++
+			}
+		}
+		score := float64(same) / float64(len(mask.Bits))
+		if score > bestScore {
+			best, bestScore = g.Char, score
+		}
+	}
+	// Отличие больше чем в 10% пикселей считаем другим символом
+	if bestScore < 0.9 {
+		return "?", bestScore
+	}
+	return best, bestScore
+}
+
+// GlyphMask - маска одного символа, вырезанного из строки
+type GlyphMask struct {
+	Width  int
+	Height int
+	Dy     int
+	Bits   string
+	X      int // левый край символа в строке
+}
+
+// TextLine - строка текста, найденная на изображении
+type TextLine struct {
+	Top, Bottom int         // границы строки включительно
+	Glyphs      []GlyphMask // символы слева направо
+	Gaps        []int       // ширина промежутка перед каждым символом
+}
+
+// inkMask возвращает маску светлых пикселей изображения
+func inkMask(img image.Image, threshold int) [][]bool {
+	bounds := img.Bounds()
+	mask := make([][]bool, bounds.Dy())
+	for y := 0; y < bounds.Dy(); y++ {
+		mask[y] = make([]bool, bounds.Dx())
+		for x := 0; x < bounds.Dx(); x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			r8, g8, b8 := int(r>>8), int(g>>8), int(b>>8)
+			mask[y][x] = r8 >= threshold || g8 >= threshold || b8 >= threshold
+		}
+	}
+	return mask
+}
+
+// SegmentLines делит изображение на строки текста и символы.
+// Строки ищутся по горизонтальной проекции светлых пикселей, символы - по пустым столбцам внутри строки.
+func SegmentLines(img image.Image, threshold int) []TextLine {
+	mask := inkMask(img, threshold)
+	height := len(mask)
+	if height == 0 {
+		return nil
+	}
+	width := len(mask[0])
+
+	var lines []TextLine
+	inLine := false
+	top := 0
+	for y := 0; y <= height; y++ {
+		active := false
+		if y < height {
+			for x := 0; x < width; x++ {
+				if mask[y][x] {
+					active = true
+					break
+				}
+			}
+		}
+		if active && !inLine {
+			inLine, top = true, y
+		} else if !active && inLine {
+			inLine = false
+			lines = append(lines, segmentGlyphs(mask, top, y-1))
+		}
+	}
+	return lines
+}
+
+// segmentGlyphs вырезает символы строки top..bottom
+func segmentGlyphs(mask [][]bool, top, bottom int) TextLine {
+	line := TextLine{Top: top, Bottom: bottom}
+	width := len(mask[0])
+
+	columnActive := func(x int) bool {
+		for y := top; y <= bottom; y++ {
+			if mask[y][x] {
+				return true
+			}
+		}
+		return false
+	}
+
+	type run struct{ left, right, gap int }
+	var runs []run
+	lastRight := -1
+	for x := 0; x < width; {
+		if !columnActive(x) {
+			x++
+			continue
+		}
+		left := x
+		for x < width && columnActive(x) {
+			x++
+		}
+		gap := 0
+		if lastRight >= 0 {
+			gap = left - lastRight - 1
+		}
+		runs = append(runs, run{left: left, right: x - 1, gap: gap})
+		lastRight = x - 1
+	}
+
+	// Базовая линия - самый частый нижний край символов
+	bottoms := make(map[int]int)
+	type box struct{ top, bottom int }
+	boxes := make([]box, len(runs))
+	for i, r := range runs {
+		b := box{top: bottom, bottom: top}
+		for y := top; y <= bottom; y++ {
+			for x := r.left; x <= r.right; x++ {
+				if mask[y][x] {
+					if y < b.top {
+						b.top = y
+					}
+					if y > b.bottom {
+						b.bottom = y
+					}
+				}
+			}
+		}
+		boxes[i] = b
+		bottoms[b.bottom]++
+	}
+	baseline, best := bottom, 0
+	for y, n := range bottoms {
+		if n > best || (n == best && y > baseline) {
+			baseline, best = y, n
+		}
+	}
+
+	for i, r := range runs {
+		b := boxes[i]
+		var bits strings.Builder
+		for y := b.top; y <= b.bottom; y++ {
+			for x := r.left; x <= r.right; x++ {
+				if mask[y][x] {
+					bits.WriteByte('#')
+				} else {
+					bits.WriteByte('.')
+				}
+			}
+		}
+		line.Glyphs = append(line.Glyphs, GlyphMask{
+			Width:  r.right - r.left + 1,
+			Height: b.bottom - b.top + 1,
+			Dy:     b.bottom - baseline,
+			Bits:   bits.String(),
+			X:      r.left,
+		})
+		line.Gaps = append(line.Gaps, r.gap)
+	}
+	return line
+}
+
+// RecognizeLine распознает строку. Промежутки шире SpaceWidth становятся пробелами.
+// Возвращает текст и минимальную долю совпадения среди символов строки.
+func (s *GlyphSet) RecognizeLine(line TextLine) (string, float64) {
+	var text strings.Builder
+	confidence := 1.0
+	for i, glyph := range line.Glyphs {
+		if i > 0 && line.Gaps[i] >= s.SpaceWidth {
+			text.WriteByte(' ')
+		}
+		char, score := s.Match(glyph)
+		text.WriteString(char)
+		if score < confidence {
+			confidence = score
+		}
+	}
+	return text.String(), confidence
+}
+
+// GlyphEngine - движок OCR на шаблонах глифов, без внешних программ
+type GlyphEngine struct {
+	set *GlyphSet
+}
+
+// NewGlyphEngine создает движок по набору глифов из файла path
+func NewGlyphEngine(path string) (*GlyphEngine, error) {
+	if path == "" {
+		return nil, fmt.Errorf("для движка glyph не задан ocr.glyph_set")
+	}
+	set, err := LoadGlyphSet(path)
+	if err != nil {
+		return nil, err
+	}
+	return &GlyphEngine{set: set}, nil
+}
+
+func (e *GlyphEngine) Name() string {
+	return EngineGlyph
+}
+
+func (e *GlyphEngine) Recognize(imagePath string) (*Result, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия изображения %s: %v", imagePath, err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка декодирования изображения %s: %v", imagePath, err)
+	}
+	return e.RecognizeImage(img, imagePath)
+}
+
+// RecognizeImage распознает уже загруженное изображение
+func (e *GlyphEngine) RecognizeImage(img image.Image, imagePath string) (*Result, error) {
+	var lines []string
+	confidence := 1.0
+	for _, line := range SegmentLines(img, e.set.Threshold) {
+		text, score := e.set.RecognizeLine(line)
+		lines = append(lines, text)
+		if score < confidence {
+			confidence = score
+		}
+	}
+
+	var parsed model.OCRResult
+	parsed.ImageFile = imagePath
+	parsed.Processing.OCREngine = EngineGlyph
+	parsed.TextRecognition.Success = true
+	parsed.TextRecognition.RawText = strings.Join(lines, "\n")
+	parsed.TextRecognition.Confidence = fmt.Sprintf("%.2f", confidence)
+	return resultFromParsed(&parsed, fmt.Sprintf("glyph: строк %d, шаблонов %d", len(lines), len(e.set.Glyphs)))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,87 @@
+package ocr
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Normalizer заменяет значения полей распознанных предложений по словарю замен.
+// Словарь собирается из повторяющихся исправлений веб-интерфейса (corrections.Substitutions)
+// и может обновляться между запусками скриптов.
+type Normalizer struct {
+	mu            sync.RWMutex
+	substitutions map[string]map[string]string // поле -> распознанное значение -> исправленное
+}
+
+// NewNormalizer создает нормализатор со словарем substitutions
+func NewNormalizer(substitutions map[string]map[string]string) *Normalizer {
+	n := &Normalizer{}
+	n.SetSubstitutions(substitutions)
+	return n
+}
+
+// SetSubstitutions заменяет словарь замен
+func (n *Normalizer) SetSubstitutions(substitutions map[string]map[string]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.substitutions = substitutions
+}
+
+// Len возвращает число замен в словаре
+func (n *Normalizer) Len() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	total := 0
+	for _, values := range n.substitutions {
+		total += len(values)
+	}
+	return total
+}
+
+// Apply заменяет значения полей предложений результата. Замены попадают в замечания разбора,
+// JSON результата перестраивается, чтобы в базу попали исправленные значения. Возвращает число замен.
+func (n *Normalizer) Apply(result *Result) int {
+	if result == nil || result.Parsed == nil {
+		return 0
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if len(n.substitutions) == 0 {
+		return 0
+	}
+
+	replaced := 0
+	items := result.Parsed.TextRecognition.StructuredData
+	for i := range items {
+		for field, value := range map[string]*string{
+			"title":       &items[i].Title,
+			"title_short": &items[i].TitleShort,
+			"owner":       &items[i].Owner,
+		} {
+			to, ok := n.substitutions[field][strings.TrimSpace(*value)]
+			if !ok {
+				continue
+			}
+			if result.Parse != nil {
+				result.Parse.warn(i+1, field, "%q заменено на %q по словарю исправлений", *value, to)
+			}
+			*value = to
+			replaced++
+		}
+	}
+	if replaced == 0 {
+		return 0
+	}
+
+	if data, err := json.Marshal(result.Parsed); err == nil {
+		result.JSON = string(data)
+		if result.Parse != nil {
+			result.Parse.JSON = result.JSON
+		}
+	}
+	if result.Parse != nil {
+		result.Parse.finish()
+	}
+	return replaced
+}
@@ -0,0 +1,217 @@
+package ocr
+
+import (
+	"encoding/json"
+	"fmt"
+	"shnyr/internal/model"
+	"shnyr/internal/price"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion - версия схемы JSON результата OCR (поле schema_version).
+// Вывод без schema_version считается версией 1: так печатает cpp_ocr.
+// Версия 2 добавляет предложениям confidence, field_confidence, row_top и row_bottom.
+const SchemaVersion = 2
+
+// Статусы разбора результата OCR, сохраняются в ocr_results.parse_status
+const (
+	ParseOK       = "ok"       // JSON разобран, все поля прошли проверку
+	ParseWarnings = "warnings" // JSON разобран с исправлениями или замечаниями
+	ParseErrors   = "errors"   // JSON разобран, но поля части предложений не прошли проверку
+	ParseInvalid  = "invalid"  // JSON не найден или не разбирается
+)
+
+const (
+	jsonStartMarker = "=== JSON START ==="
+	jsonEndMarker   = "=== JSON END ==="
+)
+
+// confidenceFields - поля предложения, для которых движок может передать уверенность
+var confidenceFields = map[string]bool{"title": true, "price": true, "count": true, "owner": true}
+
+// ParseIssue - замечание или ошибка разбора
+type ParseIssue struct {
+	Item    int    `json:"item,omitempty"`  // номер предложения в structured_data, начиная с 1; 0 - результат целиком
+	Field   string `json:"field,omitempty"` // поле предложения
+	Message string `json:"message"`
+}
+
+func (i ParseIssue) String() string {
+	switch {
+	case i.Item > 0 && i.Field != "":
+		return fmt.Sprintf("предложение %d, %s: %s", i.Item, i.Field, i.Message)
+	case i.Field != "":
+		return fmt.Sprintf("%s: %s", i.Field, i.Message)
+	}
+	return i.Message
+}
+
+// ParseResult - результат разбора вывода движка OCR
+type ParseResult struct {
+	Status   string
+	Version  int              // версия схемы разобранного JSON
+	Debug    string           // отладочная информация движка (всё до JSON)
+	JSON     string           // найденный JSON; сохраняется, даже если он не разбирается
+	RawText  string           // text_recognition.raw_text
+	Result   *model.OCRResult // nil при статусе invalid
+	Warnings []ParseIssue
+	Errors   []ParseIssue
+}
+
+func (r *ParseResult) warn(item int, field string, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, ParseIssue{Item: item, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ParseResult) fail(item int, field string, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, ParseIssue{Item: item, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// finish выставляет статус по найденным замечаниям и ошибкам
+func (r *ParseResult) finish() *ParseResult {
+	switch {
+	case r.Result == nil:
+		r.Status = ParseInvalid
+	case len(r.Errors) > 0:
+		r.Status = ParseErrors
+	case len(r.Warnings) > 0:
+		r.Status = ParseWarnings
+	default:
+		r.Status = ParseOK
+	}
+	return r
+}
+
+// IssuesJSON возвращает замечания и ошибки в виде JSON для ocr_results.parse_issues; пустая строка - их нет
+func (r *ParseResult) IssuesJSON() string {
+	if len(r.Warnings) == 0 && len(r.Errors) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(struct {
+		Warnings []ParseIssue `json:"warnings,omitempty"`
+		Errors   []ParseIssue `json:"errors,omitempty"`
+	}{r.Warnings, r.Errors})
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// ParseOutput разбирает вывод движка, печатающего отладку и JSON между маркерами
+// === JSON START === и === JSON END ===. Разбор нестрогий: исправимые отступления от формата
+// (JSON без маркеров, неизвестные поля, пропущенные запятые) исправляются, но не замалчиваются,
+// а попадают в Warnings; неисправимые - в Errors результата.
+func ParseOutput(output string) *ParseResult {
+	r := &ParseResult{}
+
+	startIndex := strings.Index(output, jsonStartMarker)
+	endIndex := strings.Index(output, jsonEndMarker)
+	if startIndex != -1 && endIndex > startIndex {
+		r.Debug = strings.TrimSpace(output[:startIndex])
+		r.JSON = strings.TrimSpace(output[startIndex+len(jsonStartMarker) : endIndex])
+	} else {
+		// Без маркеров JSON ищется между первой { и последней }
+		jsonStart := strings.Index(output, "{")
+		jsonEnd := strings.LastIndex(output, "}")
+		if jsonStart == -1 || jsonEnd <= jsonStart {
+			r.Debug = output
+			r.fail(0, "", "JSON не найден в выводе движка")
+			return r.finish()
+		}
+		r.Debug = strings.TrimSpace(output[:jsonStart])
+		r.JSON = strings.TrimSpace(output[jsonStart : jsonEnd+1])
+		r.warn(0, "", "JSON найден без маркеров %s / %s", jsonStartMarker, jsonEndMarker)
+	}
+
+	r.decode()
+	return r.finish()
+}
+
+// ValidateResult проверяет результат движка, который сам собирает model.OCRResult
+func ValidateResult(parsed *model.OCRResult) *ParseResult {
+	r := &ParseResult{Result: parsed, RawText: parsed.TextRecognition.RawText}
+	if data, err := json.Marshal(parsed); err == nil {
+		r.JSON = string(data)
+	}
+	r.validate()
+	return r.finish()
+}
+
+// decode разбирает r.JSON. Неизвестные поля и пропущенные между предложениями запятые
+// исправимы и дают замечание; прочие ошибки JSON делают результат invalid.
+func (r *ParseResult) decode() {
+	var parsed model.OCRResult
+	decoder := json.NewDecoder(strings.NewReader(r.JSON))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&parsed)
+	if err != nil && strings.Contains(err.Error(), "unknown field") {
+		r.warn(0, "", "неизвестное поле: %v", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		parsed = model.OCRResult{}
+		err = json.Unmarshal([]byte(r.JSON), &parsed)
+	}
+	if err != nil {
+		fixed := fixMalformedJSON(r.JSON)
+		if fixed != r.JSON {
+			parsed = model.OCRResult{}
+			if fixErr := json.Unmarshal([]byte(fixed), &parsed); fixErr == nil {
+				r.warn(0, "", "восстановлены пропущенные запятые между предложениями")
+				r.JSON = fixed
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		r.fail(0, "", "некорректный JSON: %v", err)
+		return
+	}
+
+	r.Result = &parsed
+	r.RawText = parsed.TextRecognition.RawText
+	r.validate()
+}
+
+// validate проверяет версию схемы и поля каждого предложения
+func (r *ParseResult) validate() {
+	parsed := r.Result
+	r.Version = parsed.SchemaVersion
+	if r.Version == 0 {
+		r.Version = 1
+	}
+	if r.Version > SchemaVersion {
+		r.fail(0, "schema_version", "версия схемы %d не поддерживается (поддерживается до %d)", r.Version, SchemaVersion)
+	}
+	if !parsed.TextRecognition.Success {
+		r.warn(0, "success", "движок сообщил о неудачном распознавании")
+	}
+
+	for i, item := range parsed.TextRecognition.StructuredData {
+		n := i + 1
+		if strings.TrimSpace(item.Title) == "" {
+			r.fail(n, "title", "пустое название")
+		}
+		// Цена проверяется тем же разбором, что заполняет structured_items.price_value
+		if item.Price == "" {
+			r.fail(n, "price", "пустая цена")
+		} else if value, err := price.Parse(item.Price); err != nil {
+			r.fail(n, "price", "%v", err)
+		} else if strconv.FormatInt(value, 10) != strings.ReplaceAll(item.Price, ",", "") {
+			r.warn(n, "price", "цена %q разобрана как %d", item.Price, value)
+		}
+		if _, err := model.ParseEnhancement(item.Enhancement); err != nil {
+			r.fail(n, "enhancement", "%v", err)
+		}
+		if _, err := model.ParseCount(item.Count); err != nil {
+			r.fail(n, "count", "%v", err)
+		}
+		if item.Confidence < 0 || item.Confidence > 1 {
+			r.warn(n, "confidence", "уверенность %v вне диапазона 0..1", item.Confidence)
+		}
+		for field, confidence := range item.FieldConfidence {
+			if !confidenceFields[field] {
+				r.warn(n, "field_confidence", "неизвестное поле %q", field)
+			} else if confidence < 0 || confidence > 1 {
+				r.warn(n, "field_confidence", "уверенность поля %s %v вне диапазона 0..1", field, confidence)
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package ocr
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"regexp"
+	imageInternal "shnyr/internal/image"
+	"shnyr/internal/model"
+	"strings"
+)
+
+// ImageRecognizer - движок, распознающий изображение без записи во временный файл
+type ImageRecognizer interface {
+	RecognizeImage(img image.Image, imagePath string) (*Result, error)
+}
+
+// enhancementPattern выделяет улучшение "+N" в начале названия
+var enhancementPattern = regexp.MustCompile(`^\+(\d{1,2})\s+(.+)$`)
+
+// ProcessOffers распознает изображение таблицы предложений. При включенном ocr.rows.enabled
+// каждая строка и колонка распознаются отдельно, иначе изображение распознается целиком движком.
+// Значения полей исправляются по словарю замен нормализатора, если он задан.
+// С кэшем повторная страница с теми же пикселями не распознается, а берется из кэша.
+func (m *OCRManager) ProcessOffers(img image.Image, fileName string) (*Result, error) {
+	var key string
+	if m.cache != nil && img != nil {
+		key = m.cache.Key(img)
+		result, err := m.cache.Get(key)
+		if err != nil {
+			m.logError(err, "Ошибка кэша OCR")
+		}
+		if result != nil {
+			if m.normalizer != nil {
+				m.normalizer.Apply(result)
+			}
+			return result, nil
+		}
+	}
+
+	var result *Result
+	var err error
+	if !m.config.OCR.Rows.Enabled {
+		result, err = m.engine.Recognize(fileName)
+	} else {
+		result, err = m.RecognizeOffers(img, fileName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// В кэш попадает вывод движка до замен: словарь может измениться до следующего попадания
+	if key != "" {
+		if err := m.cache.Put(key, result); err != nil {
+			m.logError(err, "Ошибка записи кэша OCR")
+		}
+	}
+	if m.normalizer != nil {
+		m.normalizer.Apply(result)
+	}
+	return result, nil
+}
+
+// RecognizeOffers делит таблицу предложений на строки и распознает колонки каждой строки отдельно,
+// поэтому ошибка распознавания в одной строке не сдвигает поля других строк
+func (m *OCRManager) RecognizeOffers(img image.Image, imagePath string) (*Result, error) {
+	if img == nil {
+		return nil, fmt.Errorf("построчному распознаванию не передано изображение %s", imagePath)
+	}
+	rows := imageInternal.SegmentOfferRows(img, m.config.OCR.Rows)
+
+	var parsed model.OCRResult
+	parsed.ImageFile = imagePath
+	parsed.Processing.OCREngine = m.engine.Name()
+	parsed.Processing.OCRMode = "rows"
+	parsed.TextRecognition.Success = true
+
+	var lines []string
+	var failed int
+	for i, row := range rows {
+		fields := make(map[string]string)
+		confidence := make(map[string]float64)
+		for _, field := range []struct {
+			name string
+			rect image.Rectangle
+		}{
+			{"name", row.Name},
+			{"price", row.Price},
+			{"count", row.Count},
+			{"owner", row.Owner},
+		} {
+			if field.rect.Empty() {
+				continue
+			}
+			text, score, err := m.recognizeRegion(img, field.rect, fmt.Sprintf("%s_row%d_%s", imagePath, i+1, field.name))
+			if err != nil {
+				failed++
+				continue
+			}
+			fields[field.name] = text
+			if score >= 0 {
+				confidence[field.name] = score
+			}
+		}
+
+		item := model.OCRItem{
+			Title:     fields["name"],
+			Price:     normalizeDigits(fields["price"]),
+			Count:     normalizeDigits(fields["count"]),
+			Owner:     fields["owner"],
+			RowTop:    row.Bounds.Min.Y - img.Bounds().Min.Y,
+			RowBottom: row.Bounds.Max.Y - img.Bounds().Min.Y,
+		}
+		// Уверенность предложения - худшая из уверенностей его полей
+		if len(confidence) > 0 {
+			item.FieldConfidence = make(map[string]float64, len(confidence))
+			item.Confidence = 1
+			for name, score := range confidence {
+				if name == "name" {
+					name = "title"
+				}
+				item.FieldConfidence[name] = score
+				item.Confidence = min(item.Confidence, score)
+			}
+		}
+		if match := enhancementPattern.FindStringSubmatch(item.Title); match != nil {
+			item.Enhancement = match[1]
+			item.Title = match[2]
+		}
+		if item.Title == "" && item.Price == "" {
+			continue
+		}
+		parsed.TextRecognition.StructuredData = append(parsed.TextRecognition.StructuredData, item)
+		lines = append(lines, strings.Join([]string{fields["name"], fields["price"], fields["count"], fields["owner"]}, " | "))
+	}
+	parsed.TextRecognition.RawText = strings.Join(lines, "\n")
+
+	result, err := resultFromParsed(&parsed, fmt.Sprintf("rows: строк %d, предложений %d, ошибок распознавания полей %d", len(rows), len(parsed.TextRecognition.StructuredData), failed))
+	if err != nil {
+		return nil, err
+	}
+	result.FieldErrors = failed
+	return result, nil
+}
+
+// recognizeRegion распознает область rect изображения img одной строкой текста.
+// Возвращает текст и уверенность движка; -1 - движок не сообщает уверенность.
+func (m *OCRManager) recognizeRegion(img image.Image, rect image.Rectangle, name string) (string, float64, error) {
+	var region image.Image
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		region = sub.SubImage(rect)
+	} else {
+		// Изображение без SubImage копируем в RGBA с теми же координатами области
+		rgba := image.NewRGBA(rect)
+		draw.Draw(rgba, rect, img, rect.Min, draw.Src)
+		region = rgba
+	}
+
+	var result *Result
+	var err error
+	if recognizer, ok := m.engine.(ImageRecognizer); ok {
+		result, err = recognizer.RecognizeImage(region, name)
+	} else {
+		// Внешним движкам область передается через временный файл
+		file, createErr := os.CreateTemp("", "offer_field_*.png")
+		if createErr != nil {
+			return "", 0, fmt.Errorf("ошибка создания временного файла: %v", createErr)
+		}
+		defer os.Remove(file.Name())
+		encodeErr := png.Encode(file, region)
+		file.Close()
+		if encodeErr != nil {
+			return "", 0, fmt.Errorf("ошибка сохранения области: %v", encodeErr)
+		}
+		result, err = m.engine.Recognize(file.Name())
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	score := -1.0
+	if result.Parsed != nil {
+		if value, ok := model.ParseConfidence(result.Parsed.TextRecognition.Confidence); ok {
+			score = value
+		}
+	}
+	return strings.Join(strings.Fields(result.RawText), " "), score, nil
+}
+
+// normalizeDigits оставляет в числовом поле только цифры и разделители разрядов
+func normalizeDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if (r >= '0' && r <= '9') || r == ',' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,326 @@
+package ocr_eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"shnyr/internal/matcher"
+	"shnyr/internal/model"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fields - поля предложения, по которым считается точность
+var Fields = []string{"title", "title_short", "enhancement", "price", "count", "owner", "package"}
+
+// minRowSimilarity - минимальное сходство строк предложений, при котором распознанное предложение
+// сопоставляется с ожидаемым; менее похожие считаются пропущенным и лишним предложениями
+const minRowSimilarity = 0.5
+
+// Case - размеченное изображение корпуса: изображение и ожидаемые предложения
+type Case struct {
+	Name     string
+	Image    string
+	Expected []model.OCRItem
+}
+
+// LoadCorpus читает размеченные изображения каталога dir: для каждого *.png рядом лежит *.json
+// с ожидаемыми structured_data - массивом предложений, объектом {"structured_data": [...]}
+// или полным выводом движка с text_recognition.structured_data
+func LoadCorpus(dir string) ([]Case, []string, error) {
+	images, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения каталога %s: %v", dir, err)
+	}
+	sort.Strings(images)
+
+	var cases []Case
+	var skipped []string
+	for _, image := range images {
+		labelFile := strings.TrimSuffix(image, filepath.Ext(image)) + ".json"
+		data, err := os.ReadFile(labelFile)
+		if os.IsNotExist(err) {
+			skipped = append(skipped, fmt.Sprintf("%s: нет разметки %s", filepath.Base(image), filepath.Base(labelFile)))
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка чтения %s: %v", labelFile, err)
+		}
+		expected, err := ParseExpected(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка разбора %s: %v", labelFile, err)
+		}
+		cases = append(cases, Case{
+			Name:     strings.TrimSuffix(filepath.Base(image), filepath.Ext(image)),
+			Image:    image,
+			Expected: expected,
+		})
+	}
+	return cases, skipped, nil
+}
+
+// ParseExpected разбирает разметку изображения в одном из форматов LoadCorpus
+func ParseExpected(data []byte) ([]model.OCRItem, error) {
+	var items []model.OCRItem
+	if err := json.Unmarshal(data, &items); err == nil {
+		return items, nil
+	}
+
+	var labelled struct {
+		StructuredData  []model.OCRItem `json:"structured_data"`
+		TextRecognition struct {
+			StructuredData []model.OCRItem `json:"structured_data"`
+		} `json:"text_recognition"`
+	}
+	if err := json.Unmarshal(data, &labelled); err != nil {
+		return nil, err
+	}
+	if labelled.StructuredData != nil {
+		return labelled.StructuredData, nil
+	}
+	return labelled.TextRecognition.StructuredData, nil
+}
+
+// FieldValue возвращает значение поля field предложения в виде строки для сравнения
+func FieldValue(item model.OCRItem, field string) string {
+	switch field {
+	case "title":
+		return strings.TrimSpace(item.Title)
+	case "title_short":
+		return strings.TrimSpace(item.TitleShort)
+	case "enhancement":
+		return strings.TrimPrefix(strings.TrimSpace(item.Enhancement), "+")
+	case "price":
+		return strings.TrimSpace(item.Price)
+	case "count":
+		return strings.TrimSpace(item.Count)
+	case "owner":
+		return strings.TrimSpace(item.Owner)
+	case "package":
+		// Пакет без отметки не считается значением: точность считается по отмеченным пакетам
+		if item.Package {
+			return strconv.FormatBool(item.Package)
+		}
+	}
+	return ""
+}
+
+// FieldStats - счетчики одного поля. Предсказанное значение - непустое значение распознанного предложения,
+// верное - совпавшее с ожидаемым значением сопоставленного предложения.
+type FieldStats struct {
+	Correct   int `json:"correct"`
+	Predicted int `json:"predicted"`
+	Expected  int `json:"expected"`
+	Errors    int `json:"char_errors"` // сумма расстояний Левенштейна до ожидаемых значений
+	Chars     int `json:"chars"`       // длина ожидаемых значений
+}
+
+func (s *FieldStats) add(other FieldStats) {
+	s.Correct += other.Correct
+	s.Predicted += other.Predicted
+	s.Expected += other.Expected
+	s.Errors += other.Errors
+	s.Chars += other.Chars
+}
+
+// Precision - доля верных среди предсказанных значений; 1, если ничего не предсказано
+func (s FieldStats) Precision() float64 {
+	if s.Predicted == 0 {
+		return 1
+	}
+	return float64(s.Correct) / float64(s.Predicted)
+}
+
+// Recall - доля найденных верно среди ожидаемых значений; 1, если ничего не ожидалось
+func (s FieldStats) Recall() float64 {
+	if s.Expected == 0 {
+		return 1
+	}
+	return float64(s.Correct) / float64(s.Expected)
+}
+
+// CER - доля ошибочных символов (character error rate) относительно длины ожидаемых значений
+func (s FieldStats) CER() float64 {
+	if s.Chars == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Chars)
+}
+
+// MarshalJSON добавляет к счетчикам вычисленные метрики
+func (s FieldStats) MarshalJSON() ([]byte, error) {
+	type counters FieldStats
+	return json.Marshal(struct {
+		counters
+		Precision float64 `json:"precision"`
+		Recall    float64 `json:"recall"`
+		CER       float64 `json:"cer"`
+	}{counters(s), s.Precision(), s.Recall(), s.CER()})
+}
+
+// FieldDiff - расхождение значения поля сопоставленных предложений
+type FieldDiff struct {
+	Row      int    `json:"row"` // номер ожидаемого предложения, начиная с 1
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// ImageReport - результат сравнения одного изображения
+type ImageReport struct {
+	Name        string                `json:"name"`
+	Error       string                `json:"error,omitempty"` // ошибка распознавания; предложения считаются пропущенными
+	ParseStatus string                `json:"parse_status,omitempty"`
+	Expected    int                   `json:"expected_rows"`
+	Actual      int                   `json:"actual_rows"`
+	Missed      []int                 `json:"missed_rows,omitempty"` // номера ожидаемых предложений без пары
+	Extra       []int                 `json:"extra_rows,omitempty"`  // номера распознанных предложений без пары
+	Diffs       []FieldDiff           `json:"diffs,omitempty"`
+	Fields      map[string]FieldStats `json:"fields"`
+}
+
+// Compare сопоставляет распознанные предложения actual с ожидаемыми expected с сохранением порядка строк
+// и считает счетчики полей. Предложение без пары дает пропущенные или лишние значения всех его полей.
+func Compare(name string, expected, actual []model.OCRItem) ImageReport {
+	report := ImageReport{
+		Name:     name,
+		Expected: len(expected),
+		Actual:   len(actual),
+		Fields:   make(map[string]FieldStats, len(Fields)),
+	}
+
+	pairs := align(expected, actual)
+	matchedActual := make(map[int]bool)
+	for i := range expected {
+		j, ok := pairs[i]
+		if !ok {
+			report.Missed = append(report.Missed, i+1)
+		} else {
+			matchedActual[j] = true
+		}
+
+		for _, field := range Fields {
+			stats := report.Fields[field]
+			want := FieldValue(expected[i], field)
+			got := ""
+			if ok {
+				got = FieldValue(actual[j], field)
+			}
+			if want != "" {
+				stats.Expected++
+				stats.Chars += len([]rune(want))
+			}
+			if got != "" {
+				stats.Predicted++
+			}
+			if want != "" && got == want {
+				stats.Correct++
+			}
+			stats.Errors += matcher.Distance([]rune(want), []rune(got))
+			if ok && got != want {
+				report.Diffs = append(report.Diffs, FieldDiff{Row: i + 1, Field: field, Expected: want, Actual: got})
+			}
+			report.Fields[field] = stats
+		}
+	}
+
+	for j := range actual {
+		if matchedActual[j] {
+			continue
+		}
+		report.Extra = append(report.Extra, j+1)
+		for _, field := range Fields {
+			if got := FieldValue(actual[j], field); got != "" {
+				stats := report.Fields[field]
+				stats.Predicted++
+				stats.Errors += len([]rune(got))
+				report.Fields[field] = stats
+			}
+		}
+	}
+	return report
+}
+
+// Missing возвращает отчет изображения, которое не удалось распознать: все ожидаемые предложения пропущены
+func Missing(name string, expected []model.OCRItem, err error) ImageReport {
+	report := Compare(name, expected, nil)
+	report.Error = err.Error()
+	return report
+}
+
+// rowKey - строка предложения для сопоставления: название, цена и владелец
+func rowKey(item model.OCRItem) string {
+	return matcher.Normalize(item.Title + " " + item.Price + " " + item.Owner)
+}
+
+// align сопоставляет предложения с сохранением порядка (как выравнивание последовательностей),
+// максимизируя суммарное сходство строк. Возвращает номер распознанного предложения для ожидаемого.
+func align(expected, actual []model.OCRItem) map[int]int {
+	n, m := len(expected), len(actual)
+	similarity := make([][]float64, n)
+	for i := range expected {
+		similarity[i] = make([]float64, m)
+		for j := range actual {
+			similarity[i][j] = matcher.Similarity(rowKey(expected[i]), rowKey(actual[j]))
+		}
+	}
+
+	// best[i][j] - лучшая сумма сходства для expected[i:] и actual[j:]
+	best := make([][]float64, n+1)
+	for i := range best {
+		best[i] = make([]float64, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			best[i][j] = max(best[i+1][j], best[i][j+1])
+			if similarity[i][j] >= minRowSimilarity {
+				best[i][j] = max(best[i][j], similarity[i][j]+best[i+1][j+1])
+			}
+		}
+	}
+
+	pairs := make(map[int]int)
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case similarity[i][j] >= minRowSimilarity && best[i][j] == similarity[i][j]+best[i+1][j+1]:
+			pairs[i] = j
+			i++
+			j++
+		case best[i][j] == best[i+1][j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// EngineReport - результат прогона корпуса одним движком
+type EngineReport struct {
+	Engine   string                `json:"engine"`
+	Images   []ImageReport         `json:"images"`
+	Fields   map[string]FieldStats `json:"fields"`
+	Missed   int                   `json:"missed_rows"`
+	Extra    int                   `json:"extra_rows"`
+	Failures int                   `json:"failures"` // изображения, которые движок не распознал
+}
+
+// NewEngineReport собирает итог движка engine по отчетам изображений
+func NewEngineReport(engine string, images []ImageReport) EngineReport {
+	report := EngineReport{Engine: engine, Images: images, Fields: make(map[string]FieldStats, len(Fields))}
+	for _, image := range images {
+		for field, stats := range image.Fields {
+			total := report.Fields[field]
+			total.add(stats)
+			report.Fields[field] = total
+		}
+		report.Missed += len(image.Missed)
+		report.Extra += len(image.Extra)
+		if image.Error != "" {
+			report.Failures++
+		}
+	}
+	return report
+}
@@ -0,0 +1,233 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"shnyr/internal/config"
+	"shnyr/internal/database"
+	"shnyr/internal/logger"
+	"shnyr/internal/model"
+	"shnyr/internal/ocr"
+	"sync"
+)
+
+// Page - снятая страница предложений, ожидающая распознавания и сохранения
+type Page struct {
+	Image    image.Image
+	Path     string // путь к сохраненному изображению страницы
+	Item     string // предмет, который искал бот; пустая строка для cycle_all_items
+	Category model.Category
+	batch    *Batch
+}
+
+// Batch - группа страниц одного предмета. Позволяет дождаться их сохранения, не останавливая навигацию.
+type Batch struct {
+	wg  sync.WaitGroup
+	mu  sync.Mutex
+	ids []int
+	err error
+}
+
+// Wait ждет сохранения всех страниц группы и возвращает ID записей ocr_results и первую ошибку
+func (b *Batch) Wait() ([]int, error) {
+	b.wg.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ids, b.err
+}
+
+func (b *Batch) done(id int, err error) {
+	b.mu.Lock()
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	if err == nil && id > 0 {
+		b.ids = append(b.ids, id)
+	}
+	b.mu.Unlock()
+	b.wg.Done()
+}
+
+// recognized - страница после распознавания
+type recognized struct {
+	page   Page
+	result *ocr.Result
+	err    error
+}
+
+// Pipeline - конвейер захват → OCR → сохранение. Скрипт отправляет страницы и сразу продолжает навигацию,
+// пул воркеров распознает их, а отдельный этап сохраняет результаты в базу.
+// Очереди ограничены: если OCR не успевает, Submit блокируется, пока не освободится место.
+type Pipeline struct {
+	c          *config.Config
+	ocr        *ocr.OCRManager
+	db         *database.DatabaseManager
+	logger     *logger.LoggerManager
+	pages      chan Page
+	recognized chan recognized
+	workers    sync.WaitGroup
+	persisted  chan struct{}
+	tasks      sync.WaitGroup
+	closeOnce  sync.Once
+}
+
+// New создает и запускает конвейер. Число воркеров OCR и размер очередей берутся из секции pipeline конфига.
+func New(c *config.Config, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, loggerManager *logger.LoggerManager) *Pipeline {
+	workers := c.Pipeline.Workers
+	if workers <= 0 {
+		workers = 2
+	}
+	queueSize := c.Pipeline.QueueSize
+	if queueSize <= 0 {
+		queueSize = 4
+	}
+
+	p := &Pipeline{
+		c:          c,
+		ocr:        ocrManager,
+		db:         dbManager,
+		logger:     loggerManager,
+		pages:      make(chan Page, queueSize),
+		recognized: make(chan recognized, queueSize),
+		persisted:  make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go p.recognize()
+	}
+	go p.persist()
+	return p
+}
+
+// NewBatch создает группу для страниц одного предмета
+func (p *Pipeline) NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Submit отправляет страницу на распознавание. batch может быть nil.
+// Блокируется, если очередь распознавания заполнена.
+func (p *Pipeline) Submit(page Page, batch *Batch) {
+	if batch != nil {
+		batch.wg.Add(1)
+	}
+	page.batch = batch
+	p.pages <- page
+}
+
+// Go выполняет fn в фоне; Close дожидается ее завершения
+func (p *Pipeline) Go(fn func()) {
+	p.tasks.Add(1)
+	go func() {
+		defer p.tasks.Done()
+		fn()
+	}()
+}
+
+// Close дожидается распознавания и сохранения всех отправленных страниц и фоновых задач
+func (p *Pipeline) Close() {
+	p.closeOnce.Do(func() {
+		close(p.pages)
+		p.workers.Wait()
+		close(p.recognized)
+		<-p.persisted
+		p.tasks.Wait()
+		p.logCacheStats()
+	})
+}
+
+// logCacheStats пишет в лог долю попаданий кэша OCR с запуска бота и записывает накопленные попадания в хранилище
+func (p *Pipeline) logCacheStats() {
+	cache := p.ocr.Cache()
+	if cache == nil {
+		return
+	}
+	if err := cache.Flush(); err != nil {
+		p.logger.LogError(err, "Ошибка кэша OCR")
+	}
+	hits, misses := cache.Stats()
+	if total := hits + misses; total > 0 {
+		p.logger.Info("♻️ Кэш OCR: попаданий %d из %d (%.0f%%)", hits, total, float64(hits)*100/float64(total))
+	}
+}
+
+// recognize - воркер OCR
+func (p *Pipeline) recognize() {
+	defer p.workers.Done()
+	for page := range p.pages {
+		r := recognized{page: page}
+		ocrPath, cleanup, err := p.ocrPath(page)
+		if err == nil {
+			r.result, err = p.ocr.ProcessOffers(page.Image, ocrPath)
+			cleanup()
+		}
+		if err != nil {
+			p.logger.LogError(err, "Ошибка при проведении OCR")
+		}
+		if err == nil && r.result.Cached {
+			p.logger.Info("♻️ OCR из кэша: %s", page.Path)
+		}
+		r.err = err
+		p.recognized <- r
+	}
+}
+
+// ocrPath возвращает файл страницы для OCR. Без save_all_screenshots все страницы пишутся в один файл,
+// который перезаписывается следующим захватом, поэтому воркер распознает свою копию.
+func (p *Pipeline) ocrPath(page Page) (string, func(), error) {
+	if p.c.SaveAllScreenshots == 1 {
+		return page.Path, func() {}, nil
+	}
+	file, err := os.CreateTemp("", "offers_page_*.png")
+	if err != nil {
+		return "", nil, fmt.Errorf("ошибка создания временного файла: %v", err)
+	}
+	err = png.Encode(file, page.Image)
+	file.Close()
+	if err != nil {
+		os.Remove(file.Name())
+		return "", nil, fmt.Errorf("ошибка сохранения страницы: %v", err)
+	}
+	return file.Name(), func() { os.Remove(file.Name()) }, nil
+}
+
+// persist - этап сохранения результатов в базу
+func (p *Pipeline) persist() {
+	defer close(p.persisted)
+	for r := range p.recognized {
+		id, err := 0, r.err
+		if err == nil {
+			id, err = p.save(r)
+		}
+		if r.page.batch != nil {
+			r.page.batch.done(id, err)
+		}
+	}
+}
+
+// save сохраняет распознанную страницу в ocr_results и structured_items
+func (p *Pipeline) save(r recognized) (int, error) {
+	var imgBytes bytes.Buffer
+	if err := png.Encode(&imgBytes, r.page.Image); err != nil {
+		return 0, fmt.Errorf("ошибка кодирования изображения: %v", err)
+	}
+
+	var parse database.ParseReport
+	if r.result.Parse != nil {
+		parse = database.ParseReport{Status: r.result.Parse.Status, Issues: r.result.Parse.IssuesJSON()}
+		if parse.Status != ocr.ParseOK {
+			p.logger.Info("⚠️ Разбор OCR: %s, замечаний %d, ошибок %d", parse.Status, len(r.result.Parse.Warnings), len(r.result.Parse.Errors))
+		}
+	}
+
+	p.logger.Info("💾 Сохраняем OCR результат для предмета '%s' с категорией '%s'", r.page.Item, r.page.Category)
+	id, err := p.db.SaveOCRResultToDB(r.page.Path, r.result.Output, r.result.Debug, r.result.JSON, r.result.RawText, imgBytes.Bytes(), p.c, r.page.Category, r.page.Item, parse, r.result.Cached)
+	if err != nil {
+		p.logger.LogError(err, "Ошибка при сохранении результата в базу")
+		return 0, err
+	}
+	p.logger.Info("🔍 OCR результат сохранен с ID: %d", id)
+	return id, nil
+}
@@ -0,0 +1,146 @@
+package price
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// ErrorKind - причина, по которой цену не удалось разобрать
+type ErrorKind string
+
+const (
+	ErrEmpty    ErrorKind = "empty"    // пустая строка или только разделители
+	ErrInvalid  ErrorKind = "invalid"  // символы, которые не являются цифрами даже после исправления OCR
+	ErrSuffix   ErrorKind = "suffix"   // дробная часть цены с суффиксом не дает целого числа адены
+	ErrOverflow ErrorKind = "overflow" // значение не помещается в int64
+	ErrNegative ErrorKind = "negative" // отрицательная цена
+)
+
+// Error - ошибка разбора цены
+type Error struct {
+	Input string
+	Kind  ErrorKind
+}
+
+func (e *Error) Error() string {
+	switch e.Kind {
+	case ErrEmpty:
+		return fmt.Sprintf("пустая цена %q", e.Input)
+	case ErrSuffix:
+		return fmt.Sprintf("неверный суффикс или дробная часть в цене %q", e.Input)
+	case ErrOverflow:
+		return fmt.Sprintf("цена %q слишком велика", e.Input)
+	case ErrNegative:
+		return fmt.Sprintf("отрицательная цена %q", e.Input)
+	}
+	return fmt.Sprintf("цена %q содержит недопустимые символы", e.Input)
+}
+
+// ocrDigits - символы, которые OCR путает с цифрами
+var ocrDigits = map[rune]rune{
+	'O': '0', 'o': '0', 'Q': '0', 'D': '0',
+	'l': '1', 'I': '1', 'i': '1', '|': '1', '!': '1',
+	'S': '5', 's': '5',
+	'B': '8',
+	'Z': '2', 'z': '2',
+}
+
+// multipliers - суффиксы цены: k - тысяча, kk и m - миллион, kkk - миллиард.
+// Суффикса b нет: OCR путает B с 8.
+var multipliers = map[string]int64{
+	"k":   1_000,
+	"kk":  1_000_000,
+	"m":   1_000_000,
+	"kkk": 1_000_000_000,
+}
+
+// Parse переводит цену из structured_items.price в число адены.
+// Пробелы, запятые, точки и апострофы считаются разделителями разрядов; символы, которые OCR путает
+// с цифрами (O/0, l/1, S/5 и т.п.), исправляются. Цена с суффиксом может быть дробной: 1.5kk = 1500000.
+func Parse(s string) (int64, error) {
+	input := s
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "-") {
+		return 0, &Error{Input: input, Kind: ErrNegative}
+	}
+
+	// Суффикс отделяем до исправления символов, иначе "kk" не отличить от цифр
+	lower := strings.ToLower(s)
+	multiplier := int64(1)
+	for _, suffix := range []string{"kkk", "kk", "k", "m"} {
+		if strings.HasSuffix(lower, suffix) {
+			multiplier = multipliers[suffix]
+			s = strings.TrimSpace(s[:len(s)-len(suffix)])
+			break
+		}
+	}
+
+	var intPart, fracPart strings.Builder
+	fraction := false
+	for _, r := range s {
+		if d, ok := ocrDigits[r]; ok {
+			r = d
+		}
+		switch {
+		case r >= '0' && r <= '9':
+			if fraction {
+				fracPart.WriteRune(r)
+			} else {
+				intPart.WriteRune(r)
+			}
+		case r == ',' || r == '.' || r == '\'' || unicode.IsSpace(r):
+			if multiplier > 1 && (r == ',' || r == '.') {
+				// С суффиксом разделитель отделяет дробную часть: 1.5k, 2,25kk
+				if fraction {
+					return 0, &Error{Input: input, Kind: ErrSuffix}
+				}
+				fraction = true
+			}
+		default:
+			return 0, &Error{Input: input, Kind: ErrInvalid}
+		}
+	}
+
+	if intPart.Len() == 0 && fracPart.Len() == 0 {
+		return 0, &Error{Input: input, Kind: ErrEmpty}
+	}
+
+	value, ok := digitsValue(intPart.String())
+	if !ok || value > math.MaxInt64/multiplier {
+		return 0, &Error{Input: input, Kind: ErrOverflow}
+	}
+	value *= multiplier
+
+	// Дробная часть с суффиксом: 1.5k -> 1000 + 5*1000/10
+	frac := fracPart.String()
+	if frac != "" {
+		scale := int64(1)
+		for range frac {
+			if scale > multiplier {
+				return 0, &Error{Input: input, Kind: ErrSuffix}
+			}
+			scale *= 10
+		}
+		fracValue, _ := digitsValue(frac)
+		if fracValue*multiplier%scale != 0 {
+			return 0, &Error{Input: input, Kind: ErrSuffix}
+		}
+		value += fracValue * multiplier / scale
+	}
+	return value, nil
+}
+
+// digitsValue переводит строку цифр в число; false - переполнение
+func digitsValue(digits string) (int64, bool) {
+	var value int64
+	for _, r := range digits {
+		d := int64(r - '0')
+		if value > (math.MaxInt64-d)/10 {
+			return 0, false
+		}
+		value = value*10 + d
+	}
+	return value, true
+}
@@ -0,0 +1,142 @@
+package prioritizer
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DefaultScanDuration - оценка длительности сканирования предмета без истории
+const DefaultScanDuration = 30 * time.Second
+
+// Weights - веса составляющих оценки предмета
+type Weights struct {
+	Variance  float64 // разброс лучших цен за последние сканирования
+	Staleness float64 // время с последнего сканирования
+	Proximity float64 // близость лучшего предложения к min_price
+}
+
+// DefaultWeights используются, если веса не заданы в конфиге
+var DefaultWeights = Weights{Variance: 1, Staleness: 1, Proximity: 1}
+
+// Item - предмет и его история сканирований, новые сканирования первыми
+type Item struct {
+	Name      string
+	MinPrice  float64
+	Prices    []float64       // лучшие цены последних сканирований
+	Scanned   bool            // сканировался ли предмет за время хранения истории
+	LastScan  time.Duration   // сколько прошло с последнего сканирования
+	Durations []time.Duration // длительности последних сканирований
+}
+
+// Scored - предмет с оценкой и ожидаемой длительностью сканирования
+type Scored struct {
+	Item
+	Score     float64
+	Variance  float64
+	Stale     float64
+	Proximity float64
+	Estimate  time.Duration
+}
+
+// Prioritizer оценивает предметы и составляет план сканирования на цикл
+type Prioritizer struct {
+	weights Weights
+	horizon time.Duration // за это время предмет становится полностью "устаревшим"
+	budget  time.Duration // бюджет времени на цикл; 0 - без ограничения
+}
+
+// NewPrioritizer создает приоритизатор. horizon - время, после которого предмет считается полностью устаревшим,
+// budget - бюджет времени на цикл (0 - сканировать все предметы)
+func NewPrioritizer(weights Weights, horizon time.Duration, budget time.Duration) *Prioritizer {
+	if horizon <= 0 {
+		horizon = time.Hour
+	}
+	return &Prioritizer{
+		weights: weights,
+		horizon: horizon,
+		budget:  budget,
+	}
+}
+
+// Score оценивает предмет. Каждая составляющая нормирована в [0, 1].
+func (p *Prioritizer) Score(item Item) Scored {
+	scored := Scored{Item: item, Estimate: estimate(item.Durations)}
+
+	// Разброс - коэффициент вариации лучших цен
+	if len(item.Prices) >= 2 {
+		mean, stddev := meanStddev(item.Prices)
+		if mean > 0 {
+			scored.Variance = math.Min(1, stddev/mean)
+		}
+	}
+
+	// Устаревание - доля горизонта, прошедшая с последнего сканирования
+	if !item.Scanned {
+		scored.Stale = 1
+	} else {
+		scored.Stale = math.Min(1, float64(item.LastScan)/float64(p.horizon))
+	}
+
+	// Близость последнего лучшего предложения к min_price
+	if item.MinPrice > 0 && len(item.Prices) > 0 && item.Prices[0] > 0 {
+		distance := math.Abs(item.Prices[0]-item.MinPrice) / item.MinPrice
+		scored.Proximity = math.Max(0, 1-distance)
+	}
+
+	scored.Score = p.weights.Variance*scored.Variance + p.weights.Staleness*scored.Stale + p.weights.Proximity*scored.Proximity
+	return scored
+}
+
+// Plan возвращает предметы для цикла в порядке убывания оценки.
+// При заданном бюджете в план попадают предметы, пока их ожидаемая длительность укладывается в бюджет;
+// остальные пропускают цикл и копят устаревание, поэтому стабильные предметы сканируются реже.
+// Первый предмет попадает в план всегда.
+func (p *Prioritizer) Plan(items []Item) []Scored {
+	scored := make([]Scored, 0, len(items))
+	for _, item := range items {
+		scored = append(scored, p.Score(item))
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+
+	if p.budget <= 0 {
+		return scored
+	}
+	var plan []Scored
+	var total time.Duration
+	for _, item := range scored {
+		if len(plan) > 0 && total+item.Estimate > p.budget {
+			continue
+		}
+		total += item.Estimate
+		plan = append(plan, item)
+	}
+	return plan
+}
+
+// estimate возвращает среднюю длительность сканирования или DefaultScanDuration без истории
+func estimate(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return DefaultScanDuration
+	}
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	return total / time.Duration(len(durations))
+}
+
+func meanStddev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
@@ -0,0 +1,139 @@
+package scheduler
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"shnyr/internal/config"
+)
+
+// Rule - правило расписания: сканировать категории Categories каждые Every,
+// при заданном окне - только внутри него
+type Rule struct {
+	Name       string
+	Categories []string
+	Every      time.Duration
+	hasWindow  bool
+	from, to   int // границы окна в минутах от начала суток
+}
+
+// ParseRule разбирает правило. between - необязательное окно "ЧЧ:ММ-ЧЧ:ММ", может переходить через полночь.
+func ParseRule(name string, categories []string, every string, between string) (Rule, error) {
+	rule := Rule{Name: name, Categories: categories}
+	if name == "" {
+		return rule, fmt.Errorf("у правила расписания не указано имя")
+	}
+	if len(categories) == 0 {
+		return rule, fmt.Errorf("правило %s: не указаны категории", name)
+	}
+
+	duration, err := time.ParseDuration(every)
+	if err != nil {
+		return rule, fmt.Errorf("правило %s: неверный интервал %q: %v", name, every, err)
+	}
+	if duration < time.Minute {
+		return rule, fmt.Errorf("правило %s: интервал меньше минуты", name)
+	}
+	rule.Every = duration
+
+	between = strings.TrimSpace(between)
+	if between == "" {
+		return rule, nil
+	}
+	parts := strings.Split(between, "-")
+	if len(parts) != 2 {
+		return rule, fmt.Errorf("правило %s: неверное окно %q, ожидается ЧЧ:ММ-ЧЧ:ММ", name, between)
+	}
+	rule.from, err = parseClock(parts[0])
+	if err != nil {
+		return rule, fmt.Errorf("правило %s: %v", name, err)
+	}
+	rule.to, err = parseClock(parts[1])
+	if err != nil {
+		return rule, fmt.Errorf("правило %s: %v", name, err)
+	}
+	if rule.from == rule.to {
+		return rule, fmt.Errorf("правило %s: пустое окно %q", name, between)
+	}
+	rule.hasWindow = true
+	return rule, nil
+}
+
+// parseClock разбирает время суток "ЧЧ:ММ" в минуты от начала суток
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("неверное время %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inWindow проверяет, попадает ли момент t в окно правила
+func (r Rule) inWindow(t time.Time) bool {
+	if !r.hasWindow {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if r.from < r.to {
+		return minute >= r.from && minute < r.to
+	}
+	// Окно через полночь, например 10:00-02:00
+	return minute >= r.from || minute < r.to
+}
+
+// Next возвращает ближайший момент не раньше t, когда правило может сработать
+func (r Rule) Next(t time.Time) time.Time {
+	if r.inWindow(t) {
+		return t
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day(), r.from/60, r.from%60, 0, 0, t.Location())
+	if start.Before(t) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start
+}
+
+// RulesFromConfig разбирает правила из секции schedule файла config.yaml
+func RulesFromConfig(rules []config.ScheduleRule) ([]Rule, error) {
+	var result []Rule
+	for _, rc := range rules {
+		rule, err := ParseRule(rc.Name, rc.Categories, rc.Every, rc.Between)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+// RulesFromDB загружает включенные правила из таблицы schedule_rules
+func RulesFromDB(db *sql.DB) ([]Rule, error) {
+	rows, err := db.Query("SELECT name, categories, every, between_hours FROM schedule_rules WHERE enabled = TRUE ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения правил расписания: %v", err)
+	}
+	defer rows.Close()
+
+	var result []Rule
+	for rows.Next() {
+		var name, categories, every string
+		var between sql.NullString
+		if err := rows.Scan(&name, &categories, &every, &between); err != nil {
+			return nil, fmt.Errorf("ошибка чтения правила расписания: %v", err)
+		}
+		var list []string
+		for _, category := range strings.Split(categories, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				list = append(list, category)
+			}
+		}
+		rule, err := ParseRule(name, list, every, between.String)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rule)
+	}
+	return result, rows.Err()
+}
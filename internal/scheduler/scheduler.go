@@ -0,0 +1,232 @@
+package scheduler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"shnyr/internal/logger"
+)
+
+// RunStatus - состояние запланированного запуска
+type RunStatus string
+
+const (
+	RunScheduled   RunStatus = "scheduled"
+	RunRunning     RunStatus = "running"
+	RunSucceeded   RunStatus = "succeeded"
+	RunInterrupted RunStatus = "interrupted"
+	RunFailed      RunStatus = "failed"
+	RunCancelled   RunStatus = "cancelled"
+)
+
+// Run представляет одну запись таблицы schedule_runs
+type Run struct {
+	ID          int64
+	Rule        string
+	Categories  string
+	Status      RunStatus
+	ScheduledAt time.Time
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+	Error       string
+}
+
+// ErrBusy возвращает RunFunc, если бот уже занят другим скриптом и запуск не начался
+var ErrBusy = errors.New("скрипт уже выполняется")
+
+// RunFunc выполняет сканирование категорий. Возвращает true, если запуск был прерван,
+// и ошибку скрипта - тогда запуск записывается как failed.
+type RunFunc func(categories []string, reason string) (bool, error)
+
+// Upcoming возвращает ближайшие запланированные запуски
+func Upcoming(db *sql.DB, limit int) ([]Run, error) {
+	return queryRuns(db, "WHERE status = 'scheduled' ORDER BY scheduled_at LIMIT ?", limit)
+}
+
+// Recent возвращает последние выполненные или выполняющиеся запуски
+func Recent(db *sql.DB, limit int) ([]Run, error) {
+	return queryRuns(db, "WHERE status <> 'scheduled' ORDER BY scheduled_at DESC, id DESC LIMIT ?", limit)
+}
+
+func queryRuns(db *sql.DB, where string, args ...interface{}) ([]Run, error) {
+	rows, err := db.Query("SELECT id, rule_name, categories, status, scheduled_at, started_at, finished_at, error FROM schedule_runs "+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения запусков расписания: %v", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var run Run
+		var status string
+		var startedAt, finishedAt sql.NullTime
+		var errText sql.NullString
+		err := rows.Scan(&run.ID, &run.Rule, &run.Categories, &status, &run.ScheduledAt, &startedAt, &finishedAt, &errText)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения запуска расписания: %v", err)
+		}
+		run.Status = RunStatus(status)
+		if startedAt.Valid {
+			run.StartedAt = &startedAt.Time
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		run.Error = errText.String
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// Scheduler ставит сканирования по правилам в очередь schedule_runs и выполняет их,
+// когда не выполняется другой скрипт
+type Scheduler struct {
+	db     *sql.DB
+	logger *logger.LoggerManager
+	rules  map[string]Rule
+	run    RunFunc
+	busy   func() bool
+}
+
+// NewScheduler создает планировщик. busy сообщает, занят ли бот другим скриптом.
+func NewScheduler(db *sql.DB, loggerManager *logger.LoggerManager, rules []Rule, run RunFunc, busy func() bool) *Scheduler {
+	byName := make(map[string]Rule)
+	for _, rule := range rules {
+		byName[rule.Name] = rule
+	}
+	return &Scheduler{
+		db:     db,
+		logger: loggerManager,
+		rules:  byName,
+		run:    run,
+		busy:   busy,
+	}
+}
+
+// Start подготавливает очередь запусков и запускает планировщик в отдельной горутине
+func (s *Scheduler) Start() error {
+	err := s.prepare(time.Now())
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			time.Sleep(30 * time.Second)
+			s.tick(time.Now())
+		}
+	}()
+	return nil
+}
+
+// prepare закрывает запуски, оборванные прошлым завершением бота, отменяет запуски удаленных правил
+// и планирует первый запуск для правил без запланированного запуска
+func (s *Scheduler) prepare(now time.Time) error {
+	_, err := s.db.Exec("UPDATE schedule_runs SET status = 'failed', error = 'бот завершился во время выполнения', finished_at = ? WHERE status = 'running'", now)
+	if err != nil {
+		return fmt.Errorf("ошибка закрытия оборванных запусков: %v", err)
+	}
+
+	scheduled, err := Upcoming(s.db, 1000)
+	if err != nil {
+		return err
+	}
+	planned := make(map[string]bool)
+	for _, run := range scheduled {
+		if _, ok := s.rules[run.Rule]; !ok {
+			_, err := s.db.Exec("UPDATE schedule_runs SET status = 'cancelled', error = 'правило удалено', finished_at = ? WHERE id = ?", now, run.ID)
+			if err != nil {
+				return fmt.Errorf("ошибка отмены запуска %d: %v", run.ID, err)
+			}
+			continue
+		}
+		planned[run.Rule] = true
+	}
+
+	for name, rule := range s.rules {
+		if planned[name] {
+			continue
+		}
+		if err := s.schedule(rule, rule.Next(now)); err != nil {
+			return err
+		}
+	}
+	s.logger.Info("🗓️ Планировщик: правил %d", len(s.rules))
+	return nil
+}
+
+// schedule добавляет запланированный запуск правила на момент at
+func (s *Scheduler) schedule(rule Rule, at time.Time) error {
+	_, err := s.db.Exec("INSERT INTO schedule_runs (rule_name, categories, scheduled_at) VALUES (?, ?, ?)",
+		rule.Name, strings.Join(rule.Categories, ","), at)
+	if err != nil {
+		return fmt.Errorf("ошибка планирования запуска %s: %v", rule.Name, err)
+	}
+	s.logger.Info("🗓️ %s запланирован на %s", rule.Name, at.Format("02.01.2006 15:04"))
+	return nil
+}
+
+// tick выполняет самый ранний наступивший запуск. Если бот занят, запуск остается в очереди до следующей проверки.
+// busy проверяется заранее только чтобы не трогать очередь; скрипт мог занять бота после проверки,
+// поэтому ErrBusy от run тоже возвращает запуск в очередь, а не записывает его неудачным.
+func (s *Scheduler) tick(now time.Time) {
+	if s.busy() {
+		return
+	}
+
+	var run Run
+	err := s.db.QueryRow("SELECT id, rule_name, scheduled_at FROM schedule_runs WHERE status = 'scheduled' AND scheduled_at <= ? ORDER BY scheduled_at LIMIT 1", now).
+		Scan(&run.ID, &run.Rule, &run.ScheduledAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.logger.LogError(err, "Ошибка получения запланированного запуска")
+		}
+		return
+	}
+	rule, ok := s.rules[run.Rule]
+	if !ok {
+		return
+	}
+
+	_, err = s.db.Exec("UPDATE schedule_runs SET status = 'running', started_at = ? WHERE id = ?", now, run.ID)
+	if err != nil {
+		s.logger.LogError(err, "Ошибка обновления запланированного запуска")
+		return
+	}
+
+	s.logger.Info("🗓️ Запуск по расписанию: %s (%s)", rule.Name, strings.Join(rule.Categories, ", "))
+	interrupted, runErr := s.run(rule.Categories, "Запуск по расписанию: "+rule.Name)
+	if errors.Is(runErr, ErrBusy) {
+		s.logger.Info("🗓️ %s отложен: бот занят другим скриптом", rule.Name)
+		_, err = s.db.Exec("UPDATE schedule_runs SET status = 'scheduled', started_at = NULL WHERE id = ?", run.ID)
+		if err != nil {
+			s.logger.LogError(err, "Ошибка возврата запуска в очередь")
+		}
+		return
+	}
+
+	status := RunSucceeded
+	var errText interface{}
+	switch {
+	case runErr != nil:
+		status, errText = RunFailed, runErr.Error()
+	case interrupted:
+		status = RunInterrupted
+	}
+	finished := time.Now()
+	_, err = s.db.Exec("UPDATE schedule_runs SET status = ?, error = ?, finished_at = ? WHERE id = ?", string(status), errText, finished, run.ID)
+	if err != nil {
+		s.logger.LogError(err, "Ошибка записи результата запуска по расписанию")
+	}
+
+	// Следующий запуск отсчитывается от запланированного времени; пропущенные за время выполнения слоты не догоняем
+	next := run.ScheduledAt.Local().Add(rule.Every)
+	for next.Before(finished) {
+		next = next.Add(rule.Every)
+	}
+	if err := s.schedule(rule, rule.Next(next)); err != nil {
+		s.logger.LogError(err, "Ошибка планирования следующего запуска")
+	}
+}
@@ -170,6 +170,12 @@ func NewScreenshotManager(marginX, marginY int) *ScreenshotManager {
 	}
 }
 
+// SetMargins обновляет отступы окна брокера (например, после повторного поиска окна)
+func (h *ScreenshotManager) SetMargins(marginX, marginY int) {
+	h.marginX = marginX
+	h.marginY = marginY
+}
+
 // checkImageQuality проверяет качество изображения по количеству пикселей с низкими значениями каналов
 func (h *ScreenshotManager) checkImageQuality(img image.Image) bool {
 	bounds := img.Bounds()
@@ -1,16 +1,16 @@
 package cycle_all_items
 
 import (
-	"bytes"
 	"fmt"
 	"image"
-	"image/png"
 	"shnyr/internal/click_manager"
 	"shnyr/internal/config"
 	"shnyr/internal/database"
 	"shnyr/internal/interrupt"
 	"shnyr/internal/logger"
+	"shnyr/internal/model"
 	"shnyr/internal/ocr"
+	"shnyr/internal/pipeline"
 	"shnyr/internal/screenshot"
 )
 
@@ -68,8 +68,8 @@ var processItemPage = func(c *config.Config,
 	return croppedFinalImg, savedImagePath, nil
 }
 
-// processButtonPage обрабатывает страницу с кнопкой (обработка изображения, OCR, сохранение в БД)
-func processItemPageWithButtonLogic(c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, loggerManager *logger.LoggerManager, currentItem string, itemCategory string) error {
+// processButtonPage снимает страницу с кнопкой и отправляет ее в конвейер на OCR и сохранение в БД
+func processItemPageWithButtonLogic(s *scan, c *config.Config, screenshotManager *screenshot.ScreenshotManager, loggerManager *logger.LoggerManager, currentItem string, itemCategory model.Category) error {
 	// получаем статус страницы
 	pageStatus := screenshotManager.GetPageStatus(c)
 
@@ -80,28 +80,14 @@ func processItemPageWithButtonLogic(c *config.Config, screenshotManager *screens
 		return err
 	}
 
-	// проводим OCR картинки
-	result, debugInfo, jsonData, rawText, err := ocrManager.ProcessImage(savedImgPath)
-	if err != nil {
-		loggerManager.LogError(err, "Ошибка при проведении OCR")
-		return err
-	}
-
-	// сохраняем результат в базу
-	var imgBytes bytes.Buffer
-	png.Encode(&imgBytes, croppedFinalImg)
-	num, err := dbManager.SaveOCRResultToDB(savedImgPath, result, debugInfo, jsonData, rawText, imgBytes.Bytes(), c, itemCategory, currentItem)
-	if err != nil {
-		loggerManager.LogError(err, "Ошибка при сохранении результата в базу")
-		return err
-	}
-	loggerManager.Info("🔍 OCR результат сохранен с ID: %d", num)
+	// OCR и сохранение выполняются конвейером, пока бот листает следующие страницы
+	s.pages.Submit(pipeline.Page{Image: croppedFinalImg, Path: savedImgPath, Item: currentItem, Category: itemCategory}, nil)
 
 	return nil
 }
 
 // processItem обрабатывает отдельный предмет со всеми его кнопками
-func processItemListPage(c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager, isFirstCycle bool) error {
+func processItemListPage(s *scan, c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager, isFirstCycle bool) error {
 	itemCoordinates, err := screenshotManager.GetItemListItemsCoordinates()
 	if err != nil {
 		loggerManager.LogError(err, "Ошибка при поиске координат первой страницы")
@@ -132,6 +118,11 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 	for i := startIndex; i < len(itemCoordinates); i++ {
 		coordinate := itemCoordinates[i]
 
+		// Безопасная точка: при запрошенной паузе ждем возобновления
+		if interruptManager.WaitIfPaused() {
+			return fmt.Errorf("прерывание по запросу пользователя")
+		}
+
 		// Проверяем сигнал прерывания в начале обработки каждого предмета
 		select {
 		case <-interruptManager.GetScriptInterruptChan():
@@ -149,7 +140,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 		pageStatus := screenshotManager.GetPageStatus(c)
 
 		// обрабатываем первую страницу предмета
-		err := processItemPageWithButtonLogic(c, screenshotManager, ocrManager, dbManager, loggerManager, "", "")
+		err := processItemPageWithButtonLogic(s, c, screenshotManager, loggerManager, "", "")
 		if err != nil {
 			loggerManager.LogError(err, "Ошибка при обработке первой страницы")
 			return err
@@ -160,7 +151,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 			clickManager.ClickCoordinates(image.Point{X: c.Click.Button2.X, Y: c.Click.Button2.Y})
 
 			// обрабатываем страницу кнопки 2
-			err = processItemPageWithButtonLogic(c, screenshotManager, ocrManager, dbManager, loggerManager, "", "")
+			err = processItemPageWithButtonLogic(s, c, screenshotManager, loggerManager, "", "")
 			if err != nil {
 				loggerManager.LogError(err, "Ошибка при обработке кнопки 2")
 				return err
@@ -174,7 +165,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 			clickManager.ClickCoordinates(image.Point{X: c.Click.Button3.X, Y: c.Click.Button3.Y})
 
 			// обрабатываем страницу кнопки 3
-			err = processItemPageWithButtonLogic(c, screenshotManager, ocrManager, dbManager, loggerManager, "", "")
+			err = processItemPageWithButtonLogic(s, c, screenshotManager, loggerManager, "", "")
 			if err != nil {
 				loggerManager.LogError(err, "Ошибка при обработке кнопки 3")
 				return err
@@ -188,7 +179,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 			clickManager.ClickCoordinates(image.Point{X: c.Click.Button4.X, Y: c.Click.Button4.Y})
 
 			// обрабатываем страницу кнопки 4
-			err = processItemPageWithButtonLogic(c, screenshotManager, ocrManager, dbManager, loggerManager, "", "")
+			err = processItemPageWithButtonLogic(s, c, screenshotManager, loggerManager, "", "")
 			if err != nil {
 				loggerManager.LogError(err, "Ошибка при обработке кнопки 4")
 				return err
@@ -201,7 +192,21 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 	return nil
 }
 
-var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager, dbManager *database.DatabaseManager, ocrManager *ocr.OCRManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager) {
+// scan - состояние одного запуска: pages - конвейер OCR запуска.
+// Создается в Run и передается по цепочке обработки, поэтому запуски не делят состояние.
+type scan struct {
+	pages *pipeline.Pipeline
+}
+
+var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager, dbManager *database.DatabaseManager, ocrManager *ocr.OCRManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager) error {
+	s := &scan{pages: pipeline.New(c, ocrManager, dbManager, loggerManager)}
+	defer func() {
+		// Ожидаем распознавания и сохранения всех снятых страниц, в том числе после прерывания
+		loggerManager.Info("🔄 Ожидаем завершения распознавания и сохранения страниц...")
+		s.pages.Close()
+		loggerManager.Info("✅ Все операции сохранения завершены")
+	}()
+
 	// берем окно L2 в фокус
 	clickManager.FocusL2Window()
 
@@ -209,10 +214,14 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 	for cycles := 0; cycles < c.MaxCyclesItemsList; cycles++ {
 		loggerManager.Info("🔄 Проход %d из %d", cycles+1, c.MaxCyclesItemsList)
 
+		if interruptManager.WaitIfPaused() {
+			return nil
+		}
+
 		select {
 		case <-interruptManager.GetScriptInterruptChan():
 			loggerManager.Info("⏹️ Прерывание script1 по запросу пользователя")
-			return
+			return nil
 		default:
 		}
 
@@ -253,11 +262,11 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 
 		if !hasActiveButtons {
 			loggerManager.Info("🔍 Активных кнопок не найдено, обрабатываем список предметов без кнопок")
-			err := processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, cycles == 0 && buttonIndex == c.StartButtonIndex)
+			err := processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, cycles == 0 && buttonIndex == c.StartButtonIndex)
 			if err != nil {
 				if err.Error() == "прерывание по запросу пользователя" {
 					loggerManager.Info("⏹️ Завершение работы по прерыванию")
-					return
+					return nil
 				}
 				loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 			}
@@ -284,11 +293,11 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 				if buttonIndex == c.StartButtonIndex && cycles == 0 {
 					loggerManager.Info("🔘 Обрабатываем начальную кнопку %d (первый цикл)", buttonIndex)
 					clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-					err := processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, true)
+					err := processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, true)
 					if err != nil {
 						if err.Error() == "прерывание по запросу пользователя" {
 							loggerManager.Info("⏹️ Завершение работы по прерыванию")
-							return
+							return nil
 						}
 						loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 					}
@@ -298,11 +307,11 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 						for screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
 							loggerManager.Info("🔘 Повторно обрабатываем кнопку 6")
 							clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-							err = processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false)
+							err = processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false)
 							if err != nil {
 								if err.Error() == "прерывание по запросу пользователя" {
 									loggerManager.Info("⏹️ Завершение работы по прерыванию")
-									return
+									return nil
 								}
 								loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 							}
@@ -314,11 +323,11 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 					// Кнопка 1 всегда кликается без проверки активности
 					loggerManager.Info("🔘 Обрабатываем кнопку 1 (всегда активна)")
 					clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-					err := processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false)
+					err := processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false)
 					if err != nil {
 						if err.Error() == "прерывание по запросу пользователя" {
 							loggerManager.Info("⏹️ Завершение работы по прерыванию")
-							return
+							return nil
 						}
 						loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 					}
@@ -328,11 +337,11 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 						for screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
 							loggerManager.Info("🔘 Повторно обрабатываем кнопку 6")
 							clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-							err = processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false)
+							err = processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false)
 							if err != nil {
 								if err.Error() == "прерывание по запросу пользователя" {
 									loggerManager.Info("⏹️ Завершение работы по прерыванию")
-									return
+									return nil
 								}
 								loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 							}
@@ -347,11 +356,11 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 					if screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
 						loggerManager.Info("🔘 Обрабатываем кнопку %d", buttonIndex)
 						clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-						err := processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false)
+						err := processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false)
 						if err != nil {
 							if err.Error() == "прерывание по запросу пользователя" {
 								loggerManager.Info("⏹️ Завершение работы по прерыванию")
-								return
+								return nil
 							}
 							loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 						}
@@ -361,11 +370,11 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 							for screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
 								loggerManager.Info("🔘 Повторно обрабатываем кнопку 6")
 								clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-								err = processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false)
+								err = processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false)
 								if err != nil {
 									if err.Error() == "прерывание по запросу пользователя" {
 										loggerManager.Info("⏹️ Завершение работы по прерыванию")
-										return
+										return nil
 									}
 									loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 								}
@@ -390,9 +399,5 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 		// возвращается в список
 		clickManager.ClickCoordinates(image.Point{X: c.Click.Button1.X, Y: c.Click.Button1.Y})
 	}
-
-	// Ожидаем завершения всех асинхронных операций сохранения
-	loggerManager.Info("🔄 Ожидаем завершения асинхронных операций сохранения...")
-	dbManager.WaitForAsyncOperations()
-	loggerManager.Info("✅ Все операции сохранения завершены")
+	return nil
 }
@@ -1,23 +1,60 @@
 package cycle_listed_items
 
 import (
+	"fmt"
 	"image"
 	"shnyr/internal/click_manager"
 	"shnyr/internal/config"
 	"shnyr/internal/database"
 	"shnyr/internal/interrupt"
 	"shnyr/internal/logger"
+	"shnyr/internal/model"
 	"shnyr/internal/ocr"
+	"shnyr/internal/pipeline"
 	"shnyr/internal/screenshot"
 )
 
-var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager, dbManager *database.DatabaseManager, ocrManager *ocr.OCRManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager) {
-	// Инициализируем таблицу предметов
-	err := dbManager.InitializeItemsTable()
+// Categories - категории предметов в порядке обхода: сначала раздел скупки, затем раздел продажи
+var Categories = model.Categories
+
+// scan - состояние одного запуска: pages - конвейер OCR запуска, batch - страницы сканируемого предмета.
+// Создается в RunCategories и ScanItem и передается по цепочке обработки, поэтому запуски не делят состояние.
+type scan struct {
+	pages *pipeline.Pipeline
+	batch *pipeline.Batch
+}
+
+var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager, dbManager *database.DatabaseManager, ocrManager *ocr.OCRManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager) error {
+	return RunCategories(Categories, c.MaxCyclesItemsList, c, screenshotManager, dbManager, ocrManager, clickManager, loggerManager, interruptManager)
+}
+
+// RunCategories выполняет passes проходов только по категориям categories.
+// Возвращает ошибку, если проход не удалось начать; прерывание пользователем ошибкой не считается.
+func RunCategories(categories []model.Category, passes int, c *config.Config, screenshotManager *screenshot.ScreenshotManager, dbManager *database.DatabaseManager, ocrManager *ocr.OCRManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager) error {
+	var buyCategories, sellCategories []model.Category
+	for _, category := range Categories {
+		for _, wanted := range categories {
+			if wanted != category {
+				continue
+			}
+			if category.IsBuy() {
+				buyCategories = append(buyCategories, category)
+			} else {
+				sellCategories = append(sellCategories, category)
+			}
+		}
+	}
+
+	// Синхронизируем items_list с items.txt; id предметов и ссылки на них сохраняются
+	diff, err := dbManager.SyncItemsTable(database.DefaultCatalogFile, false)
 	if err != nil {
-		loggerManager.LogError(err, "Ошибка инициализации таблицы предметов")
-		return
+		return fmt.Errorf("ошибка синхронизации таблицы предметов: %v", err)
 	}
+	loggerManager.Info("📋 Каталог предметов: %s", diff.Summary())
+
+	// Страницы распознаются и сохраняются в фоне; проход завершается, когда сохранены все снятые страницы
+	s := &scan{pages: pipeline.New(c, ocrManager, dbManager, loggerManager)}
+	defer s.pages.Close()
 
 	// берем окно L2 в фокус
 	clickManager.FocusL2Window()
@@ -25,18 +62,24 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 	// Шнырь жмет F12 для открытия окна с предметами
 	clickManager.F12()
 
-	for cycles := 0; cycles < c.MaxCyclesItemsList; cycles++ {
-		interrupted, _, checkErr := checkInterruption(interruptManager, dbManager, loggerManager)
+	for cycles := 0; cycles < passes; cycles++ {
+		interrupted, checkErr := checkInterruption(interruptManager, loggerManager)
 		if checkErr != nil {
 			loggerManager.Info("⏹️ Прерывание по запросу пользователя")
-			return
+			return nil
 		}
 		if interrupted {
 			loggerManager.Info("⏹️ Прерывание по запросу пользователя")
-			return
+			return nil
 		}
 
-		loggerManager.Info("🔄 Проход %d из %d", cycles+1, c.MaxCyclesItemsList)
+		loggerManager.Info("🔄 Проход %d из %d", cycles+1, passes)
+
+		// Порядок и состав предметов на этот проход
+		plan, err := planPass(c, dbManager, loggerManager, categories)
+		if err != nil {
+			return fmt.Errorf("ошибка составления плана прохода: %v", err)
+		}
 
 		// ОБРАБОТКА РАЗДЕЛА СКУПКИ (BUY)
 		loggerManager.Info("💰 Начинаем обработку раздела СКУПКА (BUY)")
@@ -45,61 +88,51 @@ var Run = func(c *config.Config, screenshotManager *screenshot.ScreenshotManager
 		clickManager.ClickCoordinates(image.Point{X: 53, Y: 46})
 		loggerManager.Info("📍 Переходим в раздел скупки (координаты 53, 46)")
 
-		// Обрабатываем все предметы для скупки (buy_consumables и buy_equipment)
-		err = processItemsByCategory(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, "buy_consumables", cycles, c.StartButtonIndex)
-		if err != nil {
-			if err.Error() == "прерывание по запросу пользователя" {
-				loggerManager.Info("⏹️ Завершение работы по прерыванию")
-				return
-			}
-			loggerManager.LogError(err, "Ошибка при обработке предметов buy_consumables")
-		}
-
-		err = processItemsByCategory(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, "buy_equipment", cycles, c.StartButtonIndex)
-		if err != nil {
-			if err.Error() == "прерывание по запросу пользователя" {
-				loggerManager.Info("⏹️ Завершение работы по прерыванию")
-				return
-			}
-			loggerManager.LogError(err, "Ошибка при обработке предметов buy_equipment")
+		// Обрабатываем предметы для скупки (buy_consumables и buy_equipment)
+		if !processCategories(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, buyCategories, plan, cycles) {
+			return nil
 		}
 
-		// ОБРАБОТКА РАЗДЕЛА ПРОДАЖИ (SELL)
-		loggerManager.Info("💸 Начинаем обработку раздела ПРОДАЖА (SELL)")
-
 		// Кликаем на координаты 15, 265 для перехода между разделами
 		clickManager.ClickCoordinates(image.Point{X: 15, Y: 265})
 		loggerManager.Info("📍 Переходим между разделами (координаты 15, 265)")
 
-		// Кликаем на координаты 53, 64 для перехода в раздел sell
-		clickManager.ClickCoordinates(image.Point{X: 53, Y: 64})
-		loggerManager.Info("📍 Переходим в раздел продажи (координаты 53, 64)")
+		if len(sellCategories) > 0 {
+			// ОБРАБОТКА РАЗДЕЛА ПРОДАЖИ (SELL)
+			loggerManager.Info("💸 Начинаем обработку раздела ПРОДАЖА (SELL)")
 
-		// Обрабатываем все предметы для продажи (sell_consumables и sell_equipment)
-		err = processItemsByCategory(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, "sell_consumables", cycles, c.StartButtonIndex)
-		if err != nil {
-			if err.Error() == "прерывание по запросу пользователя" {
-				loggerManager.Info("⏹️ Завершение работы по прерыванию")
-				return
+			// Кликаем на координаты 53, 64 для перехода в раздел sell
+			clickManager.ClickCoordinates(image.Point{X: 53, Y: 64})
+			loggerManager.Info("📍 Переходим в раздел продажи (координаты 53, 64)")
+
+			// Обрабатываем предметы для продажи (sell_consumables и sell_equipment)
+			if !processCategories(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, sellCategories, plan, cycles) {
+				return nil
 			}
-			loggerManager.LogError(err, "Ошибка при обработке предметов sell_consumables")
+
+			// Кликаем на координаты 15, 265 для перехода между разделами
+			clickManager.ClickCoordinates(image.Point{X: 15, Y: 265})
+			loggerManager.Info("📍 Переходим между разделами (координаты 15, 265)")
 		}
 
-		err = processItemsByCategory(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, "sell_equipment", cycles, c.StartButtonIndex)
+		loggerManager.Info("✅ Завершен проход %d", cycles+1)
+	}
+
+	loggerManager.Info("🎉 Все проходы завершены")
+	return nil
+}
+
+// processCategories обрабатывает категории одного раздела. Возвращает false при прерывании.
+func processCategories(s *scan, c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager, categories []model.Category, plan map[model.Category][]string, cycles int) bool {
+	for _, category := range categories {
+		err := processItemsByCategory(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, category, plan[category], cycles, c.StartButtonIndex)
 		if err != nil {
 			if err.Error() == "прерывание по запросу пользователя" {
 				loggerManager.Info("⏹️ Завершение работы по прерыванию")
-				return
+				return false
 			}
-			loggerManager.LogError(err, "Ошибка при обработке предметов sell_equipment")
+			loggerManager.LogError(err, "Ошибка при обработке предметов "+string(category))
 		}
-
-		// Кликаем на координаты 15, 265 для перехода между разделами
-		clickManager.ClickCoordinates(image.Point{X: 15, Y: 265})
-		loggerManager.Info("📍 Переходим между разделами (координаты 15, 265)")
-
-		loggerManager.Info("✅ Завершен проход %d", cycles+1)
 	}
-
-	loggerManager.Info("🎉 Все проходы завершены")
+	return true
 }
@@ -1,13 +1,11 @@
 package cycle_listed_items
 
 import (
-	"bytes"
 	"image"
-	"image/png"
 	"shnyr/internal/config"
-	"shnyr/internal/database"
 	"shnyr/internal/logger"
-	"shnyr/internal/ocr"
+	"shnyr/internal/model"
+	"shnyr/internal/pipeline"
 	"shnyr/internal/screenshot"
 )
 
@@ -67,8 +65,8 @@ var processItemPage = func(c *config.Config,
 	return croppedFinalImg, savedImagePath, nil
 }
 
-// processItemPageWithButtonLogic обрабатывает страницу с кнопкой (обработка изображения, OCR, сохранение в БД)
-func processItemPageWithButtonLogic(c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, loggerManager *logger.LoggerManager, currentItem string, itemCategory string) error {
+// processItemPageWithButtonLogic снимает страницу с кнопкой и отправляет ее в конвейер на OCR и сохранение в БД
+func processItemPageWithButtonLogic(s *scan, c *config.Config, screenshotManager *screenshot.ScreenshotManager, loggerManager *logger.LoggerManager, currentItem string, itemCategory model.Category) error {
 	// получаем статус страницы
 	pageStatus := screenshotManager.GetPageStatus(c)
 
@@ -79,25 +77,8 @@ func processItemPageWithButtonLogic(c *config.Config, screenshotManager *screens
 		return err
 	}
 
-	// проводим OCR картинки
-	result, debugInfo, jsonData, rawText, err := ocrManager.ProcessImage(savedImgPath)
-	if err != nil {
-		loggerManager.LogError(err, "Ошибка при проведении OCR")
-		return err
-	}
-
-	// сохраняем результат в базу
-	var imgBytes bytes.Buffer
-	png.Encode(&imgBytes, croppedFinalImg)
-
-	loggerManager.Info("💾 Сохраняем OCR результат для предмета '%s' с категорией '%s'", currentItem, itemCategory)
-
-	num, err := dbManager.SaveOCRResultToDB(savedImgPath, result, debugInfo, jsonData, rawText, imgBytes.Bytes(), c, itemCategory, currentItem)
-	if err != nil {
-		loggerManager.LogError(err, "Ошибка при сохранении результата в базу")
-		return err
-	}
-	loggerManager.Info("🔍 OCR результат сохранен с ID: %d", num)
+	// OCR и сохранение выполняются конвейером, пока бот листает следующие страницы
+	s.pages.Submit(pipeline.Page{Image: croppedFinalImg, Path: savedImgPath, Item: currentItem, Category: itemCategory}, s.batch)
 
 	return nil
 }
@@ -8,12 +8,13 @@ import (
 	"shnyr/internal/database"
 	"shnyr/internal/interrupt"
 	"shnyr/internal/logger"
+	"shnyr/internal/model"
 	"shnyr/internal/ocr"
 	"shnyr/internal/screenshot"
 )
 
 // processItemListPage обрабатывает отдельный предмет со всеми его кнопками
-func processItemListPage(c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager, isFirstCycle bool, currentItem string, itemCategory string) error {
+func processItemListPage(s *scan, c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager, isFirstCycle bool, currentItem string, itemCategory model.Category) error {
 	loggerManager.Info("🎯 processItemListPage: предмет='%s', категория='%s', первый_цикл=%v", currentItem, itemCategory, isFirstCycle)
 
 	itemCoordinates, err := screenshotManager.GetItemListItemsCoordinates()
@@ -43,10 +44,10 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 	}
 
 	// Определяем тип предмета на основе категории
-	isConsumable := itemCategory == "buy_consumables" || itemCategory == "sell_consumables"
-	isEquipment := itemCategory == "buy_equipment" || itemCategory == "sell_equipment"
-	isBuy := itemCategory == "buy_consumables" || itemCategory == "buy_equipment"
-	isSell := itemCategory == "sell_consumables" || itemCategory == "sell_equipment"
+	isConsumable := itemCategory == model.CategoryBuyConsumables || itemCategory == model.CategorySellConsumables
+	isEquipment := itemCategory == model.CategoryBuyEquipment || itemCategory == model.CategorySellEquipment
+	isBuy := itemCategory == model.CategoryBuyConsumables || itemCategory == model.CategoryBuyEquipment
+	isSell := itemCategory == model.CategorySellConsumables || itemCategory == model.CategorySellEquipment
 
 	if isConsumable {
 		loggerManager.Info("🍶 Предмет '%s' является расходником (%s), пропускаем кнопки страниц", currentItem, itemCategory)
@@ -68,7 +69,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 		coordinate := itemCoordinates[i]
 
 		// Проверяем сигнал прерывания в начале обработки каждого предмета
-		interrupted, _, checkErr := checkInterruption(interruptManager, dbManager, loggerManager)
+		interrupted, checkErr := checkInterruption(interruptManager, loggerManager)
 		if checkErr != nil {
 			loggerManager.Info("⏹️ Прерывание по запросу пользователя")
 			return fmt.Errorf("прерывание по запросу пользователя")
@@ -87,7 +88,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 		pageStatus := screenshotManager.GetPageStatus(c)
 
 		// обрабатываем первую страницу предмета
-		err := processItemPageWithButtonLogic(c, screenshotManager, ocrManager, dbManager, loggerManager, currentItem, itemCategory)
+		err := processItemPageWithButtonLogic(s, c, screenshotManager, loggerManager, currentItem, itemCategory)
 		if err != nil {
 			loggerManager.LogError(err, "Ошибка при обработке первой страницы")
 			return err
@@ -100,7 +101,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 				clickManager.ClickCoordinates(image.Point{X: c.Click.Button2.X, Y: c.Click.Button2.Y})
 
 				// обрабатываем страницу кнопки 2
-				err = processItemPageWithButtonLogic(c, screenshotManager, ocrManager, dbManager, loggerManager, currentItem, itemCategory)
+				err = processItemPageWithButtonLogic(s, c, screenshotManager, loggerManager, currentItem, itemCategory)
 				if err != nil {
 					loggerManager.LogError(err, "Ошибка при обработке кнопки 2")
 					return err
@@ -114,7 +115,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 				clickManager.ClickCoordinates(image.Point{X: c.Click.Button3.X, Y: c.Click.Button3.Y})
 
 				// обрабатываем страницу кнопки 3
-				err = processItemPageWithButtonLogic(c, screenshotManager, ocrManager, dbManager, loggerManager, currentItem, itemCategory)
+				err = processItemPageWithButtonLogic(s, c, screenshotManager, loggerManager, currentItem, itemCategory)
 				if err != nil {
 					loggerManager.LogError(err, "Ошибка при обработке кнопки 3")
 					return err
@@ -128,7 +129,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 				clickManager.ClickCoordinates(image.Point{X: c.Click.Button4.X, Y: c.Click.Button4.Y})
 
 				// обрабатываем страницу кнопки 4
-				err = processItemPageWithButtonLogic(c, screenshotManager, ocrManager, dbManager, loggerManager, currentItem, itemCategory)
+				err = processItemPageWithButtonLogic(s, c, screenshotManager, loggerManager, currentItem, itemCategory)
 				if err != nil {
 					loggerManager.LogError(err, "Ошибка при обработке кнопки 4")
 					return err
@@ -142,7 +143,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 				clickManager.ClickCoordinates(image.Point{X: c.Click.Button5.X, Y: c.Click.Button5.Y})
 
 				// обрабатываем страницу кнопки 5
-				err = processItemPageWithButtonLogic(c, screenshotManager, ocrManager, dbManager, loggerManager, currentItem, itemCategory)
+				err = processItemPageWithButtonLogic(s, c, screenshotManager, loggerManager, currentItem, itemCategory)
 				if err != nil {
 					loggerManager.LogError(err, "Ошибка при обработке кнопки 5")
 					return err
@@ -156,7 +157,7 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 				clickManager.ClickCoordinates(image.Point{X: c.Click.Button6.X, Y: c.Click.Button6.Y})
 
 				// обрабатываем страницу кнопки 6
-				err = processItemPageWithButtonLogic(c, screenshotManager, ocrManager, dbManager, loggerManager, currentItem, itemCategory)
+				err = processItemPageWithButtonLogic(s, c, screenshotManager, loggerManager, currentItem, itemCategory)
 				if err != nil {
 					loggerManager.LogError(err, "Ошибка при обработке кнопки 6")
 					return err
@@ -172,26 +173,17 @@ func processItemListPage(c *config.Config, screenshotManager *screenshot.Screens
 	return nil
 }
 
-// processItemsByCategory обрабатывает предметы определенной категории (buy или sell)
-func processItemsByCategory(c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager, category string, cycles int, startButtonIndex int) error {
-	// Получаем список предметов определенной категории
-	itemList, err := dbManager.GetItemsByCategory(category)
-	if err != nil {
-		loggerManager.LogError(err, fmt.Sprintf("Ошибка получения списка предметов категории %s", category))
-		return err
-	}
-
-	loggerManager.Info("🔍 DEBUG: GetItemsByCategory('%s') вернул %d предметов: %v", category, len(itemList), itemList)
-
+// processItemsByCategory обрабатывает предметы itemList категории category (buy или sell) в заданном порядке
+func processItemsByCategory(s *scan, c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager, category model.Category, itemList []string, cycles int, startButtonIndex int) error {
 	if len(itemList) == 0 {
 		loggerManager.Info("📋 Нет предметов для категории %s", category)
-		return nil
+		return processOnDemand(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, category)
 	}
 
 	loggerManager.Info("📋 Обрабатываем %d предметов категории %s", len(itemList), category)
 
 	for i, item := range itemList {
-		interrupted, _, checkErr := checkInterruption(interruptManager, dbManager, loggerManager)
+		interrupted, checkErr := checkInterruption(interruptManager, loggerManager)
 		if checkErr != nil {
 			loggerManager.Info("⏹️ Прерывание по запросу пользователя")
 			return fmt.Errorf("прерывание по запросу пользователя")
@@ -201,116 +193,170 @@ func processItemsByCategory(c *config.Config, screenshotManager *screenshot.Scre
 			return fmt.Errorf("прерывание по запросу пользователя")
 		}
 
+		// Между предметами сканируем предметы, запрошенные из веб-интерфейса
+		if err := processOnDemand(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, category); err != nil {
+			return err
+		}
+
 		loggerManager.Info("🔍 Обрабатываем предмет %d/%d: %s (категория: %s)", i+1, len(itemList), item, category)
 
-		// Копируем название предмета в буфер обмена
-		clickManager.CopyToClipboard(item)
+		err := processItem(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, category, item, cycles, startButtonIndex)
+		if err != nil {
+			return err
+		}
+	}
+
+	return processOnDemand(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, category)
+}
 
-		// Вставляем название предмета
-		clickManager.Paste()
+// processItem ищет предмет item и обрабатывает все страницы его предложений, затем записывает сканирование в историю
+func processItem(s *scan, c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager, category model.Category, item string, cycles int, startButtonIndex int) error {
+	// Запоминаем начало сканирования для истории, по которой приоритизируются предметы
+	scanStart := dbManager.StartItemScan()
+	s.batch = s.pages.NewBatch()
+	batch := s.batch
 
-		// кликаем на поиск
-		clickManager.ClickCoordinates(image.Point{X: 120, Y: 240})
+	// Копируем название предмета в буфер обмена
+	clickManager.CopyToClipboard(item)
 
-		// обрабатываем все активные кнопки в цикле
-		var buttonIndex int
-		if cycles == 0 {
-			// В первом цикле начинаем с указанной начальной кнопки
-			buttonIndex = startButtonIndex
-		} else {
-			// В последующих циклах начинаем с первой кнопки
-			buttonIndex = 1
+	// Вставляем название предмета
+	clickManager.Paste()
+
+	// кликаем на поиск
+	clickManager.ClickCoordinates(image.Point{X: 120, Y: 240})
+
+	// обрабатываем все активные кнопки в цикле
+	var buttonIndex int
+	if cycles == 0 {
+		// В первом цикле начинаем с указанной начальной кнопки
+		buttonIndex = startButtonIndex
+	} else {
+		// В последующих циклах начинаем с первой кнопки
+		buttonIndex = 1
+	}
+
+	// Проверяем есть ли вообще активные кнопки
+	hasActiveButtons := false
+	for checkButton := 1; checkButton <= 6; checkButton++ {
+		var checkButtonX int
+		switch checkButton {
+		case 1:
+			checkButtonX = c.Click.Button1.X
+		case 2:
+			checkButtonX = c.Click.Button2.X
+		case 3:
+			checkButtonX = c.Click.Button3.X
+		case 4:
+			checkButtonX = c.Click.Button4.X
+		case 5:
+			checkButtonX = c.Click.Button5.X
+		case 6:
+			checkButtonX = c.Click.Button6.X
+		}
+
+		if screenshotManager.CheckButtonActiveByPixel(checkButtonX, 35) {
+			hasActiveButtons = true
+			break
 		}
+	}
 
-		// Проверяем есть ли вообще активные кнопки
-		hasActiveButtons := false
-		for checkButton := 1; checkButton <= 6; checkButton++ {
-			var checkButtonX int
-			switch checkButton {
+	if !hasActiveButtons {
+		loggerManager.Info("🔍 Активных кнопок не найдено, обрабатываем список предметов без кнопок")
+		err := processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, cycles == 0 && buttonIndex == startButtonIndex, item, category)
+		if err != nil {
+			if err.Error() == "прерывание по запросу пользователя" {
+				loggerManager.Info("⏹️ Завершение работы по прерыванию")
+				return err
+			}
+			loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
+		}
+	} else {
+		// Обрабатываем кнопки как обычно
+		for buttonIndex <= 6 {
+			var buttonX, buttonY int
+			switch buttonIndex {
 			case 1:
-				checkButtonX = c.Click.Button1.X
+				buttonX, buttonY = c.Click.Button1.X, c.Click.Button1.Y
 			case 2:
-				checkButtonX = c.Click.Button2.X
+				buttonX, buttonY = c.Click.Button2.X, c.Click.Button2.Y
 			case 3:
-				checkButtonX = c.Click.Button3.X
+				buttonX, buttonY = c.Click.Button3.X, c.Click.Button3.Y
 			case 4:
-				checkButtonX = c.Click.Button4.X
+				buttonX, buttonY = c.Click.Button4.X, c.Click.Button4.Y
 			case 5:
-				checkButtonX = c.Click.Button5.X
+				buttonX, buttonY = c.Click.Button5.X, c.Click.Button5.Y
 			case 6:
-				checkButtonX = c.Click.Button6.X
+				buttonX, buttonY = c.Click.Button6.X, c.Click.Button6.Y
 			}
 
-			if screenshotManager.CheckButtonActiveByPixel(checkButtonX, 35) {
-				hasActiveButtons = true
-				break
-			}
-		}
-
-		if !hasActiveButtons {
-			loggerManager.Info("🔍 Активных кнопок не найдено, обрабатываем список предметов без кнопок")
-			err := processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, cycles == 0 && buttonIndex == startButtonIndex, item, category)
-			if err != nil {
-				if err.Error() == "прерывание по запросу пользователя" {
-					loggerManager.Info("⏹️ Завершение работы по прерыванию")
-					return err
-				}
-				loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
-			}
-		} else {
-			// Обрабатываем кнопки как обычно
-			for buttonIndex <= 6 {
-				var buttonX, buttonY int
-				switch buttonIndex {
-				case 1:
-					buttonX, buttonY = c.Click.Button1.X, c.Click.Button1.Y
-				case 2:
-					buttonX, buttonY = c.Click.Button2.X, c.Click.Button2.Y
-				case 3:
-					buttonX, buttonY = c.Click.Button3.X, c.Click.Button3.Y
-				case 4:
-					buttonX, buttonY = c.Click.Button4.X, c.Click.Button4.Y
-				case 5:
-					buttonX, buttonY = c.Click.Button5.X, c.Click.Button5.Y
-				case 6:
-					buttonX, buttonY = c.Click.Button6.X, c.Click.Button6.Y
+			// Для начальной кнопки в первом цикле не проверяем активность - сразу кликаем
+			if buttonIndex == startButtonIndex && cycles == 0 {
+				loggerManager.Info("🔘 Обрабатываем начальную кнопку %d (первый цикл)", buttonIndex)
+				clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
+				err := processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, true, item, category)
+				if err != nil {
+					if err.Error() == "прерывание по запросу пользователя" {
+						loggerManager.Info("⏹️ Завершение работы по прерыванию")
+						return err
+					}
+					loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 				}
 
-				// Для начальной кнопки в первом цикле не проверяем активность - сразу кликаем
-				if buttonIndex == startButtonIndex && cycles == 0 {
-					loggerManager.Info("🔘 Обрабатываем начальную кнопку %d (первый цикл)", buttonIndex)
-					clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-					err := processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, true, item, category)
-					if err != nil {
-						if err.Error() == "прерывание по запросу пользователя" {
-							loggerManager.Info("⏹️ Завершение работы по прерыванию")
-							return err
+				// Для кнопки 6 продолжаем нажимать пока она активна
+				if buttonIndex == 6 {
+					for screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
+						loggerManager.Info("🔘 Повторно обрабатываем кнопку 6")
+						clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
+						err = processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false, item, category)
+						if err != nil {
+							if err.Error() == "прерывание по запросу пользователя" {
+								loggerManager.Info("⏹️ Завершение работы по прерыванию")
+								return err
+							}
+							loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 						}
-						loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 					}
+					loggerManager.Info("🔍 Кнопка 6 больше неактивна, завершаем обработку")
+					break
+				}
+			} else if buttonIndex == 1 {
+				// Кнопка 1 всегда кликается без проверки активности
+				loggerManager.Info("🔘 Обрабатываем кнопку 1 (всегда активна)")
+				clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
+				err := processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false, item, category)
+				if err != nil {
+					if err.Error() == "прерывание по запросу пользователя" {
+						loggerManager.Info("⏹️ Завершение работы по прерыванию")
+						return err
+					}
+					loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
+				}
 
-					// Для кнопки 6 продолжаем нажимать пока она активна
-					if buttonIndex == 6 {
-						for screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
-							loggerManager.Info("🔘 Повторно обрабатываем кнопку 6")
-							clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-							err = processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false, item, category)
-							if err != nil {
-								if err.Error() == "прерывание по запросу пользователя" {
-									loggerManager.Info("⏹️ Завершение работы по прерыванию")
-									return err
-								}
-								loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
+				// Для кнопки 6 продолжаем нажимать пока она активна
+				if buttonIndex == 6 {
+					for screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
+						loggerManager.Info("🔘 Повторно обрабатываем кнопку 6")
+						clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
+						err = processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false, item, category)
+						if err != nil {
+							if err.Error() == "прерывание по запросу пользователя" {
+								loggerManager.Info("⏹️ Завершение работы по прерыванию")
+								return err
 							}
+							loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
 						}
-						loggerManager.Info("🔍 Кнопка 6 больше неактивна, завершаем обработку")
-						break
 					}
-				} else if buttonIndex == 1 {
-					// Кнопка 1 всегда кликается без проверки активности
-					loggerManager.Info("🔘 Обрабатываем кнопку 1 (всегда активна)")
+					loggerManager.Info("🔍 Кнопка 6 больше неактивна, завершаем обработку")
+					break
+				}
+			} else {
+				// Для всех остальных кнопок проверяем активность
+				loggerManager.Info("🔍 Проверяем кнопку %d (начальная кнопка: %d, цикл: %d)", buttonIndex, startButtonIndex, cycles+1)
+
+				if screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
+					loggerManager.Info("🔘 Обрабатываем кнопку %d", buttonIndex)
 					clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-					err := processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false, item, category)
+					err := processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false, item, category)
 					if err != nil {
 						if err.Error() == "прерывание по запросу пользователя" {
 							loggerManager.Info("⏹️ Завершение работы по прерыванию")
@@ -324,7 +370,7 @@ func processItemsByCategory(c *config.Config, screenshotManager *screenshot.Scre
 						for screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
 							loggerManager.Info("🔘 Повторно обрабатываем кнопку 6")
 							clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-							err = processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false, item, category)
+							err = processItemListPage(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false, item, category)
 							if err != nil {
 								if err.Error() == "прерывание по запросу пользователя" {
 									loggerManager.Info("⏹️ Завершение работы по прерыванию")
@@ -337,48 +383,25 @@ func processItemsByCategory(c *config.Config, screenshotManager *screenshot.Scre
 						break
 					}
 				} else {
-					// Для всех остальных кнопок проверяем активность
-					loggerManager.Info("🔍 Проверяем кнопку %d (начальная кнопка: %d, цикл: %d)", buttonIndex, startButtonIndex, cycles+1)
-
-					if screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
-						loggerManager.Info("🔘 Обрабатываем кнопку %d", buttonIndex)
-						clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-						err := processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false, item, category)
-						if err != nil {
-							if err.Error() == "прерывание по запросу пользователя" {
-								loggerManager.Info("⏹️ Завершение работы по прерыванию")
-								return err
-							}
-							loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
-						}
-
-						// Для кнопки 6 продолжаем нажимать пока она активна
-						if buttonIndex == 6 {
-							for screenshotManager.CheckButtonActiveByPixel(buttonX, 35) {
-								loggerManager.Info("🔘 Повторно обрабатываем кнопку 6")
-								clickManager.ClickCoordinates(image.Point{X: buttonX, Y: buttonY})
-								err = processItemListPage(c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, false, item, category)
-								if err != nil {
-									if err.Error() == "прерывание по запросу пользователя" {
-										loggerManager.Info("⏹️ Завершение работы по прерыванию")
-										return err
-									}
-									loggerManager.LogError(err, "Ошибка при обработке страницы с предметами")
-								}
-							}
-							loggerManager.Info("🔍 Кнопка 6 больше неактивна, завершаем обработку")
-							break
-						}
-					} else {
-						loggerManager.Info("🔍 Кнопка %d неактивна, пропускаем", buttonIndex)
-					}
+					loggerManager.Info("🔍 Кнопка %d неактивна, пропускаем", buttonIndex)
 				}
-				buttonIndex++
 			}
+			buttonIndex++
 		}
-
-		clickManager.ClickCoordinates(image.Point{X: c.Click.Back.X, Y: c.Click.Back.Y})
 	}
 
+	clickManager.ClickCoordinates(image.Point{X: c.Click.Back.X, Y: c.Click.Back.Y})
+
+	// Сканирование записывается, когда конвейер сохранит все страницы предмета; бот тем временем ищет следующий
+	s.pages.Go(func() {
+		ids, err := batch.Wait()
+		if err != nil {
+			loggerManager.LogError(err, "Ошибка сохранения страниц предмета")
+		}
+		err = dbManager.RecordItemScan(item, category, scanStart, ids)
+		if err != nil {
+			loggerManager.LogError(err, "Ошибка записи сканирования предмета")
+		}
+	})
 	return nil
 }
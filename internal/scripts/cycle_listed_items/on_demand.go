@@ -0,0 +1,85 @@
+package cycle_listed_items
+
+import (
+	"image"
+	"shnyr/internal/click_manager"
+	"shnyr/internal/config"
+	"shnyr/internal/database"
+	"shnyr/internal/interrupt"
+	"shnyr/internal/logger"
+	"shnyr/internal/model"
+	"shnyr/internal/ocr"
+	"shnyr/internal/pipeline"
+	"shnyr/internal/screenshot"
+)
+
+// OnDemandSource отдает предметы, которые нужно отсканировать вне очереди (кнопка "Сканировать" в веб-интерфейсе)
+type OnDemandSource interface {
+	// Next возвращает следующий предмет категории category, ожидающий сканирования.
+	// done вызывается после сканирования с его результатом.
+	Next(category model.Category) (item string, done func(error), ok bool)
+}
+
+var onDemand OnDemandSource
+
+// SetOnDemandSource задает источник предметов для сканирования вне очереди.
+// Такие предметы сканируются между предметами текущей категории во время обхода.
+func SetOnDemandSource(source OnDemandSource) {
+	onDemand = source
+}
+
+// processOnDemand сканирует все ожидающие предметы категории category
+func processOnDemand(s *scan, c *config.Config, screenshotManager *screenshot.ScreenshotManager, ocrManager *ocr.OCRManager, dbManager *database.DatabaseManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager, category model.Category) error {
+	if onDemand == nil {
+		return nil
+	}
+	for {
+		item, done, ok := onDemand.Next(category)
+		if !ok {
+			return nil
+		}
+		loggerManager.Info("⚡ Сканирование по запросу: %s (категория: %s)", item, category)
+		err := processItem(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, category, item, 1, c.StartButtonIndex)
+		if err == nil {
+			// Запрос выполнен, когда результаты предмета сохранены
+			_, err = s.batch.Wait()
+		}
+		done(err)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ScanItem сканирует один предмет item категории category, когда бот простаивает
+func ScanItem(item string, category model.Category, c *config.Config, screenshotManager *screenshot.ScreenshotManager, dbManager *database.DatabaseManager, ocrManager *ocr.OCRManager, clickManager *click_manager.ClickManager, loggerManager *logger.LoggerManager, interruptManager *interrupt.InterruptManager) error {
+	s := &scan{pages: pipeline.New(c, ocrManager, dbManager, loggerManager)}
+	defer s.pages.Close()
+
+	// берем окно L2 в фокус
+	clickManager.FocusL2Window()
+
+	// Шнырь жмет F12 для открытия окна с предметами
+	clickManager.F12()
+
+	if category.IsBuy() {
+		clickManager.ClickCoordinates(image.Point{X: 53, Y: 46})
+		loggerManager.Info("📍 Переходим в раздел скупки (координаты 53, 46)")
+	} else {
+		// Раздел продажи открывается из раздела скупки, как при обычном обходе
+		clickManager.ClickCoordinates(image.Point{X: 53, Y: 46})
+		clickManager.ClickCoordinates(image.Point{X: 15, Y: 265})
+		clickManager.ClickCoordinates(image.Point{X: 53, Y: 64})
+		loggerManager.Info("📍 Переходим в раздел продажи (координаты 53, 64)")
+	}
+
+	loggerManager.Info("⚡ Сканирование по запросу: %s (категория: %s)", item, category)
+	err := processItem(s, c, screenshotManager, ocrManager, dbManager, clickManager, loggerManager, interruptManager, category, item, 1, c.StartButtonIndex)
+	if err == nil {
+		_, err = s.batch.Wait()
+	}
+
+	// Кликаем на координаты 15, 265 для перехода между разделами
+	clickManager.ClickCoordinates(image.Point{X: 15, Y: 265})
+	return err
+}
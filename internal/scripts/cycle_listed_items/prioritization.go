@@ -0,0 +1,108 @@
+package cycle_listed_items
+
+import (
+	"fmt"
+	"shnyr/internal/config"
+	"shnyr/internal/database"
+	"shnyr/internal/logger"
+	"shnyr/internal/model"
+	"shnyr/internal/prioritizer"
+	"time"
+)
+
+// historyDepth - сколько последних сканирований предмета учитывается при оценке
+const historyDepth = 10
+
+// newPrioritizer создает приоритизатор из настроек prioritizer в config.yaml
+func newPrioritizer(cfg config.Prioritizer) (*prioritizer.Prioritizer, error) {
+	var budget, horizon time.Duration
+	var err error
+	if cfg.CycleBudget != "" {
+		budget, err = time.ParseDuration(cfg.CycleBudget)
+		if err != nil {
+			return nil, fmt.Errorf("неверный prioritizer.cycle_budget %q: %v", cfg.CycleBudget, err)
+		}
+	}
+	if cfg.StaleAfter != "" {
+		horizon, err = time.ParseDuration(cfg.StaleAfter)
+		if err != nil {
+			return nil, fmt.Errorf("неверный prioritizer.stale_after %q: %v", cfg.StaleAfter, err)
+		}
+	}
+
+	weights := prioritizer.Weights{
+		Variance:  cfg.VarianceWeight,
+		Staleness: cfg.StalenessWeight,
+		Proximity: cfg.ProximityWeight,
+	}
+	if weights == (prioritizer.Weights{}) {
+		weights = prioritizer.DefaultWeights
+	}
+	return prioritizer.NewPrioritizer(weights, horizon, budget), nil
+}
+
+// planPass возвращает предметы каждой категории для прохода.
+// Без приоритизации - все предметы в порядке items_list; с приоритизацией - по убыванию оценки
+// в пределах бюджета времени на весь проход.
+func planPass(c *config.Config, dbManager *database.DatabaseManager, loggerManager *logger.LoggerManager, categories []model.Category) (map[model.Category][]string, error) {
+	plan := make(map[model.Category][]string)
+	if !c.Prioritizer.Enabled {
+		for _, category := range categories {
+			items, err := dbManager.GetItemsByCategory(category)
+			if err != nil {
+				return nil, err
+			}
+			plan[category] = items
+		}
+		return plan, nil
+	}
+
+	p, err := newPrioritizer(c.Prioritizer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Оцениваем предметы всех категорий вместе, чтобы бюджет делился на весь проход
+	var items []prioritizer.Item
+	itemCategory := make(map[string]model.Category)
+	for _, category := range categories {
+		listed, err := dbManager.GetListedItemsByCategory(category)
+		if err != nil {
+			return nil, err
+		}
+		history, err := dbManager.GetItemScanHistory(category, historyDepth)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, listedItem := range listed {
+			item := prioritizer.Item{Name: listedItem.Name, MinPrice: listedItem.MinPrice}
+			for i, scan := range history[listedItem.Name] {
+				if i == 0 {
+					item.Scanned = true
+					item.LastScan = scan.Age
+				}
+				if scan.BestPrice.Valid {
+					item.Prices = append(item.Prices, scan.BestPrice.Float64)
+				}
+				item.Durations = append(item.Durations, scan.Duration)
+			}
+			key := string(category) + "/" + listedItem.Name
+			item.Name = key
+			itemCategory[key] = category
+			items = append(items, item)
+		}
+	}
+
+	total := len(items)
+	planned := p.Plan(items)
+	for _, scored := range planned {
+		category := itemCategory[scored.Name]
+		name := scored.Name[len(category)+1:]
+		plan[category] = append(plan[category], name)
+		loggerManager.Info("📊 %s (%s): оценка %.2f (разброс %.2f, устаревание %.2f, близость к min_price %.2f)",
+			name, category, scored.Score, scored.Variance, scored.Stale, scored.Proximity)
+	}
+	loggerManager.Info("📊 В проход включено %d из %d предметов", len(planned), total)
+	return plan, nil
+}